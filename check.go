@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/yeldirium/hledger-language-server/internal/check"
+	"github.com/yeldirium/hledger-language-server/internal/diagnostics"
+	"github.com/yeldirium/hledger-language-server/internal/documentcache"
+	"github.com/yeldirium/hledger-language-server/internal/parsercache"
+)
+
+type checkOptions struct {
+	format   string
+	strict   bool
+	disabled string
+}
+
+// checkJournal reports the problems the language server would report in the
+// journal given as argument and all files it includes. It exits with 1 if
+// there are any, so that it can run in CI.
+func checkJournal(args []string) int {
+	options := checkOptions{}
+
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: hledger-language-server check [flags] [journal]\n\nChecks the journal, or the one LEDGER_FILE points to, and all files it includes.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&options.format, "format", string(check.FormatText), "write problems in the given `format`: text, json or sarif")
+	flags.BoolVar(&options.strict, "strict", false, "report postings to accounts that are not declared")
+	flags.StringVar(&options.disabled, "disable", "", "comma separated `codes` of problems that are not reported, like unbalanced-transaction")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	format := check.Format(options.format)
+	if !slices.Contains(check.Formats, format) {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", options.format)
+		return 2
+	}
+
+	journalFile := os.Getenv("LEDGER_FILE")
+	switch flags.NArg() {
+	case 0:
+		if journalFile == "" {
+			fmt.Fprintln(os.Stderr, "no journal given and LEDGER_FILE is not set")
+			return 2
+		}
+	case 1:
+		journalFile = flags.Arg(0)
+	default:
+		fmt.Fprintln(os.Stderr, "only one journal may be given")
+		return 2
+	}
+
+	journalFilePath, err := filepath.Abs(filepath.FromSlash(parsercache.ExpandHome(filepath.ToSlash(journalFile))))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to find journal: %v\n", err)
+		return 2
+	}
+
+	// Includes may point anywhere, like in the fallback folder of the server.
+	documentCache := documentcache.NewCache("/", os.DirFS("/"))
+	foundDiagnostics, err := check.Journal(context.Background(), documentCache, filepath.ToSlash(journalFilePath), check.Options{Strict: options.strict})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	disabledCodes := strings.Split(options.disabled, ",")
+	foundDiagnostics = slices.DeleteFunc(foundDiagnostics, func(diagnostic diagnostics.Diagnostic) bool {
+		return slices.Contains(disabledCodes, diagnostic.Code)
+	})
+	for i := range foundDiagnostics {
+		foundDiagnostics[i].Pos.Filename = displayPath(foundDiagnostics[i].Pos.Filename)
+		foundDiagnostics[i].EndPos.Filename = displayPath(foundDiagnostics[i].EndPos.Filename)
+	}
+
+	if err := check.WriteReport(os.Stdout, format, foundDiagnostics); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write problems: %v\n", err)
+		return 2
+	}
+
+	if len(foundDiagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// displayPath makes paths inside the working directory relative to it, so
+// that reports read the same on every machine.
+func displayPath(filePath string) string {
+	workingDirectory, err := os.Getwd()
+	if err != nil {
+		return filePath
+	}
+
+	relativePath, err := filepath.Rel(workingDirectory, filepath.FromSlash(filePath))
+	if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return filePath
+	}
+	return filepath.ToSlash(relativePath)
+}
@@ -0,0 +1,120 @@
+// Package check runs all checks that the language server reports as
+// diagnostics, for a single file in the editor or for a whole journal on the
+// command line, so that both report the same problems.
+package check
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/yeldirium/hledger-language-server/internal/diagnostics"
+	"github.com/yeldirium/hledger-language-server/internal/documentcache"
+	"github.com/yeldirium/hledger-language-server/internal/parsercache"
+)
+
+// Options select the checks that are only run on request.
+type Options struct {
+	// Strict reports postings to accounts that are not declared.
+	Strict bool
+}
+
+// File finds the problems in a file that belongs to the given journal. Checks
+// that depend on the rest of the journal, like balance assertions, are skipped
+// if the journal can not be resolved, since its problems are reported in the
+// files they are in. The journal file itself reports that they were skipped.
+func File(ctx context.Context, cache *parsercache.ParserCache, journalFilePath string, filePath string, options Options) []diagnostics.Diagnostic {
+	journal, err := cache.Parse(ctx, filePath)
+	if err != nil {
+		return []diagnostics.Diagnostic{diagnostics.ParseError(filePath, err)}
+	}
+
+	foundDiagnostics := diagnostics.CheckTransactionsBalance(journal)
+	foundDiagnostics = append(foundDiagnostics, diagnostics.CheckIncludes(ctx, journal, filePath, cache)...)
+
+	includeGraph := cache.BuildIncludeGraph(ctx, filePath)
+	for _, cycle := range includeGraph.CyclesIn(filePath) {
+		foundDiagnostics = append(foundDiagnostics, diagnostics.IncludeCycle(cycle.Edge.Directive, cycle.Files))
+	}
+
+	rootJournal, err := cache.Parse(ctx, journalFilePath)
+	if err != nil {
+		return foundDiagnostics
+	}
+	resolvedJournal, err := cache.ResolveIncludes(ctx, rootJournal, journalFilePath)
+	if err != nil {
+		if filePath == journalFilePath {
+			checks := []string{"balance assertions"}
+			if options.Strict {
+				checks = append(checks, "account declarations")
+			}
+			foundDiagnostics = append(foundDiagnostics, diagnostics.SkippedChecks(filePath, checks, err))
+		}
+		return foundDiagnostics
+	}
+
+	foundDiagnostics = append(foundDiagnostics, diagnostics.CheckBalanceAssertions(resolvedJournal, filePath)...)
+	if options.Strict {
+		// Accounts may be declared in any file of the journal.
+		foundDiagnostics = append(foundDiagnostics, diagnostics.CheckAccountsDeclared(resolvedJournal, filePath)...)
+	}
+
+	return foundDiagnostics
+}
+
+// Journal finds the problems in the journal and all files it includes, read
+// through the document cache, sorted by file and position. It fails if the
+// journal itself can not be read.
+func Journal(ctx context.Context, documentCache *documentcache.DocumentCache, journalFilePath string, options Options) ([]diagnostics.Diagnostic, error) {
+	if err := readable(ctx, documentCache, journalFilePath); err != nil {
+		return nil, err
+	}
+	cache := parsercache.NewCache(documentCache)
+
+	foundDiagnostics := make([]diagnostics.Diagnostic, 0)
+	for _, filePath := range journalFiles(ctx, cache, journalFilePath) {
+		foundDiagnostics = append(foundDiagnostics, File(ctx, cache, journalFilePath, filePath, options)...)
+	}
+
+	slices.SortStableFunc(foundDiagnostics, func(a, b diagnostics.Diagnostic) int {
+		return cmp.Or(
+			cmp.Compare(a.Pos.Filename, b.Pos.Filename),
+			cmp.Compare(a.Pos.Line, b.Pos.Line),
+			cmp.Compare(a.Pos.Column, b.Pos.Column),
+		)
+	})
+
+	return foundDiagnostics, nil
+}
+
+func readable(ctx context.Context, documentCache *documentcache.DocumentCache, filePath string) error {
+	file, err := documentCache.Open(ctx, filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open journal: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(io.Discard, file); err != nil {
+		return fmt.Errorf("failed to read journal: %w", err)
+	}
+	return nil
+}
+
+// journalFiles returns the journal and all files it includes, directly or
+// through other files, in the order they are included.
+func journalFiles(ctx context.Context, cache *parsercache.ParserCache, journalFilePath string) []string {
+	includeGraph := cache.BuildIncludeGraph(ctx, journalFilePath)
+
+	files := []string{journalFilePath}
+	for i := 0; i < len(files); i++ {
+		for _, edge := range includeGraph.Includes(files[i]) {
+			if !slices.Contains(files, edge.To) {
+				files = append(files, edge.To)
+			}
+		}
+	}
+
+	return files
+}
@@ -0,0 +1,89 @@
+package check
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/yeldirium/hledger-language-server/internal/diagnostics"
+	"github.com/yeldirium/hledger-language-server/internal/documentcache"
+)
+
+func newTestDocumentCache(files map[string]string) *documentcache.DocumentCache {
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content)}
+	}
+	return documentcache.NewCache("/", fsys)
+}
+
+func codesByFile(foundDiagnostics []diagnostics.Diagnostic) map[string][]string {
+	codes := make(map[string][]string)
+	for _, diagnostic := range foundDiagnostics {
+		codes[diagnostic.Pos.Filename] = append(codes[diagnostic.Pos.Filename], diagnostic.Code)
+	}
+	return codes
+}
+
+func TestJournal(t *testing.T) {
+	files := map[string]string{
+		"ledger/main.journal": `account assets:Cash
+include 2024.journal
+
+2024-12-01 Payee
+    expenses:Food  2 €
+    assets:Cash  -2 € = 7 €
+`,
+		"ledger/2024.journal": `2024-11-25 Payee
+    assets:Cash  10 €
+    income:Salary  -9 €
+`,
+	}
+
+	t.Run("checks the journal and all files it includes.", func(t *testing.T) {
+		foundDiagnostics, err := Journal(context.Background(), newTestDocumentCache(files), "/ledger/main.journal", Options{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{
+			"/ledger/main.journal": {diagnostics.CodeFailedAssertion},
+			"/ledger/2024.journal": {diagnostics.CodeUnbalancedTransaction},
+		}, codesByFile(foundDiagnostics))
+	})
+
+	t.Run("skips the checks that need the whole journal if the includes can not be resolved, and reports that.", func(t *testing.T) {
+		files := map[string]string{
+			"ledger/main.journal":   "include broken.journal\ninclude missing.journal\n2024-11-25 Payee\n    assets:Cash  10 € = 5 €\n    income:Salary\n",
+			"ledger/broken.journal": "2024-11-26 Payee\n    (foo\n",
+		}
+
+		foundDiagnostics, err := Journal(context.Background(), newTestDocumentCache(files), "/ledger/main.journal", Options{})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{
+			"/ledger/main.journal":   {diagnostics.CodeSkippedChecks, diagnostics.CodeUnresolvedInclude},
+			"/ledger/broken.journal": {diagnostics.CodeParseError},
+		}, codesByFile(foundDiagnostics))
+	})
+
+	t.Run("reports undeclared accounts in strict mode.", func(t *testing.T) {
+		files := map[string]string{
+			"ledger/main.journal": "account assets:Cash\ninclude 2024.journal\n",
+			"ledger/2024.journal": "2024-11-25 Payee\n    assets:Cash  10 €\n    income:Salary\n",
+		}
+
+		foundDiagnostics, err := Journal(context.Background(), newTestDocumentCache(files), "/ledger/main.journal", Options{Strict: true})
+
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]string{
+			"/ledger/2024.journal": {diagnostics.CodeUndeclaredAccount},
+		}, codesByFile(foundDiagnostics))
+	})
+
+	t.Run("fails if the journal can not be read.", func(t *testing.T) {
+		_, err := Journal(context.Background(), newTestDocumentCache(files), "/ledger/other.journal", Options{})
+
+		assert.Error(t, err)
+	})
+}
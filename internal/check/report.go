@@ -0,0 +1,212 @@
+package check
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+
+	"github.com/yeldirium/hledger-language-server/internal/diagnostics"
+	"github.com/yeldirium/hledger-language-server/internal/version"
+)
+
+// Format is an output format for the problems found in a journal.
+type Format string
+
+const (
+	// FormatText writes a line per problem, like compilers do.
+	FormatText Format = "text"
+	// FormatJSON writes an array of problems.
+	FormatJSON Format = "json"
+	// FormatSARIF writes a SARIF 2.1.0 log, which code scanning services
+	// read.
+	FormatSARIF Format = "sarif"
+)
+
+var Formats = []Format{FormatText, FormatJSON, FormatSARIF}
+
+// WriteReport writes the problems in the given format. File names are written
+// as they are, so they should be relative to where the report is read.
+func WriteReport(writer io.Writer, format Format, foundDiagnostics []diagnostics.Diagnostic) error {
+	switch format {
+	case FormatText:
+		return writeText(writer, foundDiagnostics)
+	case FormatJSON:
+		return writeJSON(writer, foundDiagnostics)
+	case FormatSARIF:
+		return writeSARIF(writer, foundDiagnostics)
+	}
+	return fmt.Errorf("unknown format %q", format)
+}
+
+func writeText(writer io.Writer, foundDiagnostics []diagnostics.Diagnostic) error {
+	for _, diagnostic := range foundDiagnostics {
+		_, err := fmt.Fprintf(writer, "%s:%d:%d: %s: %s [%s]\n",
+			diagnostic.Pos.Filename,
+			diagnostic.Pos.Line,
+			diagnostic.Pos.Column,
+			diagnostic.Severity,
+			diagnostic.Message,
+			diagnostic.Code,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type jsonDiagnostic struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Severity  string `json:"severity"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+func writeJSON(writer io.Writer, foundDiagnostics []diagnostics.Diagnostic) error {
+	jsonDiagnostics := make([]jsonDiagnostic, len(foundDiagnostics))
+	for i, diagnostic := range foundDiagnostics {
+		jsonDiagnostics[i] = jsonDiagnostic{
+			File:      diagnostic.Pos.Filename,
+			Line:      diagnostic.Pos.Line,
+			Column:    diagnostic.Pos.Column,
+			EndLine:   diagnostic.EndPos.Line,
+			EndColumn: diagnostic.EndPos.Column,
+			Severity:  diagnostic.Severity.String(),
+			Code:      diagnostic.Code,
+			Message:   diagnostic.Message,
+		}
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonDiagnostics)
+}
+
+// The SARIF types cover the part of the format that is needed to report
+// problems in files, see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+func sarifLevel(severity diagnostics.Severity) string {
+	switch severity {
+	case diagnostics.SeverityError:
+		return "error"
+	case diagnostics.SeverityWarning:
+		return "warning"
+	}
+	return "note"
+}
+
+// sarifURI refers to relative files by their path and to absolute files by
+// their file URI.
+func sarifURI(filePath string) string {
+	if path.IsAbs(filePath) {
+		return "file://" + filePath
+	}
+	return filePath
+}
+
+func writeSARIF(writer io.Writer, foundDiagnostics []diagnostics.Diagnostic) error {
+	rules := make([]sarifRule, 0)
+	results := make([]sarifResult, len(foundDiagnostics))
+	for i, diagnostic := range foundDiagnostics {
+		if !slices.ContainsFunc(rules, func(rule sarifRule) bool { return rule.ID == diagnostic.Code }) {
+			rules = append(rules, sarifRule{ID: diagnostic.Code})
+		}
+
+		results[i] = sarifResult{
+			RuleID:  diagnostic.Code,
+			Level:   sarifLevel(diagnostic.Severity),
+			Message: sarifMessage{Text: diagnostic.Message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: sarifURI(diagnostic.Pos.Filename)},
+					Region: sarifRegion{
+						StartLine:   diagnostic.Pos.Line,
+						StartColumn: diagnostic.Pos.Column,
+						EndLine:     diagnostic.EndPos.Line,
+						EndColumn:   diagnostic.EndPos.Column,
+					},
+				},
+			}},
+		}
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "hledger-language-server",
+				Version:        version.Version(),
+				InformationURI: "https://github.com/yeldirium/hledger-language-server",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
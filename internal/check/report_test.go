@@ -0,0 +1,74 @@
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	participleLexer "github.com/alecthomas/participle/v2/lexer"
+
+	"github.com/yeldirium/hledger-language-server/internal/diagnostics"
+)
+
+var reportedDiagnostics = []diagnostics.Diagnostic{
+	{
+		Pos:      participleLexer.Position{Filename: "ledger/main.journal", Line: 4, Column: 5},
+		EndPos:   participleLexer.Position{Filename: "ledger/main.journal", Line: 5, Column: 1},
+		Severity: diagnostics.SeverityError,
+		Code:     diagnostics.CodeUnbalancedTransaction,
+		Message:  "transaction is unbalanced by 1 €",
+	},
+}
+
+func TestWriteReport(t *testing.T) {
+	t.Run("writes a line per problem as text.", func(t *testing.T) {
+		var output bytes.Buffer
+
+		err := WriteReport(&output, FormatText, reportedDiagnostics)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "ledger/main.journal:4:5: error: transaction is unbalanced by 1 € [unbalanced-transaction]\n", output.String())
+	})
+
+	t.Run("writes an array of problems as JSON.", func(t *testing.T) {
+		var output bytes.Buffer
+
+		err := WriteReport(&output, FormatJSON, reportedDiagnostics)
+		assert.NoError(t, err)
+
+		var decoded []jsonDiagnostic
+		assert.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+		assert.Equal(t, []jsonDiagnostic{{
+			File:      "ledger/main.journal",
+			Line:      4,
+			Column:    5,
+			EndLine:   5,
+			EndColumn: 1,
+			Severity:  "error",
+			Code:      "unbalanced-transaction",
+			Message:   "transaction is unbalanced by 1 €",
+		}}, decoded)
+	})
+
+	t.Run("writes a SARIF log with a rule per code.", func(t *testing.T) {
+		var output bytes.Buffer
+
+		err := WriteReport(&output, FormatSARIF, append(reportedDiagnostics, reportedDiagnostics...))
+		assert.NoError(t, err)
+
+		var decoded sarifLog
+		assert.NoError(t, json.Unmarshal(output.Bytes(), &decoded))
+		assert.Equal(t, "2.1.0", decoded.Version)
+		assert.Equal(t, []sarifRule{{ID: "unbalanced-transaction"}}, decoded.Runs[0].Tool.Driver.Rules)
+		assert.Equal(t, 2, len(decoded.Runs[0].Results))
+		result := decoded.Runs[0].Results[0]
+		assert.Equal(t, "error", result.Level)
+		assert.Equal(t, "ledger/main.journal", result.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+		assert.Equal(t, sarifRegion{StartLine: 4, StartColumn: 5, EndLine: 5, EndColumn: 1}, result.Locations[0].PhysicalLocation.Region)
+	})
+
+	t.Run("fails for unknown formats.", func(t *testing.T) {
+		assert.Error(t, WriteReport(&bytes.Buffer{}, Format("xml"), reportedDiagnostics))
+	})
+}
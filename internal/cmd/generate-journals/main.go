@@ -0,0 +1,39 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/yeldirium/hledger-language-server/internal/journalgen"
+)
+
+func main() {
+	output := flag.String("output", ".", "directory to write the journals to")
+	accounts := flag.Int("accounts", journalgen.DefaultOptions.Accounts, "number of accounts")
+	transactions := flag.Int("transactions", journalgen.DefaultOptions.Transactions, "number of transactions")
+	includes := flag.Int("includes", journalgen.DefaultOptions.Includes, "number of journals included by the root journal")
+	seed := flag.Uint64("seed", journalgen.DefaultOptions.Seed, "seed for the generated transactions")
+	flag.Parse()
+
+	journals := journalgen.Generate(journalgen.Options{
+		Accounts:     *accounts,
+		Transactions: *transactions,
+		Includes:     *includes,
+		Seed:         *seed,
+	})
+
+	if err := os.MkdirAll(*output, 0o755); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to create the output directory: %v\n", err)
+		os.Exit(1)
+	}
+	for fileName, content := range journals {
+		if err := os.WriteFile(filepath.Join(*output, fileName), []byte(content), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", fileName, err)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Wrote %d journals, the root journal is %s\n", len(journals), filepath.Join(*output, journalgen.RootJournal))
+}
@@ -0,0 +1,272 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/participle/v2"
+	participleLexer "github.com/alecthomas/participle/v2/lexer"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota + 1
+	SeverityWarning
+	SeverityInformation
+	SeverityHint
+)
+
+func (severity Severity) String() string {
+	switch severity {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInformation:
+		return "information"
+	case SeverityHint:
+		return "hint"
+	}
+	return "unknown"
+}
+
+const (
+	CodeParseError            = "parse-error"
+	CodeInvalidAmount         = "invalid-amount"
+	CodeUnbalancedTransaction = "unbalanced-transaction"
+	CodeUnresolvedInclude     = "unresolved-include"
+	CodeIncludeCycle          = "include-cycle"
+	CodeUndeclaredAccount     = "undeclared-account"
+	CodeFailedAssertion       = "failed-assertion"
+	CodeSkippedChecks         = "skipped-checks"
+)
+
+// Diagnostic is a problem found in a journal. Pos and EndPos span the part of
+// the file the problem refers to.
+type Diagnostic struct {
+	Pos      participleLexer.Position
+	EndPos   participleLexer.Position
+	Severity Severity
+	Code     string
+	Message  string
+}
+
+// ParseError turns an error returned by the journal parser into a diagnostic.
+func ParseError(filePath string, err error) Diagnostic {
+	pos := participleLexer.Position{Filename: filePath, Line: 1, Column: 1}
+	message := err.Error()
+
+	var participleError participle.Error
+	if errors.As(err, &participleError) {
+		pos = participleError.Position()
+		message = participleError.Message()
+	}
+	if pos.Filename == "" {
+		pos.Filename = filePath
+	}
+
+	endPos := pos
+	endPos.Line += 1
+	endPos.Column = 1
+
+	return Diagnostic{
+		Pos:      pos,
+		EndPos:   endPos,
+		Severity: SeverityError,
+		Code:     CodeParseError,
+		Message:  message,
+	}
+}
+
+// CheckTransactionsBalance reports transactions whose postings do not balance
+// and postings whose amounts can not be parsed. Transactions with an invalid
+// amount are not checked for their balance.
+func CheckTransactionsBalance(journal *ledger.Journal) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	styles := ledger.CommodityStyles(journal)
+
+	for _, transaction := range ledger.Transactions(journal) {
+		balance, err := transaction.Balance()
+		if err != nil {
+			diagnostics = append(diagnostics, invalidAmountDiagnostics(transaction)...)
+			continue
+		}
+
+		if !balance.Real.IsBalanced() {
+			diagnostics = append(diagnostics, unbalancedDiagnostic(transaction, balance.Real, "transaction", styles))
+		}
+		if !balance.Virtual.IsBalanced() {
+			diagnostics = append(diagnostics, unbalancedDiagnostic(transaction, balance.Virtual, "balanced virtual postings of the transaction", styles))
+		}
+	}
+
+	return diagnostics
+}
+
+func invalidAmountDiagnostics(transaction ledger.Transaction) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	for _, posting := range transaction.Postings {
+		if _, err := ledger.ParsePostingAmount(posting.AmountText()); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Pos:      posting.Account().Pos,
+				EndPos:   lineEnd(posting.Account().Pos),
+				Severity: SeverityError,
+				Code:     CodeInvalidAmount,
+				Message:  err.Error(),
+			})
+		}
+	}
+	return diagnostics
+}
+
+func unbalancedDiagnostic(transaction ledger.Transaction, group ledger.BalanceGroup, subject string, styles map[string]ledger.AmountStyle) Diagnostic {
+	message := fmt.Sprintf("%s has more than one posting without an amount", subject)
+	if len(group.Amountless) == 0 {
+		residual := group.RoundedResidual().Format(styles, ledger.AmountStyle{CommoditySpaced: true})
+		message = fmt.Sprintf("%s is unbalanced by %s", subject, strings.Join(residual, ", "))
+	}
+
+	return Diagnostic{
+		Pos:      transaction.Header.Pos,
+		EndPos:   lineEnd(transaction.Header.Pos),
+		Severity: SeverityError,
+		Code:     CodeUnbalancedTransaction,
+		Message:  message,
+	}
+}
+
+// IncludeResolver finds the files that an include directive refers to.
+type IncludeResolver interface {
+	ResolveIncludePath(ctx context.Context, journalFilePath string, includePath string) ([]string, error)
+}
+
+// CheckIncludes reports include directives of the journal that do not refer to
+// any file.
+func CheckIncludes(ctx context.Context, journal *ledger.Journal, journalFilePath string, resolver IncludeResolver) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+
+	for _, entry := range journal.Entries {
+		directive, ok := entry.(*ledger.IncludeDirective)
+		if !ok {
+			continue
+		}
+
+		if _, err := resolver.ResolveIncludePath(ctx, journalFilePath, directive.IncludePath); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Pos:      directive.Pos,
+				EndPos:   lineEnd(directive.Pos),
+				Severity: SeverityError,
+				Code:     CodeUnresolvedInclude,
+				Message:  err.Error(),
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// IncludeCycle reports an include directive that includes a file which
+// includes the file containing the directive again. The files are the chain of
+// includes that leads back to it.
+func IncludeCycle(directive *ledger.IncludeDirective, files []string) Diagnostic {
+	return Diagnostic{
+		Pos:      directive.Pos,
+		EndPos:   lineEnd(directive.Pos),
+		Severity: SeverityError,
+		Code:     CodeIncludeCycle,
+		Message:  fmt.Sprintf("include cycle: %s -> %s", strings.Join(files, " -> "), files[0]),
+	}
+}
+
+// SkippedChecks reports that the checks of the journal in the given file that
+// need the whole journal were skipped, since its includes could not be
+// resolved.
+func SkippedChecks(filePath string, checks []string, err error) Diagnostic {
+	pos := participleLexer.Position{Filename: filePath, Line: 1, Column: 1}
+	return Diagnostic{
+		Pos:      pos,
+		EndPos:   lineEnd(pos),
+		Severity: SeverityWarning,
+		Code:     CodeSkippedChecks,
+		Message:  fmt.Sprintf("%s were not checked, since the journal could not be resolved: %v", strings.Join(checks, " and "), err),
+	}
+}
+
+// CheckBalanceAssertions reports balance assertions in the given file that do
+// not hold. The running balances are summed up over the whole resolved
+// journal, in the order of the journal.
+func CheckBalanceAssertions(resolvedJournal *ledger.Journal, filePath string) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+	styles := ledger.CommodityStyles(resolvedJournal)
+
+	for _, assertion := range ledger.BalanceAssertions(resolvedJournal) {
+		posting := assertion.Posting
+		if posting.Account().Pos.Filename != filePath || assertion.Holds() {
+			continue
+		}
+
+		actual := assertion.RunningBalance
+		asserted := assertion.PostingAmount.Assertion
+		if !assertion.PostingAmount.TotalAssertion {
+			actual = ledger.MixedAmount{}
+			if quantity, ok := assertion.RunningBalance[asserted.Commodity]; ok {
+				actual.Add(quantity, asserted.Commodity)
+			}
+		}
+		actualText := "0"
+		if !actual.IsZero() {
+			actualText = strings.Join(actual.Format(styles, asserted.Style), ", ")
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Pos:      posting.AmountPos(),
+			EndPos:   lineEnd(posting.AmountPos()),
+			Severity: SeverityError,
+			Code:     CodeFailedAssertion,
+			Message:  fmt.Sprintf("balance assertion failed: expected %s, but the balance of %s is %s", asserted, posting.Account(), actualText),
+		})
+	}
+
+	return diagnostics
+}
+
+// CheckAccountsDeclared reports postings in the given file whose account is not
+// declared with an account directive anywhere in the resolved journal, like
+// hledger does in strict mode.
+func CheckAccountsDeclared(resolvedJournal *ledger.Journal, filePath string) []Diagnostic {
+	diagnostics := make([]Diagnostic, 0)
+
+	for _, accountName := range ledger.UndeclaredAccountNames(resolvedJournal) {
+		if accountName.Pos.Filename != filePath {
+			continue
+		}
+
+		endPos := accountName.Pos
+		endPos.Offset += len(accountName.String())
+		endPos.Column += utf8.RuneCountInString(accountName.String())
+		diagnostics = append(diagnostics, Diagnostic{
+			Pos:      accountName.Pos,
+			EndPos:   endPos,
+			Severity: SeverityError,
+			Code:     CodeUndeclaredAccount,
+			Message:  fmt.Sprintf("account %s is not declared", accountName),
+		})
+	}
+
+	return diagnostics
+}
+
+// lineEnd returns the start of the line after pos.
+func lineEnd(pos participleLexer.Position) participleLexer.Position {
+	return participleLexer.Position{
+		Filename: pos.Filename,
+		Line:     pos.Line + 1,
+		Column:   1,
+	}
+}
@@ -0,0 +1,202 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	participleLexer "github.com/alecthomas/participle/v2/lexer"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+func parseTestJournal(t *testing.T, input string) *ledger.Journal {
+	t.Helper()
+
+	journal, err := ledger.NewJournalParser().ParseString("test.journal", input)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return journal
+}
+
+func TestParseError(t *testing.T) {
+	t.Run("uses the position of the parse error.", func(t *testing.T) {
+		_, err := ledger.NewJournalParser().ParseString("test.journal", "account assets\n    (foo\n")
+		if !assert.Error(t, err) {
+			t.FailNow()
+		}
+
+		diagnostic := ParseError("test.journal", err)
+
+		assert.Equal(t, CodeParseError, diagnostic.Code)
+		assert.Equal(t, SeverityError, diagnostic.Severity)
+		assert.Equal(t, "test.journal", diagnostic.Pos.Filename)
+		assert.Equal(t, 2, diagnostic.Pos.Line)
+		assert.Equal(t, 3, diagnostic.EndPos.Line)
+	})
+}
+
+func TestCheckTransactionsBalance(t *testing.T) {
+	t.Run("reports unbalanced transactions on their header.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10.50 €
+    assets:Cash  -10 €
+
+2024-11-26 Balanced
+    expenses:Groceries  10 €
+    assets:Cash
+
+2024-11-27 Too many amountless postings
+    expenses:Groceries
+    assets:Cash
+`)
+
+		diagnostics := CheckTransactionsBalance(journal)
+		transactions := ledger.Transactions(journal)
+
+		assert.Equal(t, []Diagnostic{
+			{
+				Pos:      transactions[0].Header.Pos,
+				EndPos:   participleLexer.Position{Filename: "test.journal", Line: 2, Column: 1},
+				Severity: SeverityError,
+				Code:     CodeUnbalancedTransaction,
+				Message:  "transaction is unbalanced by 0.50 €",
+			},
+			{
+				Pos:      transactions[2].Header.Pos,
+				EndPos:   participleLexer.Position{Filename: "test.journal", Line: 10, Column: 1},
+				Severity: SeverityError,
+				Code:     CodeUnbalancedTransaction,
+				Message:  "transaction has more than one posting without an amount",
+			},
+		}, diagnostics)
+	})
+
+	t.Run("reports postings with invalid amounts.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10 € 20
+    assets:Cash
+`)
+
+		diagnostics := CheckTransactionsBalance(journal)
+
+		assert.Len(t, diagnostics, 1)
+		assert.Equal(t, CodeInvalidAmount, diagnostics[0].Code)
+		assert.Equal(t, 2, diagnostics[0].Pos.Line)
+	})
+}
+
+type testIncludeResolver map[string][]string
+
+func (resolver testIncludeResolver) ResolveIncludePath(ctx context.Context, journalFilePath string, includePath string) ([]string, error) {
+	filePaths, ok := resolver[includePath]
+	if !ok {
+		return nil, errors.New("included file not found")
+	}
+	return filePaths, nil
+}
+
+func TestCheckIncludes(t *testing.T) {
+	t.Run("reports include directives that do not refer to any file.", func(t *testing.T) {
+		journal := parseTestJournal(t, `include accounts.journal
+include 2024/*.journal
+`)
+		resolver := testIncludeResolver{
+			"accounts.journal": {"accounts.journal"},
+		}
+
+		diagnostics := CheckIncludes(context.Background(), journal, "test.journal", resolver)
+
+		assert.Equal(t, []Diagnostic{
+			{
+				Pos:      participleLexer.Position{Filename: "test.journal", Offset: 25, Line: 2, Column: 1},
+				EndPos:   participleLexer.Position{Filename: "test.journal", Line: 3, Column: 1},
+				Severity: SeverityError,
+				Code:     CodeUnresolvedInclude,
+				Message:  "included file not found",
+			},
+		}, diagnostics)
+	})
+}
+
+func TestIncludeCycle(t *testing.T) {
+	t.Run("describes the chain of includes.", func(t *testing.T) {
+		journal := parseTestJournal(t, "account assets\ninclude a.journal\n")
+		directive := journal.Entries[1].(*ledger.IncludeDirective)
+
+		diagnostic := IncludeCycle(directive, []string{"a.journal", "test.journal"})
+
+		assert.Equal(t, CodeIncludeCycle, diagnostic.Code)
+		assert.Equal(t, 2, diagnostic.Pos.Line)
+		assert.Equal(t, "include cycle: a.journal -> test.journal -> a.journal", diagnostic.Message)
+	})
+}
+
+func TestSkippedChecks(t *testing.T) {
+	t.Run("names the skipped checks and the reason at the start of the journal.", func(t *testing.T) {
+		diagnostic := SkippedChecks("test.journal", []string{"balance assertions", "account declarations"}, errors.New("permission denied"))
+
+		assert.Equal(t, CodeSkippedChecks, diagnostic.Code)
+		assert.Equal(t, SeverityWarning, diagnostic.Severity)
+		assert.Equal(t, 1, diagnostic.Pos.Line)
+		assert.Equal(t, "balance assertions and account declarations were not checked, since the journal could not be resolved: permission denied", diagnostic.Message)
+	})
+}
+
+func TestCheckAccountsDeclared(t *testing.T) {
+	t.Run("reports postings in the file whose account is not declared.", func(t *testing.T) {
+		journal := parseTestJournal(t, `account assets:Cash
+
+2024-11-25 Payee
+    expenses:Food  10 €
+    assets:Cash
+`)
+
+		diagnostics := CheckAccountsDeclared(journal, "test.journal")
+
+		assert.Equal(t, []Diagnostic{
+			{
+				Pos:      participleLexer.Position{Filename: "test.journal", Offset: 42, Line: 4, Column: 5},
+				EndPos:   participleLexer.Position{Filename: "test.journal", Offset: 55, Line: 4, Column: 18},
+				Severity: SeverityError,
+				Code:     CodeUndeclaredAccount,
+				Message:  "account expenses:Food is not declared",
+			},
+		}, diagnostics)
+	})
+
+	t.Run("ignores postings in other files.", func(t *testing.T) {
+		journal := parseTestJournal(t, "2024-11-25 Payee\n    expenses:Food  10 €\n    assets:Cash\n")
+
+		assert.Empty(t, CheckAccountsDeclared(journal, "other.journal"))
+	})
+}
+
+func TestCheckBalanceAssertions(t *testing.T) {
+	t.Run("reports assertions in the file that do not hold.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    assets:Cash  10 € = 10 €
+    income:Salary
+
+2024-11-26 Payee
+    expenses:Food  2 €
+    assets:Cash  -2 € = 9 €
+`)
+		transactions := ledger.Transactions(journal)
+
+		diagnostics := CheckBalanceAssertions(journal, "test.journal")
+
+		assert.Equal(t, []Diagnostic{
+			{
+				Pos:      transactions[1].Postings[1].AmountPos(),
+				EndPos:   participleLexer.Position{Filename: "test.journal", Line: 8, Column: 1},
+				Severity: SeverityError,
+				Code:     CodeFailedAssertion,
+				Message:  "balance assertion failed: expected 9 €, but the balance of assets:Cash is 8 €",
+			},
+		}, diagnostics)
+		assert.Empty(t, CheckBalanceAssertions(journal, "other.journal"))
+	})
+}
@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"path"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/yeldirium/hledger-language-server/internal/lru"
 	"github.com/yeldirium/hledger-language-server/internal/telemetry"
 	"go.opentelemetry.io/otel/attribute"
 )
@@ -17,39 +21,198 @@ var (
 	ErrFileNotFound = fmt.Errorf("file not found")
 )
 
+// DocumentCache holds the documents of a workspace folder. Documents are
+// addressed by their absolute, slash-separated paths. The workspace file
+// system is rooted at the folder, so documents outside of it can only be
+// opened after they were set in the cache, or through the file system set
+// with SetOutsideFS.
+//
+// Documents set in the cache are the ones open in the editor and stay until
+// they are deleted. Documents read from the workspace are evicted once the
+// cache exceeds its limits, least recently used first.
 type DocumentCache struct {
 	sync.RWMutex
-	files     map[string]string
+	files     *lru.Cache[string, cachedFile]
+	root      string
 	workspace fs.FS
+	// outside is rooted at the root of the file system and reads documents
+	// outside of the folder, like journals included from a parent folder. It
+	// may be nil.
+	outside fs.FS
 }
 
-func NewCache(workspace fs.FS) *DocumentCache {
+// cachedFile is the content of a document together with the time it was last
+// modified, either on disk or in the editor.
+type cachedFile struct {
+	content      string
+	lastModified time.Time
+}
+
+func NewCache(root string, workspace fs.FS) *DocumentCache {
 	return &DocumentCache{
-		files:     make(map[string]string),
+		files:     lru.New[string, cachedFile](lru.Limits{}),
+		root:      path.Clean(root),
 		workspace: workspace,
 	}
 }
 
+// Root returns the absolute path of the folder the workspace is rooted at.
+func (c *DocumentCache) Root() string {
+	return c.root
+}
+
+// SetOutsideFS sets the file system, rooted at the root of the file system,
+// that documents outside of the workspace folder are read from. Contains still
+// reports only the documents in the folder.
+func (c *DocumentCache) SetOutsideFS(outside fs.FS) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.outside = outside
+}
+
+// Contains reports whether the path lies in the workspace folder.
+func (c *DocumentCache) Contains(filePath string) bool {
+	_, ok := c.workspacePath(filePath)
+	return ok
+}
+
+// Files returns the paths of all cached documents, sorted.
+func (c *DocumentCache) Files() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	fileNames := c.files.Keys()
+	slices.Sort(fileNames)
+	return fileNames
+}
+
+// SetLimits bounds the documents read from the workspace that the cache keeps.
+func (c *DocumentCache) SetLimits(limits lru.Limits) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.files.SetLimits(limits)
+}
+
+// Stats returns how often documents were found in the cache and evicted.
+func (c *DocumentCache) Stats() lru.Stats {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.files.Stats()
+}
+
+// IsPinned reports whether the document was set in the cache, as opposed to
+// read from the workspace, so that it is never evicted.
+func (c *DocumentCache) IsPinned(fileName string) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.files.IsPinned(fileName)
+}
+
+// workspacePath converts an absolute path into a path of the workspace file
+// system.
+func (c *DocumentCache) workspacePath(filePath string) (string, bool) {
+	return relativePath(c.root, filePath)
+}
+
+// fileSystemFor returns the file system that the document at the absolute
+// path is read from, the absolute path that file system is rooted at and the
+// path of the document in it.
+func (c *DocumentCache) fileSystemFor(filePath string) (fs.FS, string, string, bool) {
+	if workspacePath, ok := c.workspacePath(filePath); ok {
+		return c.workspace, c.root, workspacePath, true
+	}
+
+	c.RLock()
+	outside := c.outside
+	c.RUnlock()
+	if outside == nil {
+		return nil, "", "", false
+	}
+	outsidePath, ok := relativePath("/", filePath)
+	return outside, "/", outsidePath, ok
+}
+
+// relativePath converts an absolute path into a path of a file system rooted
+// at the given absolute path.
+func relativePath(root string, filePath string) (string, bool) {
+	if !path.IsAbs(filePath) {
+		return "", false
+	}
+	filePath = path.Clean(filePath)
+
+	if filePath == root {
+		return ".", true
+	}
+	if root == "/" {
+		return filePath[1:], true
+	}
+	relativePath, ok := strings.CutPrefix(filePath, root+"/")
+	return relativePath, ok
+}
+
 func (c *DocumentCache) GetFile(fileName string) (string, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	file, ok := c.files.Get(fileName)
+	return file.content, ok
+}
+
+// LastModified returns the time a cached document was last modified.
+func (c *DocumentCache) LastModified(fileName string) (time.Time, bool) {
 	c.RLock()
 	defer c.RUnlock()
 
-	fileContent, ok := c.files[fileName]
-	return fileContent, ok
+	file, ok := c.files.Peek(fileName)
+	return file.lastModified, ok
 }
 
 func (c *DocumentCache) SetFile(fileName string, content string) {
+	c.setFile(fileName, content, time.Now(), true)
+}
+
+func (c *DocumentCache) setFile(fileName string, content string, lastModified time.Time, pinned bool) {
 	c.Lock()
 	defer c.Unlock()
 
-	c.files[fileName] = content
+	c.files.Add(fileName, cachedFile{
+		content:      content,
+		lastModified: lastModified,
+	}, len(content), pinned)
 }
 
 func (c *DocumentCache) DeleteFile(fileName string) {
 	c.Lock()
 	defer c.Unlock()
 
-	delete(c.files, fileName)
+	c.files.Remove(fileName)
+}
+
+// Refresh drops a cached document if the file in the workspace was modified
+// or deleted since the document was cached, so that the next Open reads it
+// again. It reports whether the document was dropped.
+func (c *DocumentCache) Refresh(fileName string) bool {
+	lastModified, ok := c.LastModified(fileName)
+	if !ok {
+		return false
+	}
+
+	fileSystem, _, fileSystemPath, ok := c.fileSystemFor(fileName)
+	if !ok {
+		return false
+	}
+
+	fileInfo, err := fs.Stat(fileSystem, fileSystemPath)
+	if err == nil && fileInfo.ModTime().Equal(lastModified) {
+		return false
+	}
+
+	c.DeleteFile(fileName)
+	return true
 }
 
 func (fs *DocumentCache) Open(ctx context.Context, filePath string) (fs.File, error) {
@@ -62,32 +225,51 @@ func (fs *DocumentCache) Open(ctx context.Context, filePath string) (fs.File, er
 	)
 
 	fileContent, ok := fs.GetFile(filePath)
+	lastModified, _ := fs.LastModified(filePath)
 	if !ok {
-		file, err := fs.workspace.Open(filePath)
+		fileSystem, _, fileSystemPath, ok := fs.fileSystemFor(filePath)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is outside of the workspace %s", ErrFileNotFound, filePath, fs.root)
+		}
+
+		file, err := fileSystem.Open(fileSystemPath)
 		if err != nil {
 			return nil, fmt.Errorf("%w: %w", ErrFileNotFound, err)
 		}
 
+		defer file.Close()
+
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat file: %w", err)
+		}
+
 		rawFileContent, err := io.ReadAll(file)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read file: %w", err)
 		}
 
 		fileContent = string(rawFileContent)
+		lastModified = fileInfo.ModTime()
 
-		fs.SetFile(filePath, fileContent)
+		fs.setFile(filePath, fileContent, lastModified, false)
 	}
+	stats := fs.Stats()
 	span.SetAttributes(
 		attribute.Bool("documentcache.hit", ok),
 		attribute.Int("documentcache.foundFileSize", len(fileContent)),
+		attribute.Int("documentcache.hitCount", stats.Hits),
+		attribute.Int("documentcache.missCount", stats.Misses),
+		attribute.Int("documentcache.evictionCount", stats.Evictions),
+		attribute.Int("documentcache.fileCount", stats.Entries),
+		attribute.Int("documentcache.byteCount", stats.Bytes),
 	)
 
 	return &documentCacheFile{
-		Buffer:      bytes.NewBuffer([]byte(fileContent)),
-		fileContent: fileContent,
-		fileName:    filePath,
-		// TODO: track last modified time
-		lastModified: time.Unix(0, 0),
+		Buffer:       bytes.NewBuffer([]byte(fileContent)),
+		fileContent:  fileContent,
+		fileName:     filePath,
+		lastModified: lastModified,
 	}, nil
 }
 
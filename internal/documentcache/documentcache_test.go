@@ -8,62 +8,191 @@ import (
 	"time"
 
 	"github.com/alecthomas/assert/v2"
+
+	"github.com/yeldirium/hledger-language-server/internal/lru"
 )
 
 func TestCache(t *testing.T) {
 	t.Run("can add and retrieve files.", func(t *testing.T) {
-		cache := NewCache(fstest.MapFS{})
-		cache.SetFile("tmp/foo.txt", "file content")
+		cache := NewCache("/", fstest.MapFS{})
+		cache.SetFile("/tmp/foo.txt", "file content")
 
-		content, ok := cache.GetFile("tmp/foo.txt")
+		content, ok := cache.GetFile("/tmp/foo.txt")
 
 		assert.True(t, ok)
 		assert.Equal(t, "file content", content)
 	})
 
 	t.Run("returns w/e, false for files that are not cached.", func(t *testing.T) {
-		cache := NewCache(fstest.MapFS{})
+		cache := NewCache("/", fstest.MapFS{})
 
-		_, ok := cache.GetFile("tmp/doesnt-exist")
+		_, ok := cache.GetFile("/tmp/doesnt-exist")
 
 		assert.False(t, ok)
 	})
 
 	t.Run("can overwrite a cached file.", func(t *testing.T) {
-		cache := NewCache(fstest.MapFS{})
-		cache.SetFile("tmp/foo.txt", "file content")
-		cache.SetFile("tmp/foo.txt", "file content overwritten")
+		cache := NewCache("/", fstest.MapFS{})
+		cache.SetFile("/tmp/foo.txt", "file content")
+		cache.SetFile("/tmp/foo.txt", "file content overwritten")
 
-		content, ok := cache.GetFile("tmp/foo.txt")
+		content, ok := cache.GetFile("/tmp/foo.txt")
 
 		assert.True(t, ok)
 		assert.Equal(t, "file content overwritten", content)
 	})
 
 	t.Run("can delete a cached file.", func(t *testing.T) {
-		cache := NewCache(fstest.MapFS{})
-		cache.SetFile("tmp/foo.txt", "file content")
-		cache.DeleteFile("tmp/foo.txt")
+		cache := NewCache("/", fstest.MapFS{})
+		cache.SetFile("/tmp/foo.txt", "file content")
+		cache.DeleteFile("/tmp/foo.txt")
 
-		_, ok := cache.GetFile("tmp/foo.txt")
+		_, ok := cache.GetFile("/tmp/foo.txt")
 
 		assert.False(t, ok)
 	})
 
+	t.Run("Glob", func(t *testing.T) {
+		t.Run("returns matching files from the workspace and the cache, sorted.", func(t *testing.T) {
+			cache := NewCache("/", fstest.MapFS{
+				"tmp/2024.journal": &fstest.MapFile{},
+				"tmp/2023.journal": &fstest.MapFile{},
+				"tmp/notes.txt":    &fstest.MapFile{},
+			})
+			cache.SetFile("/tmp/2025.journal", "not saved yet")
+			cache.SetFile("/tmp/2024.journal", "edited")
+
+			matches, err := cache.Glob("/tmp/*.journal")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/tmp/2023.journal", "/tmp/2024.journal", "/tmp/2025.journal"}, matches)
+		})
+
+		t.Run("matches any number of directories with **.", func(t *testing.T) {
+			cache := NewCache("/", fstest.MapFS{
+				"tmp/main.journal":             &fstest.MapFile{},
+				"tmp/2024/01.journal":          &fstest.MapFile{},
+				"tmp/2024/receipts/01.journal": &fstest.MapFile{},
+				"tmp/2024/receipts/scan.pdf":   &fstest.MapFile{},
+				"other/2024/somewhere.journal": &fstest.MapFile{},
+			})
+			cache.SetFile("/tmp/2025/01.journal", "not saved yet")
+
+			matches, err := cache.Glob("/tmp/**/*.journal")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{
+				"/tmp/2024/01.journal",
+				"/tmp/2024/receipts/01.journal",
+				"/tmp/2025/01.journal",
+				"/tmp/main.journal",
+			}, matches)
+		})
+
+		t.Run("returns absolute paths for workspaces rooted at a folder.", func(t *testing.T) {
+			cache := NewCache("/home/user/ledger", fstest.MapFS{
+				"2024/01.journal": &fstest.MapFile{},
+			})
+
+			matches, err := cache.Glob("/home/user/ledger/**/*.journal")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/home/user/ledger/2024/01.journal"}, matches)
+		})
+
+		t.Run("leaves out directories.", func(t *testing.T) {
+			cache := NewCache("/", fstest.MapFS{
+				"tmp/2024/01.journal":          &fstest.MapFile{},
+				"tmp/2024/02.journal":          &fstest.MapFile{},
+				"tmp/2024/receipts/01.journal": &fstest.MapFile{},
+			})
+
+			matches, err := cache.Glob("/tmp/2024/*")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/tmp/2024/01.journal", "/tmp/2024/02.journal"}, matches)
+		})
+
+		t.Run("returns literal paths only if the file exists.", func(t *testing.T) {
+			cache := NewCache("/", fstest.MapFS{
+				"tmp/2024.journal": &fstest.MapFile{},
+			})
+
+			matches, err := cache.Glob("/tmp/2024.journal")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/tmp/2024.journal"}, matches)
+
+			matches, err = cache.Glob("/tmp/2023.journal")
+			assert.NoError(t, err)
+			assert.Equal(t, 0, len(matches))
+		})
+	})
+
+	t.Run("Files", func(t *testing.T) {
+		t.Run("returns the paths of all cached documents, sorted.", func(t *testing.T) {
+			cache := NewCache("/", fstest.MapFS{})
+			cache.SetFile("/tmp/foo.txt", "file content")
+			cache.SetFile("/tmp/bar.txt", "file content")
+
+			assert.Equal(t, []string{"/tmp/bar.txt", "/tmp/foo.txt"}, cache.Files())
+		})
+	})
+
 	t.Run("Open", func(t *testing.T) {
 		t.Run("fails if the file is neither in the cache nor can be found in the workspace", func(t *testing.T) {
-			cache := NewCache(fstest.MapFS{})
+			cache := NewCache("/", fstest.MapFS{})
+
+			_, err := cache.Open(context.Background(), "/tmp/foo.txt")
+
+			assert.IsError(t, err, ErrFileNotFound)
+		})
+
+		t.Run("reads files relative to the workspace folder and fails for files outside of it.", func(t *testing.T) {
+			cache := NewCache("/home/user/ledger", fstest.MapFS{
+				"2024.journal": &fstest.MapFile{
+					Data: []byte("file content"),
+				},
+			})
 
-			_, err := cache.Open(context.Background(), "tmp/foo.txt")
+			file, err := cache.Open(context.Background(), "/home/user/ledger/2024.journal")
+			assert.NoError(t, err)
+			fileContent, err := io.ReadAll(file)
+			assert.NoError(t, err)
+			assert.Equal(t, "file content", string(fileContent))
 
+			_, err = cache.Open(context.Background(), "/home/user/ledger-backup/2024.journal")
 			assert.IsError(t, err, ErrFileNotFound)
+
+			assert.True(t, cache.Contains("/home/user/ledger/2024.journal"))
+			assert.False(t, cache.Contains("/home/user/other.journal"))
+		})
+
+		t.Run("reads files outside of the workspace folder through the outside file system.", func(t *testing.T) {
+			cache := NewCache("/home/user/ledger", fstest.MapFS{})
+			cache.SetOutsideFS(fstest.MapFS{
+				"home/user/common.journal": &fstest.MapFile{
+					Data: []byte("file content"),
+				},
+			})
+
+			file, err := cache.Open(context.Background(), "/home/user/common.journal")
+			assert.NoError(t, err)
+			fileContent, err := io.ReadAll(file)
+			assert.NoError(t, err)
+			assert.Equal(t, "file content", string(fileContent))
+
+			matches, err := cache.Glob("/home/user/*.journal")
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/home/user/common.journal"}, matches)
+
+			assert.False(t, cache.Contains("/home/user/common.journal"))
 		})
 
 		t.Run("returns a file from the cache.", func(t *testing.T) {
-			cache := NewCache(fstest.MapFS{})
-			cache.SetFile("tmp/foo.txt", "file content")
+			cache := NewCache("/", fstest.MapFS{})
+			cache.SetFile("/tmp/foo.txt", "file content")
 
-			file, err := cache.Open(context.Background(), "tmp/foo.txt")
+			file, err := cache.Open(context.Background(), "/tmp/foo.txt")
 
 			assert.NoError(t, err)
 
@@ -73,18 +202,18 @@ func TestCache(t *testing.T) {
 
 			fileInfo, err := file.Stat()
 			assert.NoError(t, err)
-			assert.Equal(t, "tmp/foo.txt", fileInfo.Name())
+			assert.Equal(t, "/tmp/foo.txt", fileInfo.Name())
 			assert.Equal(t, 12, fileInfo.Size())
 		})
 
 		t.Run("reads a file from the workspace FS if it is not found in the cache, then adds it to the cache.", func(t *testing.T) {
-			cache := NewCache(fstest.MapFS{
+			cache := NewCache("/", fstest.MapFS{
 				"tmp/foo.txt": &fstest.MapFile{
 					Data: []byte("file content"),
 				},
 			})
 
-			file, err := cache.Open(context.Background(), "tmp/foo.txt")
+			file, err := cache.Open(context.Background(), "/tmp/foo.txt")
 
 			assert.NoError(t, err)
 
@@ -94,20 +223,110 @@ func TestCache(t *testing.T) {
 
 			fileInfo, err := file.Stat()
 			assert.NoError(t, err)
-			assert.Equal(t, "tmp/foo.txt", fileInfo.Name())
+			assert.Equal(t, "/tmp/foo.txt", fileInfo.Name())
 			assert.Equal(t, 12, fileInfo.Size())
 
-			_, ok := cache.GetFile("tmp/foo.txt")
+			_, ok := cache.GetFile("/tmp/foo.txt")
 			assert.True(t, ok)
 		})
 
-		t.Run("does not yet track the last modified time of cached documents.", func(t *testing.T) {
-			cache := NewCache(fstest.MapFS{})
-			cache.SetFile("tmp/foo.txt", "file content")
+		t.Run("tracks the time documents set in the cache were last modified.", func(t *testing.T) {
+			cache := NewCache("/", fstest.MapFS{})
+			before := time.Now()
+			cache.SetFile("/tmp/foo.txt", "file content")
+
+			file, _ := cache.Open(context.Background(), "/tmp/foo.txt")
+			fileInfo, _ := file.Stat()
+			assert.False(t, fileInfo.ModTime().Before(before))
+		})
+
+		t.Run("tracks the time documents read from the workspace were last modified.", func(t *testing.T) {
+			modTime := time.Date(2024, 11, 25, 12, 0, 0, 0, time.UTC)
+			cache := NewCache("/", fstest.MapFS{
+				"tmp/foo.txt": &fstest.MapFile{Data: []byte("file content"), ModTime: modTime},
+			})
 
-			file, _ := cache.Open(context.Background(), "tmp/foo.txt")
+			file, _ := cache.Open(context.Background(), "/tmp/foo.txt")
 			fileInfo, _ := file.Stat()
-			assert.Equal(t, time.Unix(0, 0), fileInfo.ModTime())
+			assert.Equal(t, modTime, fileInfo.ModTime())
+
+			lastModified, ok := cache.LastModified("/tmp/foo.txt")
+			assert.True(t, ok)
+			assert.Equal(t, modTime, lastModified)
+		})
+	})
+
+	t.Run("SetLimits", func(t *testing.T) {
+		t.Run("evicts the least recently used documents read from the workspace, but never documents set in the cache.", func(t *testing.T) {
+			cache := NewCache("/", fstest.MapFS{
+				"tmp/a.journal": &fstest.MapFile{Data: []byte("a")},
+				"tmp/b.journal": &fstest.MapFile{Data: []byte("b")},
+			})
+			cache.SetLimits(lru.Limits{MaxEntries: 1})
+			cache.SetFile("/tmp/open.journal", "open")
+
+			_, _ = cache.Open(context.Background(), "/tmp/a.journal")
+			_, _ = cache.Open(context.Background(), "/tmp/b.journal")
+
+			assert.Equal(t, []string{"/tmp/open.journal"}, cache.Files())
+			assert.Equal(t, lru.Stats{Misses: 2, Evictions: 2, Entries: 1, Bytes: 4}, cache.Stats())
+
+			_, err := cache.Open(context.Background(), "/tmp/a.journal")
+			assert.NoError(t, err)
+			_, err = cache.Open(context.Background(), "/tmp/open.journal")
+			assert.NoError(t, err)
+			assert.Equal(t, 1, cache.Stats().Hits)
+		})
+	})
+
+	t.Run("Refresh", func(t *testing.T) {
+		modTime := time.Date(2024, 11, 25, 12, 0, 0, 0, time.UTC)
+
+		t.Run("keeps documents that were not modified on disk.", func(t *testing.T) {
+			workspace := fstest.MapFS{
+				"tmp/foo.txt": &fstest.MapFile{Data: []byte("file content"), ModTime: modTime},
+			}
+			cache := NewCache("/", workspace)
+			_, _ = cache.Open(context.Background(), "/tmp/foo.txt")
+
+			assert.False(t, cache.Refresh("/tmp/foo.txt"))
+			_, ok := cache.GetFile("/tmp/foo.txt")
+			assert.True(t, ok)
+		})
+
+		t.Run("drops documents that were modified on disk, so that they are read again.", func(t *testing.T) {
+			workspace := fstest.MapFS{
+				"tmp/foo.txt": &fstest.MapFile{Data: []byte("file content"), ModTime: modTime},
+			}
+			cache := NewCache("/", workspace)
+			_, _ = cache.Open(context.Background(), "/tmp/foo.txt")
+			workspace["tmp/foo.txt"] = &fstest.MapFile{Data: []byte("new file content"), ModTime: modTime.Add(time.Minute)}
+
+			assert.True(t, cache.Refresh("/tmp/foo.txt"))
+
+			file, err := cache.Open(context.Background(), "/tmp/foo.txt")
+			assert.NoError(t, err)
+			content, _ := io.ReadAll(file)
+			assert.Equal(t, "new file content", string(content))
+		})
+
+		t.Run("drops documents that were deleted on disk.", func(t *testing.T) {
+			workspace := fstest.MapFS{
+				"tmp/foo.txt": &fstest.MapFile{Data: []byte("file content"), ModTime: modTime},
+			}
+			cache := NewCache("/", workspace)
+			_, _ = cache.Open(context.Background(), "/tmp/foo.txt")
+			delete(workspace, "tmp/foo.txt")
+
+			assert.True(t, cache.Refresh("/tmp/foo.txt"))
+			_, ok := cache.GetFile("/tmp/foo.txt")
+			assert.False(t, ok)
+		})
+
+		t.Run("ignores documents that are not cached.", func(t *testing.T) {
+			cache := NewCache("/", fstest.MapFS{})
+
+			assert.False(t, cache.Refresh("/tmp/foo.txt"))
 		})
 	})
 }
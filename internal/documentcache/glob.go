@@ -0,0 +1,118 @@
+package documentcache
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Glob returns the absolute paths of all files in the workspace or the cache
+// that match the absolute pattern, sorted. Like in hledger, directories are
+// left out. The pattern syntax is the one of path.Match, extended by `**`,
+// which matches any number of directories.
+func (c *DocumentCache) Glob(pattern string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	matches := make([]string, 0)
+	if fileSystem, root, fileSystemPattern, ok := c.fileSystemFor(pattern); ok {
+		var fileSystemMatches []string
+		var err error
+		if slices.Contains(strings.Split(fileSystemPattern, "/"), "**") {
+			fileSystemMatches, err = globRecursive(fileSystem, fileSystemPattern)
+		} else {
+			fileSystemMatches, err = fs.Glob(fileSystem, fileSystemPattern)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fileSystemMatch := range fileSystemMatches {
+			if fileInfo, err := fs.Stat(fileSystem, fileSystemMatch); err == nil && fileInfo.IsDir() {
+				continue
+			}
+			matches = append(matches, path.Join(root, fileSystemMatch))
+		}
+	}
+
+	c.RLock()
+	for _, fileName := range c.files.Keys() {
+		if matchGlob(pattern, fileName) && !slices.Contains(matches, fileName) {
+			matches = append(matches, fileName)
+		}
+	}
+	c.RUnlock()
+
+	slices.Sort(matches)
+	return matches, nil
+}
+
+// globRecursive walks the directory that the static part of the pattern
+// points to and collects all files matching the pattern. Pattern and matches
+// are paths of the file system.
+func globRecursive(fileSystem fs.FS, pattern string) ([]string, error) {
+	segments := strings.Split(pattern, "/")
+	staticSegments := 0
+	for staticSegments < len(segments) && !hasMeta(segments[staticSegments]) {
+		staticSegments++
+	}
+	root := path.Join(segments[:staticSegments]...)
+	if root == "" {
+		root = "."
+	}
+
+	matches := make([]string, 0)
+	err := fs.WalkDir(fileSystem, root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+				return nil
+			}
+			return err
+		}
+		if !entry.IsDir() && matchGlob(pattern, filePath) {
+			matches = append(matches, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// matchGlob reports whether the file name matches the pattern, segment by
+// segment. A `**` segment matches any number of segments.
+func matchGlob(pattern string, fileName string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(fileName, "/"))
+}
+
+func matchSegments(patternSegments []string, nameSegments []string) bool {
+	if len(patternSegments) == 0 {
+		return len(nameSegments) == 0
+	}
+
+	if patternSegments[0] == "**" {
+		for skipped := 0; skipped <= len(nameSegments); skipped++ {
+			if matchSegments(patternSegments[1:], nameSegments[skipped:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(nameSegments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(patternSegments[0], nameSegments[0]); !ok {
+		return false
+	}
+	return matchSegments(patternSegments[1:], nameSegments[1:])
+}
+
+func hasMeta(segment string) bool {
+	return strings.ContainsAny(segment, `*?[\`)
+}
@@ -0,0 +1,131 @@
+// Package journalgen generates synthetic journals for benchmarks. The journals
+// only depend on the options, so that results of different runs can be
+// compared.
+package journalgen
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// RootJournal is the name of the journal that includes all other generated
+// journals.
+const RootJournal = "main.journal"
+
+// AccountsJournal is the name of the journal declaring the accounts.
+const AccountsJournal = "accounts.journal"
+
+var topLevelAccounts = []string{"assets", "liabilities", "equity", "income", "expenses"}
+
+type Options struct {
+	// Accounts is the number of distinct accounts the transactions post to.
+	// They are declared in AccountsJournal.
+	Accounts int
+	// Transactions is the number of transactions across all journals.
+	Transactions int
+	// Includes is the number of journals, besides AccountsJournal, that the
+	// root journal includes. The transactions are spread evenly over them and
+	// the root journal.
+	Includes int
+	// Seed determines the amounts, payees and accounts of the transactions.
+	Seed uint64
+}
+
+// DefaultOptions describe a journal of a few years of personal finances.
+var DefaultOptions = Options{
+	Accounts:     200,
+	Transactions: 10000,
+	Includes:     5,
+	Seed:         1,
+}
+
+// IncludedJournal returns the name of the included journal with the given
+// index, starting at 0.
+func IncludedJournal(index int) string {
+	return fmt.Sprintf("transactions-%d.journal", index+1)
+}
+
+// AccountName returns the name of the account with the given index, starting
+// at 0. Accounts are spread over the top level accounts and share categories,
+// so that they have common prefixes.
+func AccountName(index int) string {
+	return fmt.Sprintf(
+		"%s:Category%d:Account%d",
+		topLevelAccounts[index%len(topLevelAccounts)],
+		index/len(topLevelAccounts)%10,
+		index,
+	)
+}
+
+// Generate returns the contents of the journals by their file names.
+func Generate(options Options) map[string]string {
+	random := rand.New(rand.NewPCG(options.Seed, options.Seed))
+	accountCount := max(options.Accounts, 2)
+
+	journals := make(map[string]string)
+
+	var root strings.Builder
+	root.WriteString("; Generated synthetic journal.\n")
+	fmt.Fprintf(&root, "include %s\n", AccountsJournal)
+	for i := range options.Includes {
+		fmt.Fprintf(&root, "include %s\n", IncludedJournal(i))
+	}
+	root.WriteString("\n")
+
+	var accounts strings.Builder
+	for i := range accountCount {
+		fmt.Fprintf(&accounts, "account %s\n", AccountName(i))
+	}
+	journals[AccountsJournal] = accounts.String()
+
+	journalCount := options.Includes + 1
+	for i := range journalCount {
+		var journal strings.Builder
+		if i == 0 {
+			journal.WriteString(root.String())
+		}
+
+		// The root journal takes the transactions that do not divide evenly.
+		transactionCount := options.Transactions / journalCount
+		if i == 0 {
+			transactionCount += options.Transactions % journalCount
+		}
+		for range transactionCount {
+			writeTransaction(&journal, random, accountCount)
+		}
+
+		if i == 0 {
+			journals[RootJournal] = journal.String()
+		} else {
+			journals[IncludedJournal(i-1)] = journal.String()
+		}
+	}
+
+	return journals
+}
+
+func writeTransaction(journal *strings.Builder, random *rand.Rand, accountCount int) {
+	fmt.Fprintf(
+		journal,
+		"2024-%02d-%02d Payee %d  ; generated\n",
+		random.IntN(12)+1,
+		random.IntN(28)+1,
+		random.IntN(1000),
+	)
+
+	postingCount := random.IntN(3) + 2
+	for i := range postingCount {
+		account := AccountName(random.IntN(accountCount))
+		switch {
+		case i == postingCount-1:
+			// The last posting balances the transaction.
+			fmt.Fprintf(journal, "    %s\n", account)
+		case random.IntN(10) == 0:
+			fmt.Fprintf(journal, "    (%s)  %d,%02d €\n", account, random.IntN(1000), random.IntN(100))
+		default:
+			fmt.Fprintf(journal, "    %s  %d,%02d €  ; posting\n", account, random.IntN(1000), random.IntN(100))
+		}
+	}
+	journal.WriteString("\n")
+}
@@ -0,0 +1,43 @@
+package journalgen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+func TestGenerate(t *testing.T) {
+	options := Options{Accounts: 20, Transactions: 101, Includes: 3, Seed: 1}
+
+	t.Run("generates the root journal, the accounts journal and the included journals.", func(t *testing.T) {
+		journals := Generate(options)
+
+		assert.Equal(t, 5, len(journals))
+		for _, fileName := range []string{AccountsJournal, IncludedJournal(0), IncludedJournal(1), IncludedJournal(2)} {
+			assert.Contains(t, journals[RootJournal], "include "+fileName+"\n")
+		}
+	})
+
+	t.Run("generates journals that parse and contain all transactions and accounts.", func(t *testing.T) {
+		parser := ledger.NewJournalParser()
+		transactionCount := 0
+		for fileName, content := range Generate(options) {
+			journal, err := parser.ParseString(fileName, content)
+			assert.NoError(t, err)
+
+			if fileName == AccountsJournal {
+				assert.Equal(t, options.Accounts, len(journal.Entries))
+			}
+			transactionCount += strings.Count(content, "Payee")
+		}
+		assert.Equal(t, options.Transactions, transactionCount)
+	})
+
+	t.Run("generates the same journals for the same options.", func(t *testing.T) {
+		assert.Equal(t, Generate(options), Generate(options))
+		assert.NotEqual(t, Generate(options), Generate(Options{Accounts: 20, Transactions: 101, Includes: 3, Seed: 2}))
+	})
+}
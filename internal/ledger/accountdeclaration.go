@@ -0,0 +1,98 @@
+package ledger
+
+import (
+	"fmt"
+	"strings"
+)
+
+// UndeclaredAccountNames returns the account names of all postings whose
+// account is not declared by an account directive anywhere in the journal, in
+// the order they appear in.
+func UndeclaredAccountNames(journal *Journal) []*AccountName {
+	declared := make(map[string]bool)
+	for _, entry := range journal.Entries {
+		if directive, ok := entry.(*AccountDirective); ok && directive.AccountName != nil {
+			declared[directive.AccountName.String()] = true
+		}
+	}
+
+	undeclared := make([]*AccountName, 0)
+	for _, entry := range journal.Entries {
+		posting, ok := entry.(Posting)
+		if !ok || posting.Account() == nil {
+			continue
+		}
+		if !declared[posting.Account().String()] {
+			undeclared = append(undeclared, posting.Account())
+		}
+	}
+
+	return undeclared
+}
+
+// AccountDeclaration describes where an account directive should be inserted.
+type AccountDeclaration struct {
+	FileName string
+	// Line is the 1-based line that the directive is inserted in front of. It
+	// is one past the last line of the file if the directive goes to the end.
+	Line int
+	Text string
+}
+
+// DeclareAccount finds the place for an account directive declaring the given
+// account. It goes into the file of the journal that holds the most account
+// directives, in front of the first directive that sorts after it. If the
+// journal has no account directives, it goes to the top of the fallback file.
+func DeclareAccount(journal *Journal, accountName string, fallbackFileName string) AccountDeclaration {
+	declaration := AccountDeclaration{
+		FileName: fallbackFileName,
+		Line:     1,
+		Text:     fmt.Sprintf("account %s", accountName),
+	}
+
+	directivesByFile := make(map[string][]*AccountDirective)
+	for _, entry := range journal.Entries {
+		if directive, ok := entry.(*AccountDirective); ok && directive.AccountName != nil {
+			fileName := directive.AccountName.Pos.Filename
+			directivesByFile[fileName] = append(directivesByFile[fileName], directive)
+		}
+	}
+
+	var directives []*AccountDirective
+	for _, entry := range journal.Entries {
+		directive, ok := entry.(*AccountDirective)
+		if !ok || directive.AccountName == nil {
+			continue
+		}
+		fileName := directive.AccountName.Pos.Filename
+		if len(directivesByFile[fileName]) > len(directives) {
+			declaration.FileName = fileName
+			directives = directivesByFile[fileName]
+		}
+	}
+
+	for _, directive := range directives {
+		if strings.Compare(directive.AccountName.String(), accountName) > 0 {
+			declaration.Line = directive.AccountName.Pos.Line
+			return declaration
+		}
+		declaration.Line = directive.AccountName.Pos.Line + 1
+	}
+
+	return declaration
+}
+
+// SkipIndentedLines moves the declaration past the indented lines at its line
+// in the given lines of its file. These are the comments and subdirectives of
+// the preceding account directive, which would otherwise belong to the
+// inserted one.
+func (declaration AccountDeclaration) SkipIndentedLines(lines []string) AccountDeclaration {
+	for declaration.Line <= len(lines) {
+		line := lines[declaration.Line-1]
+		if strings.TrimSpace(line) == "" || !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			break
+		}
+		declaration.Line += 1
+	}
+	return declaration
+}
@@ -0,0 +1,96 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUndeclaredAccountNames(t *testing.T) {
+	t.Run("returns the accounts of postings without an account directive.", func(t *testing.T) {
+		journal := parseTestJournal(t, `account assets:Cash
+
+2024-11-25 Payee
+    expenses:Groceries  10 €
+    assets:Cash
+    (budget:Food)  -10 €
+`)
+
+		undeclared := UndeclaredAccountNames(journal)
+
+		assert.Len(t, undeclared, 2)
+		assert.Equal(t, "expenses:Groceries", undeclared[0].String())
+		assert.Equal(t, 4, undeclared[0].Pos.Line)
+		assert.Equal(t, "budget:Food", undeclared[1].String())
+	})
+}
+
+func TestDeclareAccount(t *testing.T) {
+	journal := func(t *testing.T) *Journal {
+		t.Helper()
+
+		accounts := parseTestJournal(t, `account assets:Cash
+account expenses:Rent
+`)
+		accounts.Entries[0].(*AccountDirective).AccountName.Pos.Filename = "accounts.journal"
+		accounts.Entries[1].(*AccountDirective).AccountName.Pos.Filename = "accounts.journal"
+
+		main := parseTestJournal(t, `account zzz
+
+2024-11-25 Payee
+    expenses:Groceries  10 €
+    assets:Cash
+`)
+
+		main.Entries = append(main.Entries, accounts.Entries...)
+		return main
+	}
+
+	t.Run("inserts the directive in sorted position in the file with the most account directives.", func(t *testing.T) {
+		declaration := DeclareAccount(journal(t), "expenses:Groceries", "test.journal")
+
+		assert.Equal(t, AccountDeclaration{
+			FileName: "accounts.journal",
+			Line:     2,
+			Text:     "account expenses:Groceries",
+		}, declaration)
+	})
+
+	t.Run("inserts the directive after the last directive if it sorts last.", func(t *testing.T) {
+		declaration := DeclareAccount(journal(t), "income:Salary", "test.journal")
+
+		assert.Equal(t, AccountDeclaration{
+			FileName: "accounts.journal",
+			Line:     3,
+			Text:     "account income:Salary",
+		}, declaration)
+	})
+
+	t.Run("inserts the directive at the top of the fallback file if there are no directives.", func(t *testing.T) {
+		declaration := DeclareAccount(parseTestJournal(t, "2024-11-25 Payee\n    assets:Cash\n"), "assets:Cash", "test.journal")
+
+		assert.Equal(t, AccountDeclaration{
+			FileName: "test.journal",
+			Line:     1,
+			Text:     "account assets:Cash",
+		}, declaration)
+	})
+	t.Run("inserts the directive after the comments and subdirectives of the preceding directive.", func(t *testing.T) {
+		lines := strings.Split("account assets:Bank\n  ; type: A\n\taccount-note\n\n2024-11-25 Payee\n", "\n")
+		declaration := AccountDeclaration{FileName: "test.journal", Line: 2, Text: "account assets:Cash"}
+
+		assert.Equal(t, AccountDeclaration{
+			FileName: "test.journal",
+			Line:     4,
+			Text:     "account assets:Cash",
+		}, declaration.SkipIndentedLines(lines))
+	})
+
+	t.Run("keeps the line of a declaration in front of a directive.", func(t *testing.T) {
+		lines := strings.Split("account assets:Bank\n  ; type: A\naccount expenses\n", "\n")
+		declaration := AccountDeclaration{FileName: "test.journal", Line: 3, Text: "account assets:Cash"}
+
+		assert.Equal(t, declaration, declaration.SkipIndentedLines(lines))
+	})
+}
@@ -0,0 +1,502 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrInvalidAmount = errors.New("invalid amount")
+)
+
+// AmountStyle describes how an amount was written, so that amounts computed
+// from it can be written the same way.
+type AmountStyle struct {
+	CommodityOnLeft bool
+	CommoditySpaced bool
+	// DecimalMark is 0 if the amount was written without decimal places.
+	DecimalMark rune
+	// DigitGroupMark is 0 if the amount was written without digit groups.
+	DigitGroupMark rune
+	Precision      int
+}
+
+// Amount is a quantity of a single commodity, e.g. `-1,234.56 €` or `$100`.
+type Amount struct {
+	Quantity  *big.Rat
+	Commodity string
+	Style     AmountStyle
+}
+
+// ParseAmount parses a single amount with an optional commodity symbol on
+// either side of the quantity.
+//
+// Like hledger without commodity directives, a number containing a single
+// period or comma treats it as the decimal mark, even if exactly three digits
+// follow it.
+func ParseAmount(text string) (*Amount, error) {
+	scanner := amountScanner{input: strings.TrimSpace(text)}
+	amount, err := scanner.scanAmount()
+	if err != nil {
+		return nil, err
+	}
+	if scanner.offset != len(scanner.input) {
+		return nil, fmt.Errorf("%w: unexpected %q in %q", ErrInvalidAmount, scanner.input[scanner.offset:], text)
+	}
+
+	return amount, nil
+}
+
+// String writes the amount using its style.
+func (amount Amount) String() string {
+	return amount.Style.Format(amount.Quantity, amount.Commodity)
+}
+
+// Format writes the quantity and commodity using the style. Quantities with
+// more decimal places than the style's precision are rounded.
+func (style AmountStyle) Format(quantity *big.Rat, commodity string) string {
+	precision := style.Precision
+	if precision < 0 {
+		precision = 0
+	}
+
+	number := quantity.FloatString(precision)
+	isNegative := strings.HasPrefix(number, "-")
+	number = strings.TrimPrefix(number, "-")
+
+	integerPart, fractionalPart, _ := strings.Cut(number, ".")
+	if style.DigitGroupMark != 0 {
+		integerPart = groupDigits(integerPart, style.DigitGroupMark)
+	}
+
+	var builder strings.Builder
+	if commodity != "" && style.CommodityOnLeft {
+		builder.WriteString(quoteCommodity(commodity))
+		if style.CommoditySpaced {
+			builder.WriteRune(' ')
+		}
+	}
+	if isNegative {
+		builder.WriteRune('-')
+	}
+	builder.WriteString(integerPart)
+	if fractionalPart != "" {
+		decimalMark := style.DecimalMark
+		if decimalMark == 0 {
+			decimalMark = '.'
+		}
+		builder.WriteRune(decimalMark)
+		builder.WriteString(fractionalPart)
+	}
+	if commodity != "" && !style.CommodityOnLeft {
+		if style.CommoditySpaced {
+			builder.WriteRune(' ')
+		}
+		builder.WriteString(quoteCommodity(commodity))
+	}
+
+	return builder.String()
+}
+
+func groupDigits(digits string, groupMark rune) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+
+	var builder strings.Builder
+	firstGroupLength := len(digits) % 3
+	if firstGroupLength == 0 {
+		firstGroupLength = 3
+	}
+	builder.WriteString(digits[:firstGroupLength])
+	for i := firstGroupLength; i < len(digits); i += 3 {
+		builder.WriteRune(groupMark)
+		builder.WriteString(digits[i : i+3])
+	}
+
+	return builder.String()
+}
+
+func quoteCommodity(commodity string) string {
+	if strings.ContainsFunc(commodity, func(r rune) bool {
+		return !isCommodityRune(r)
+	}) {
+		return fmt.Sprintf("%q", commodity)
+	}
+	return commodity
+}
+
+// PostingAmount is everything that can follow the account name of a posting:
+// an amount, an optional cost and an optional balance assertion. Each part may
+// be missing, e.g. a posting may only contain a balance assertion.
+type PostingAmount struct {
+	Amount    *Amount
+	Cost      *Amount
+	TotalCost bool
+	Assertion *Amount
+	// InclusiveAssertion is set for assertions like `=*` and `==*`, which
+	// include the balances of subaccounts.
+	InclusiveAssertion bool
+	// TotalAssertion is set for assertions like `==` and `==*`, which also
+	// assert that the balance holds no other commodity.
+	TotalAssertion bool
+}
+
+// ParsePostingAmount parses the text of a posting amount, e.g.
+// `-10 BTC @ 1,234.50 €` or `= 15 €`.
+func ParsePostingAmount(text string) (PostingAmount, error) {
+	result := PostingAmount{}
+
+	text, err := removeLotAnnotations(text)
+	if err != nil {
+		return PostingAmount{}, err
+	}
+
+	amountText, assertionText, hasAssertion := strings.Cut(text, "=")
+	if hasAssertion {
+		operator := assertionText[:len(assertionText)-len(strings.TrimLeft(assertionText, "=*"))]
+		result.InclusiveAssertion = strings.Contains(operator, "*")
+		result.TotalAssertion = strings.HasPrefix(operator, "=")
+		assertionText = assertionText[len(operator):]
+		assertion, err := ParseAmount(assertionText)
+		if err != nil {
+			return PostingAmount{}, err
+		}
+		result.Assertion = assertion
+	}
+
+	amountText, costText, hasCost := strings.Cut(amountText, "@")
+	if hasCost {
+		if strings.HasPrefix(costText, "@") {
+			costText = costText[1:]
+			result.TotalCost = true
+		}
+		cost, err := ParseAmount(costText)
+		if err != nil {
+			return PostingAmount{}, err
+		}
+		result.Cost = cost
+	}
+
+	if strings.TrimSpace(amountText) != "" {
+		amount, err := ParseAmount(amountText)
+		if err != nil {
+			return PostingAmount{}, err
+		}
+		result.Amount = amount
+	} else if hasCost {
+		return PostingAmount{}, fmt.Errorf("%w: cost without an amount in %q", ErrInvalidAmount, text)
+	}
+
+	return result, nil
+}
+
+// removeLotAnnotations removes the lot price `{…}` or `{{…}}` and the lot
+// date `[…]` following an amount. Like hledger, they do not count for
+// balancing, only costs written with `@` do.
+func removeLotAnnotations(text string) (string, error) {
+	var builder strings.Builder
+	inQuotes := false
+	for offset := 0; offset < len(text); offset++ {
+		character := text[offset]
+		if character == '"' {
+			inQuotes = !inQuotes
+		}
+		if inQuotes || (character != '{' && character != '[') {
+			builder.WriteByte(character)
+			continue
+		}
+
+		closing := "]"
+		if character == '{' {
+			closing = "}"
+			if strings.HasPrefix(text[offset:], "{{") {
+				closing = "}}"
+			}
+		}
+		end := strings.Index(text[offset:], closing)
+		if end < 0 {
+			return "", fmt.Errorf("%w: missing %q in %q", ErrInvalidAmount, closing, text)
+		}
+		offset += end + len(closing) - 1
+		builder.WriteByte(' ')
+	}
+	return builder.String(), nil
+}
+
+// IsEmpty reports whether the posting has neither an amount nor a balance
+// assignment, in which case hledger infers its amount from the other postings
+// of the transaction.
+func (postingAmount PostingAmount) IsEmpty() bool {
+	return postingAmount.Amount == nil && postingAmount.Assertion == nil
+}
+
+// IsAssignment reports whether the posting only has a balance assertion, like
+// `= 100 €`. hledger then assigns it the amount that makes the assertion hold.
+func (postingAmount PostingAmount) IsAssignment() bool {
+	return postingAmount.Amount == nil && postingAmount.Assertion != nil
+}
+
+// AssignedAmount returns the amount of a balance assignment that makes the
+// assertion hold, given the running balance of the account before it. For
+// `==`, that includes removing all other commodities from the balance.
+func (postingAmount PostingAmount) AssignedAmount(runningBalance MixedAmount) MixedAmount {
+	asserted := postingAmount.Assertion
+
+	amount := make(MixedAmount)
+	amount.Add(asserted.Quantity, asserted.Commodity)
+	if actual, ok := runningBalance[asserted.Commodity]; ok {
+		amount.Add(new(big.Rat).Neg(actual), asserted.Commodity)
+	}
+	if postingAmount.TotalAssertion {
+		for _, commodity := range runningBalance.Commodities() {
+			if commodity != asserted.Commodity {
+				amount.Add(new(big.Rat).Neg(runningBalance[commodity]), commodity)
+			}
+		}
+	}
+	return amount
+}
+
+// Balance returns the quantity and commodity that the posting contributes to
+// the balance of its transaction. If the posting has a cost, that is the cost
+// instead of the amount.
+func (postingAmount PostingAmount) Balance() (*big.Rat, string) {
+	if postingAmount.Amount == nil {
+		return new(big.Rat), ""
+	}
+	if postingAmount.Cost == nil {
+		return postingAmount.Amount.Quantity, postingAmount.Amount.Commodity
+	}
+
+	if postingAmount.TotalCost {
+		quantity := new(big.Rat).Abs(postingAmount.Cost.Quantity)
+		if postingAmount.Amount.Quantity.Sign() < 0 {
+			quantity.Neg(quantity)
+		}
+		return quantity, postingAmount.Cost.Commodity
+	}
+
+	quantity := new(big.Rat).Mul(postingAmount.Amount.Quantity, postingAmount.Cost.Quantity)
+	return quantity, postingAmount.Cost.Commodity
+}
+
+// AmountAnchorOffset returns the offset in runes of the position within the
+// text of a posting amount that amounts are aligned on: the decimal mark of the
+// first quantity, or the position right after its last digit. If the text
+// contains no quantity, the length of the text is returned.
+func AmountAnchorOffset(text string) int {
+	scanner := amountScanner{input: text}
+	for scanner.offset < len(scanner.input) {
+		r, size := utf8.DecodeRuneInString(scanner.input[scanner.offset:])
+		if r == '"' {
+			scanner.scanQuotedCommodity()
+			continue
+		}
+		if !unicode.IsDigit(r) {
+			scanner.offset += size
+			continue
+		}
+
+		start := scanner.offset
+		number := scanner.scanNumber()
+		style, _ := numberStyle(number)
+		anchor := len(number)
+		if style.DecimalMark != 0 {
+			anchor = strings.LastIndexFunc(number, func(r rune) bool {
+				return r == style.DecimalMark
+			})
+		}
+		return utf8.RuneCountInString(text[:start+anchor])
+	}
+
+	return utf8.RuneCountInString(text)
+}
+
+type amountScanner struct {
+	input  string
+	offset int
+}
+
+func (scanner *amountScanner) peek() rune {
+	if scanner.offset >= len(scanner.input) {
+		return -1
+	}
+	r, _ := utf8.DecodeRuneInString(scanner.input[scanner.offset:])
+	return r
+}
+
+func (scanner *amountScanner) skipSpaces() bool {
+	start := scanner.offset
+	for scanner.peek() == ' ' {
+		scanner.offset++
+	}
+	return scanner.offset != start
+}
+
+func (scanner *amountScanner) scanSign() bool {
+	switch scanner.peek() {
+	case '-':
+		scanner.offset++
+		return true
+	case '+':
+		scanner.offset++
+	}
+	return false
+}
+
+func isCommodityRune(r rune) bool {
+	return !unicode.IsDigit(r) && !unicode.IsSpace(r) && !strings.ContainsRune("-+.,;@*=()[]{}\"", r)
+}
+
+func (scanner *amountScanner) scanQuotedCommodity() string {
+	end := strings.IndexRune(scanner.input[scanner.offset+1:], '"')
+	if end < 0 {
+		commodity := scanner.input[scanner.offset+1:]
+		scanner.offset = len(scanner.input)
+		return commodity
+	}
+	commodity := scanner.input[scanner.offset+1 : scanner.offset+1+end]
+	scanner.offset += end + 2
+	return commodity
+}
+
+func (scanner *amountScanner) scanCommodity() string {
+	if scanner.peek() == '"' {
+		return scanner.scanQuotedCommodity()
+	}
+
+	start := scanner.offset
+	for {
+		r := scanner.peek()
+		if r < 0 || !isCommodityRune(r) {
+			break
+		}
+		scanner.offset += utf8.RuneLen(r)
+	}
+	return scanner.input[start:scanner.offset]
+}
+
+func (scanner *amountScanner) scanNumber() string {
+	start := scanner.offset
+	for {
+		r := scanner.peek()
+		if r < 0 {
+			break
+		}
+		if unicode.IsDigit(r) {
+			scanner.offset += utf8.RuneLen(r)
+			continue
+		}
+		// Separators are only part of the number if a digit follows them.
+		if r == '.' || r == ',' {
+			next := scanner.offset + 1
+			if next < len(scanner.input) {
+				if nextRune, _ := utf8.DecodeRuneInString(scanner.input[next:]); unicode.IsDigit(nextRune) {
+					scanner.offset = next
+					continue
+				}
+			}
+		}
+		break
+	}
+	return scanner.input[start:scanner.offset]
+}
+
+func (scanner *amountScanner) scanAmount() (*Amount, error) {
+	amount := &Amount{}
+
+	isNegative := scanner.scanSign()
+	scanner.skipSpaces()
+
+	if commodity := scanner.scanCommodity(); commodity != "" {
+		amount.Commodity = commodity
+		amount.Style.CommodityOnLeft = true
+		amount.Style.CommoditySpaced = scanner.skipSpaces()
+		if scanner.scanSign() {
+			isNegative = !isNegative
+		}
+	}
+
+	number := scanner.scanNumber()
+	if number == "" {
+		return nil, fmt.Errorf("%w: missing quantity in %q", ErrInvalidAmount, scanner.input)
+	}
+
+	if !amount.Style.CommodityOnLeft {
+		spaced := scanner.skipSpaces()
+		if commodity := scanner.scanCommodity(); commodity != "" {
+			amount.Commodity = commodity
+			amount.Style.CommoditySpaced = spaced
+		}
+	}
+	scanner.skipSpaces()
+
+	style, quantity := numberStyle(number)
+	amount.Style.DecimalMark = style.DecimalMark
+	amount.Style.DigitGroupMark = style.DigitGroupMark
+	amount.Style.Precision = style.Precision
+
+	rat, ok := new(big.Rat).SetString(quantity)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid quantity %q", ErrInvalidAmount, number)
+	}
+	if isNegative {
+		rat.Neg(rat)
+	}
+	amount.Quantity = rat
+
+	return amount, nil
+}
+
+// numberStyle determines the decimal and digit group marks of a number and
+// returns it in a form that big.Rat can parse.
+func numberStyle(number string) (AmountStyle, string) {
+	style := AmountStyle{}
+
+	lastPeriod := strings.LastIndex(number, ".")
+	lastComma := strings.LastIndex(number, ",")
+
+	switch {
+	case lastPeriod >= 0 && lastComma >= 0:
+		style.DecimalMark = '.'
+		style.DigitGroupMark = ','
+		if lastComma > lastPeriod {
+			style.DecimalMark = ','
+			style.DigitGroupMark = '.'
+		}
+	case lastPeriod >= 0:
+		if strings.Count(number, ".") > 1 {
+			style.DigitGroupMark = '.'
+		} else {
+			style.DecimalMark = '.'
+		}
+	case lastComma >= 0:
+		if strings.Count(number, ",") > 1 {
+			style.DigitGroupMark = ','
+		} else {
+			style.DecimalMark = ','
+		}
+	}
+
+	integerPart := number
+	fractionalPart := ""
+	if style.DecimalMark != 0 {
+		index := strings.LastIndex(number, string(style.DecimalMark))
+		integerPart = number[:index]
+		fractionalPart = number[index+1:]
+	}
+	if style.DigitGroupMark != 0 {
+		integerPart = strings.ReplaceAll(integerPart, string(style.DigitGroupMark), "")
+	}
+	style.Precision = len(fractionalPart)
+
+	if fractionalPart == "" {
+		return style, integerPart
+	}
+	return style, integerPart + "." + fractionalPart
+}
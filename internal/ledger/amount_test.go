@@ -0,0 +1,198 @@
+package ledger
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAmount(t *testing.T) {
+	t.Run("parses amounts with a commodity on either side.", func(t *testing.T) {
+		type testCase struct {
+			input             string
+			expectedQuantity  string
+			expectedCommodity string
+			expectedStyle     AmountStyle
+		}
+
+		testCases := []testCase{
+			{
+				input:             "1,234.56 €",
+				expectedQuantity:  "123456/100",
+				expectedCommodity: "€",
+				expectedStyle:     AmountStyle{CommoditySpaced: true, DecimalMark: '.', DigitGroupMark: ',', Precision: 2},
+			},
+			{
+				input:             "-1.234,5 EUR",
+				expectedQuantity:  "-12345/10",
+				expectedCommodity: "EUR",
+				expectedStyle:     AmountStyle{CommoditySpaced: true, DecimalMark: ',', DigitGroupMark: '.', Precision: 1},
+			},
+			{
+				input:             "$100",
+				expectedQuantity:  "100",
+				expectedCommodity: "$",
+				expectedStyle:     AmountStyle{CommodityOnLeft: true},
+			},
+			{
+				input:             "-$1.5",
+				expectedQuantity:  "-3/2",
+				expectedCommodity: "$",
+				expectedStyle:     AmountStyle{CommodityOnLeft: true, DecimalMark: '.', Precision: 1},
+			},
+			{
+				input:             "EUR -5",
+				expectedQuantity:  "-5",
+				expectedCommodity: "EUR",
+				expectedStyle:     AmountStyle{CommodityOnLeft: true, CommoditySpaced: true},
+			},
+			{
+				input:             "1.000.000",
+				expectedQuantity:  "1000000",
+				expectedCommodity: "",
+				expectedStyle:     AmountStyle{DigitGroupMark: '.'},
+			},
+			{
+				input:             "10 \"Green Apples\"",
+				expectedQuantity:  "10",
+				expectedCommodity: "Green Apples",
+				expectedStyle:     AmountStyle{CommoditySpaced: true},
+			},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.input, func(t *testing.T) {
+				amount, err := ParseAmount(testCase.input)
+
+				assert.NoError(t, err)
+				expectedQuantity, _ := new(big.Rat).SetString(testCase.expectedQuantity)
+				assert.Equal(t, 0, expectedQuantity.Cmp(amount.Quantity), "quantity %s", amount.Quantity)
+				assert.Equal(t, testCase.expectedCommodity, amount.Commodity)
+				assert.Equal(t, testCase.expectedStyle, amount.Style)
+			})
+		}
+	})
+
+	t.Run("fails on invalid amounts.", func(t *testing.T) {
+		invalidInputs := []string{
+			"",
+			"€",
+			"10 € 20",
+		}
+
+		for _, invalidInput := range invalidInputs {
+			_, err := ParseAmount(invalidInput)
+			assert.ErrorIs(t, err, ErrInvalidAmount, "input %q", invalidInput)
+		}
+	})
+}
+
+func TestAmountString(t *testing.T) {
+	t.Run("writes amounts the way they were parsed.", func(t *testing.T) {
+		inputs := []string{
+			"1,234.56 €",
+			"-1.234,5 EUR",
+			"$100",
+			"$-1.5",
+			"EUR -5",
+			"1.000.000",
+			"10 \"Green Apples\"",
+		}
+
+		for _, input := range inputs {
+			amount, err := ParseAmount(input)
+			assert.NoError(t, err)
+			assert.Equal(t, input, amount.String())
+		}
+	})
+
+	t.Run("rounds quantities to the precision of the style.", func(t *testing.T) {
+		style := AmountStyle{DecimalMark: ',', DigitGroupMark: '.', CommoditySpaced: true, Precision: 2}
+
+		assert.Equal(t, "-1.234,57 €", style.Format(big.NewRat(-1234567, 1000), "€"))
+	})
+}
+
+func TestParsePostingAmount(t *testing.T) {
+	t.Run("parses an amount with a unit cost.", func(t *testing.T) {
+		postingAmount, err := ParsePostingAmount("-2 BTC @  1,234.50 €")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "-2 BTC", postingAmount.Amount.String())
+		assert.Equal(t, "1,234.50 €", postingAmount.Cost.String())
+		assert.False(t, postingAmount.TotalCost)
+		assert.Nil(t, postingAmount.Assertion)
+
+		quantity, commodity := postingAmount.Balance()
+		assert.Equal(t, "-2469.00", quantity.FloatString(2))
+		assert.Equal(t, "€", commodity)
+	})
+
+	t.Run("parses an amount with a total cost.", func(t *testing.T) {
+		postingAmount, err := ParsePostingAmount("-2 BTC @@ 100 €")
+
+		assert.NoError(t, err)
+		assert.True(t, postingAmount.TotalCost)
+
+		quantity, commodity := postingAmount.Balance()
+		assert.Equal(t, "-100", quantity.FloatString(0))
+		assert.Equal(t, "€", commodity)
+	})
+
+	t.Run("parses an amount with a balance assertion.", func(t *testing.T) {
+		postingAmount, err := ParsePostingAmount("10 € = 15 €")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "10 €", postingAmount.Amount.String())
+		assert.Equal(t, "15 €", postingAmount.Assertion.String())
+		assert.False(t, postingAmount.InclusiveAssertion)
+		assert.False(t, postingAmount.TotalAssertion)
+	})
+
+	t.Run("parses a balance assertion without an amount.", func(t *testing.T) {
+		postingAmount, err := ParsePostingAmount("==* $123456")
+
+		assert.NoError(t, err)
+		assert.False(t, postingAmount.IsEmpty())
+		assert.True(t, postingAmount.IsAssignment())
+		assert.Equal(t, "$123456", postingAmount.Assertion.String())
+		assert.True(t, postingAmount.InclusiveAssertion)
+		assert.True(t, postingAmount.TotalAssertion)
+	})
+
+	t.Run("ignores lot prices and lot dates.", func(t *testing.T) {
+		postingAmount, err := ParsePostingAmount("10 AAPL {{$500}} [2024-01-01] @ $55")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "10 AAPL", postingAmount.Amount.String())
+		assert.Equal(t, "$55", postingAmount.Cost.String())
+
+		postingAmount, err = ParsePostingAmount("10 AAPL {=$50} = 20 AAPL")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "10 AAPL", postingAmount.Amount.String())
+		assert.Equal(t, "20 AAPL", postingAmount.Assertion.String())
+
+		_, err = ParsePostingAmount("10 AAPL {$50")
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+
+	t.Run("parses an empty amount.", func(t *testing.T) {
+		postingAmount, err := ParsePostingAmount("")
+
+		assert.NoError(t, err)
+		assert.True(t, postingAmount.IsEmpty())
+	})
+}
+
+func TestAmountAnchorOffset(t *testing.T) {
+	t.Run("returns the offset of the decimal mark or the end of the quantity.", func(t *testing.T) {
+		assert.Equal(t, 5, AmountAnchorOffset("1,234.56 €"))
+		assert.Equal(t, 6, AmountAnchorOffset("-1,234.56 €"))
+		assert.Equal(t, 4, AmountAnchorOffset("$100"))
+		assert.Equal(t, 6, AmountAnchorOffset("EUR -5"))
+		assert.Equal(t, 4, AmountAnchorOffset("= 15 €"))
+		assert.Equal(t, 3, AmountAnchorOffset("€€€"))
+	})
+}
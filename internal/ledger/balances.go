@@ -0,0 +1,227 @@
+package ledger
+
+import (
+	"math/big"
+	"strings"
+)
+
+// PostingAmounts returns the amount of every posting of the transaction. An
+// amountless posting gets the amount inferred for it, if there is one.
+// Postings whose amount can not be determined are left out.
+func (transaction Transaction) PostingAmounts() map[Posting]MixedAmount {
+	return transaction.PostingAmountsWith(nil)
+}
+
+// PostingAmountsWith returns the amount of every posting of the transaction
+// like PostingAmounts, using the given amounts for its balance assignments.
+func (transaction Transaction) PostingAmountsWith(assignedAmounts map[Posting]MixedAmount) map[Posting]MixedAmount {
+	amounts := make(map[Posting]MixedAmount)
+
+	balance, err := transaction.BalanceWith(assignedAmounts)
+	if err == nil {
+		for _, group := range []BalanceGroup{balance.Real, balance.Virtual} {
+			if posting, inferredAmount, ok := group.InferredAmount(); ok {
+				amounts[posting] = inferredAmount
+			}
+		}
+	}
+
+	for _, posting := range transaction.Postings {
+		if assignedAmount, ok := assignedAmounts[posting]; ok {
+			amounts[posting] = make(MixedAmount)
+			amounts[posting].AddMixed(assignedAmount)
+			continue
+		}
+		postingAmount, err := ParsePostingAmount(posting.AmountText())
+		if err != nil || postingAmount.Amount == nil {
+			continue
+		}
+		amounts[posting] = MixedAmount{
+			postingAmount.Amount.Commodity: new(big.Rat).Set(postingAmount.Amount.Quantity),
+		}
+	}
+
+	return amounts
+}
+
+// runningBalances are the balances of all accounts while going through the
+// journal, without and with their subaccounts.
+type runningBalances struct {
+	exclusive map[string]MixedAmount
+	inclusive map[string]MixedAmount
+}
+
+func newRunningBalances() runningBalances {
+	return runningBalances{
+		exclusive: make(map[string]MixedAmount),
+		inclusive: make(map[string]MixedAmount),
+	}
+}
+
+func (balances runningBalances) add(account *AccountName, amount MixedAmount) {
+	addTo := func(balances map[string]MixedAmount, account string) {
+		if _, ok := balances[account]; !ok {
+			balances[account] = make(MixedAmount)
+		}
+		balances[account].AddMixed(amount)
+	}
+
+	addTo(balances.exclusive, account.String())
+	for _, prefix := range account.Prefixes() {
+		addTo(balances.inclusive, prefix.String())
+	}
+}
+
+// of returns a copy of the running balance of the account, including its
+// subaccounts if inclusive is set.
+func (balances runningBalances) of(account string, inclusive bool) MixedAmount {
+	balance := make(MixedAmount)
+	if inclusive {
+		balance.AddMixed(balances.inclusive[account])
+	} else {
+		balance.AddMixed(balances.exclusive[account])
+	}
+	return balance
+}
+
+// assignedAmounts returns the amounts of the balance assignments of the
+// transaction, given the running balances before it. Earlier postings of the
+// transaction count for the running balance, unless their amount is inferred.
+func (balances runningBalances) assignedAmounts(transaction Transaction) map[Posting]MixedAmount {
+	assignedAmounts := make(map[Posting]MixedAmount)
+
+	for i, posting := range transaction.Postings {
+		postingAmount, err := ParsePostingAmount(posting.AmountText())
+		if err != nil || !postingAmount.IsAssignment() {
+			continue
+		}
+
+		account := posting.Account().String()
+		runningBalance := balances.of(account, postingAmount.InclusiveAssertion)
+		for _, earlierPosting := range transaction.Postings[:i] {
+			earlierAccount := earlierPosting.Account().String()
+			if earlierAccount != account && !(postingAmount.InclusiveAssertion && strings.HasPrefix(earlierAccount, account+":")) {
+				continue
+			}
+			if assignedAmount, ok := assignedAmounts[earlierPosting]; ok {
+				runningBalance.AddMixed(assignedAmount)
+				continue
+			}
+			earlierPostingAmount, err := ParsePostingAmount(earlierPosting.AmountText())
+			if err == nil && earlierPostingAmount.Amount != nil {
+				runningBalance.Add(earlierPostingAmount.Amount.Quantity, earlierPostingAmount.Amount.Commodity)
+			}
+		}
+
+		assignedAmounts[posting] = postingAmount.AssignedAmount(runningBalance)
+	}
+
+	return assignedAmounts
+}
+
+// walkPostings calls visit for every posting of the journal in order, with
+// its amount if it can be determined and the running balances after it.
+// Balance assignments get the amount that makes them hold.
+func walkPostings(journal *Journal, visit func(posting Posting, amount MixedAmount, ok bool, balances runningBalances)) {
+	balances := newRunningBalances()
+
+	for _, transaction := range Transactions(journal) {
+		amounts := transaction.PostingAmountsWith(balances.assignedAmounts(transaction))
+		for _, posting := range transaction.Postings {
+			amount, ok := amounts[posting]
+			if ok {
+				balances.add(posting.Account(), amount)
+			}
+			visit(posting, amount, ok, balances)
+		}
+	}
+}
+
+// BalanceAssertion is a posting with a balance assertion, together with the
+// running balance of its account after the posting.
+type BalanceAssertion struct {
+	Posting       Posting
+	PostingAmount PostingAmount
+	// RunningBalance includes the subaccounts for inclusive assertions.
+	RunningBalance MixedAmount
+}
+
+// BalanceAssertions returns the postings with a balance assertion in the order
+// of the journal, with the running balance of their account after each of
+// them.
+//
+// Balance assignments are included, and hold unless their account is
+// assigned again within the same transaction.
+func BalanceAssertions(journal *Journal) []BalanceAssertion {
+	assertions := make([]BalanceAssertion, 0)
+
+	walkPostings(journal, func(posting Posting, _ MixedAmount, _ bool, balances runningBalances) {
+		postingAmount, err := ParsePostingAmount(posting.AmountText())
+		if err != nil || postingAmount.Assertion == nil {
+			return
+		}
+
+		assertions = append(assertions, BalanceAssertion{
+			Posting:        posting,
+			PostingAmount:  postingAmount,
+			RunningBalance: balances.of(posting.Account().String(), postingAmount.InclusiveAssertion),
+		})
+	})
+
+	return assertions
+}
+
+// Holds reports whether the running balance matches the asserted amount, at
+// the precision the amount is written with. Like in hledger, `=` only checks
+// the asserted commodity, while `==` also requires all other commodities to
+// be zero.
+func (assertion BalanceAssertion) Holds() bool {
+	asserted := assertion.PostingAmount.Assertion
+
+	for _, commodity := range assertion.RunningBalance.Commodities() {
+		if commodity != asserted.Commodity && assertion.PostingAmount.TotalAssertion {
+			return false
+		}
+	}
+
+	actual, ok := assertion.RunningBalance[asserted.Commodity]
+	if !ok {
+		actual = new(big.Rat)
+	}
+	difference := new(big.Rat).Sub(actual, asserted.Quantity)
+	difference.Abs(difference)
+
+	// The difference rounds to zero if it is less than half of the smallest
+	// unit at the precision of the asserted amount.
+	unit := new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(asserted.Style.Precision)), nil))
+	return difference.Cmp(unit.Mul(unit, big.NewRat(1, 2))) < 0
+}
+
+// AccountBalance is the sum of all postings to an account and its
+// subaccounts.
+type AccountBalance struct {
+	Amount       MixedAmount
+	PostingCount int
+}
+
+// AccountBalances sums up the postings of all transactions of the journal for
+// every account, including the postings to their subaccounts.
+func AccountBalances(journal *Journal) map[string]AccountBalance {
+	balances := make(map[string]AccountBalance)
+
+	walkPostings(journal, func(posting Posting, amount MixedAmount, hasAmount bool, _ runningBalances) {
+		for _, prefix := range posting.Account().Prefixes() {
+			balance, ok := balances[prefix.String()]
+			if !ok {
+				balance = AccountBalance{Amount: make(MixedAmount)}
+			}
+			balance.PostingCount += 1
+			if hasAmount {
+				balance.Amount.AddMixed(amount)
+			}
+			balances[prefix.String()] = balance
+		}
+	})
+
+	return balances
+}
@@ -0,0 +1,126 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostingAmounts(t *testing.T) {
+	t.Run("returns the amounts of the postings including inferred amounts.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10 € @ $1.10
+    (budget:Food)
+    assets:Cash
+`)
+		transaction := Transactions(journal)[0]
+
+		amounts := transaction.PostingAmounts()
+
+		assert.Len(t, amounts, 2)
+		assert.Equal(t, []string{"10 €"}, amounts[transaction.Postings[0]].Format(CommodityStyles(journal), AmountStyle{}))
+		assert.Equal(t, []string{"$-11.00"}, amounts[transaction.Postings[2]].Format(CommodityStyles(journal), AmountStyle{}))
+	})
+}
+
+func TestAccountBalances(t *testing.T) {
+	t.Run("sums up the postings of each account including its subaccounts.", func(t *testing.T) {
+		journal := parseTestJournal(t, `account assets
+
+2024-11-25 Payee
+    expenses:Groceries  10 €
+    assets:Cash
+
+2024-11-26 Payee
+    expenses:Snacks  $2
+    assets:Checking
+
+~ monthly
+    expenses:Rent  100 €
+    assets:Checking
+`)
+
+		balances := AccountBalances(journal)
+		styles := CommodityStyles(journal)
+
+		assert.Equal(t, 2, balances["assets"].PostingCount)
+		assert.Equal(t, []string{"$-2", "-10 €"}, balances["assets"].Amount.Format(styles, AmountStyle{}))
+		assert.Equal(t, 1, balances["assets:Cash"].PostingCount)
+		assert.Equal(t, []string{"-10 €"}, balances["assets:Cash"].Amount.Format(styles, AmountStyle{}))
+		assert.Equal(t, []string{"$2", "10 €"}, balances["expenses"].Amount.Format(styles, AmountStyle{}))
+		assert.NotContains(t, balances, "expenses:Rent")
+	})
+}
+
+func TestBalanceAssertions(t *testing.T) {
+	t.Run("returns the running balance of the account after each assertion.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    assets:Cash:Wallet  10 €
+    assets:Cash  5 € = 5 €
+    income:Salary
+
+2024-11-26 Payee
+    expenses:Groceries  2 €
+    assets:Cash  -2 € =* 14 €
+`)
+
+		assertions := BalanceAssertions(journal)
+
+		assert.Len(t, assertions, 2)
+		assert.Equal(t, []string{"5 €"}, assertions[0].RunningBalance.Format(CommodityStyles(journal), AmountStyle{}))
+		assert.True(t, assertions[0].Holds())
+		assert.Equal(t, []string{"13 €"}, assertions[1].RunningBalance.Format(CommodityStyles(journal), AmountStyle{}))
+		assert.False(t, assertions[1].Holds())
+	})
+
+	t.Run("checks other commodities only for total assertions.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    assets:Cash  5 €
+    assets:Cash  $3 = 5 €
+    assets:Cash  0 € == 5 €
+    income:Salary
+`)
+
+		assertions := BalanceAssertions(journal)
+
+		assert.Len(t, assertions, 2)
+		assert.True(t, assertions[0].Holds())
+		assert.False(t, assertions[1].Holds())
+	})
+
+	t.Run("assigns balance assignments the amount that makes them hold.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-01-01 Opening balances
+    assets:Bank  = $100
+    equity:Opening
+
+2024-01-02 Payee
+    expenses:Food  $30
+    assets:Bank  = $60
+    income:Gifts
+`)
+		assertions := BalanceAssertions(journal)
+		balances := AccountBalances(journal)
+		styles := CommodityStyles(journal)
+
+		assert.Len(t, assertions, 2)
+		assert.True(t, assertions[0].Holds())
+		assert.True(t, assertions[1].Holds())
+		assert.Equal(t, []string{"$-100"}, balances["equity:Opening"].Amount.Format(styles, AmountStyle{}))
+		assert.Equal(t, []string{"$60"}, balances["assets:Bank"].Amount.Format(styles, AmountStyle{}))
+		assert.Equal(t, []string{"$10"}, balances["income:Gifts"].Amount.Format(styles, AmountStyle{}))
+	})
+
+	t.Run("compares at the precision of the asserted amount.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    assets:Cash  10.004 € = 10.00 €
+    assets:Bank  10.006 € = 10.00 €
+    income:Salary
+`)
+
+		assertions := BalanceAssertions(journal)
+
+		assert.Len(t, assertions, 2)
+		assert.True(t, assertions[0].Holds())
+		assert.False(t, assertions[1].Holds())
+	})
+}
@@ -0,0 +1,182 @@
+package ledger
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// BalancingFix is a set of edits that balances a transaction.
+type BalancingFix struct {
+	Title string
+	Edits []ColumnEdit
+}
+
+// fallbackAmountStyle is used for commodities that do not occur anywhere else
+// in the journal.
+var fallbackAmountStyle = AmountStyle{CommoditySpaced: true}
+
+// BalancingFixes returns the edits that balance the given transaction of the
+// input. If a single posting has no amount, its inferred amount is written
+// into it. If all postings have amounts but do not balance, a fix is returned
+// for each of the given accounts that adds a posting taking up the residual.
+// Amounts are written in the given commodity styles.
+func BalancingFixes(input string, transaction Transaction, styles map[string]AmountStyle, accounts []string) []BalancingFix {
+	fixes := make([]BalancingFix, 0)
+
+	balance, err := transaction.Balance()
+	if err != nil {
+		return fixes
+	}
+
+	lines := strings.Split(input, "\n")
+
+	for _, group := range []BalanceGroup{balance.Real, balance.Virtual} {
+		if posting, inferredAmount, ok := group.InferredAmount(); ok {
+			if inferredAmount.IsZero() {
+				continue
+			}
+			amounts := inferredAmount.Format(styles, fallbackAmountStyle)
+			fixes = append(fixes, BalancingFix{
+				Title: fmt.Sprintf("Insert inferred amount %s", strings.Join(amounts, ", ")),
+				Edits: insertAmountEdits(lines, posting, amounts),
+			})
+			continue
+		}
+
+		if len(group.Amountless) != 0 || len(group.Unassigned) != 0 || group.RoundedResidual().IsZero() || len(transaction.Postings) == 0 {
+			continue
+		}
+
+		amounts := group.RoundedResidual().Neg().Format(styles, fallbackAmountStyle)
+		lastPosting := transaction.Postings[len(transaction.Postings)-1]
+		for _, account := range accounts {
+			fixes = append(fixes, BalancingFix{
+				Title: fmt.Sprintf("Balance with %s to %s", strings.Join(amounts, ", "), account),
+				Edits: addPostingsEdits(lines, lastPosting, balancingPostingPrefix(lines, group, account), amounts),
+			})
+		}
+	}
+
+	return fixes
+}
+
+// insertAmountEdits writes the first amount into the posting. Each further
+// amount gets its own posting to the same account right after it, since a
+// posting can only hold a single commodity.
+func insertAmountEdits(lines []string, posting Posting, amounts []string) []ColumnEdit {
+	amountPos := posting.AmountPos()
+	edits := []ColumnEdit{{
+		Line:        amountPos.Line,
+		StartColumn: amountPos.Column,
+		EndColumn:   amountPos.Column,
+		NewText:     amountSeparator + amounts[0],
+	}}
+
+	if len(amounts) > 1 {
+		line := []rune(strings.TrimSuffix(lines[amountPos.Line-1], "\r"))
+		prefix := string(line[:min(amountPos.Column-1, len(line))])
+		edits = append(edits, addPostingsEdits(lines, posting, prefix, amounts[1:])...)
+	}
+
+	return edits
+}
+
+// addPostingsEdits adds a posting for each amount after the given posting.
+// Each new posting starts with the given prefix, which holds its indent and
+// account.
+func addPostingsEdits(lines []string, after Posting, prefix string, amounts []string) []ColumnEdit {
+	lineNumber := after.Account().Pos.Line
+	line := strings.TrimSuffix(lines[lineNumber-1], "\r")
+	lineEnding := "\n"
+	if strings.HasSuffix(lines[lineNumber-1], "\r") {
+		lineEnding = "\r\n"
+	}
+
+	newText := ""
+	for _, amount := range amounts {
+		newText += lineEnding + prefix + amountSeparator + amount
+	}
+
+	endColumn := utf8.RuneCountInString(line) + 1
+	return []ColumnEdit{{
+		Line:        lineNumber,
+		StartColumn: endColumn,
+		EndColumn:   endColumn,
+		NewText:     newText,
+	}}
+}
+
+// balancingPostingPrefix returns the indent and account of a new posting to
+// the given account, using the indent of the existing postings and the same
+// kind of posting as the group.
+func balancingPostingPrefix(lines []string, group BalanceGroup, account string) string {
+	indent := DefaultFormatOptions().PostingIndent
+	virtual := false
+	for _, posting := range group.postings {
+		line := lines[posting.Account().Pos.Line-1]
+		indent = line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		_, virtual = posting.(*VirtualBalancedPosting)
+	}
+
+	if virtual {
+		return indent + "[" + account + "]"
+	}
+	return indent + account
+}
+
+// BalancingAccountCandidates suggests accounts that a posting balancing the
+// transaction could go to. Accounts that appear together with the accounts of
+// the transaction elsewhere in the journal come first, followed by the
+// accounts used most often. Accounts already in the transaction are left out.
+func BalancingAccountCandidates(journal *Journal, transaction Transaction, limit int) []string {
+	ownAccounts := make(map[string]bool)
+	for _, posting := range transaction.Postings {
+		ownAccounts[posting.Account().String()] = true
+	}
+
+	coOccurrences := make(map[string]int)
+	usages := make(map[string]int)
+	for _, otherTransaction := range Transactions(journal) {
+		if otherTransaction.Header == transaction.Header {
+			continue
+		}
+
+		sharesAccount := false
+		for _, posting := range otherTransaction.Postings {
+			if ownAccounts[posting.Account().String()] {
+				sharesAccount = true
+			}
+		}
+
+		for _, posting := range otherTransaction.Postings {
+			account := posting.Account().String()
+			if ownAccounts[account] {
+				continue
+			}
+			usages[account] += 1
+			if sharesAccount {
+				coOccurrences[account] += 1
+			}
+		}
+	}
+
+	candidates := make([]string, 0, len(usages))
+	for account := range usages {
+		candidates = append(candidates, account)
+	}
+	slices.SortFunc(candidates, func(a, b string) int {
+		return cmp.Or(
+			cmp.Compare(coOccurrences[b], coOccurrences[a]),
+			cmp.Compare(usages[b], usages[a]),
+			strings.Compare(a, b),
+		)
+	})
+
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+	return candidates
+}
@@ -0,0 +1,128 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalancingFixes(t *testing.T) {
+	t.Run("writes the inferred amount into the amountless posting.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+    expenses:Groceries  1.234,50 €
+    assets:Cash  ; paid in cash
+`
+		journal := parseTestJournal(t, input)
+
+		fixes := BalancingFixes(input, Transactions(journal)[0], CommodityStyles(journal), nil)
+
+		assert.Equal(t, []BalancingFix{
+			{
+				Title: "Insert inferred amount -1.234,50 €",
+				Edits: []ColumnEdit{
+					{Line: 3, StartColumn: 16, EndColumn: 16, NewText: "  -1.234,50 €"},
+				},
+			},
+		}, fixes)
+	})
+
+	t.Run("writes the inferred amount into amountless balanced virtual postings.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+  expenses:Groceries  10 €
+  assets:Cash  -10 €
+  [budget:Food]  -10 €
+  [budget:Available]
+`
+		journal := parseTestJournal(t, input)
+
+		fixes := BalancingFixes(input, Transactions(journal)[0], CommodityStyles(journal), nil)
+
+		assert.Equal(t, []BalancingFix{
+			{
+				Title: "Insert inferred amount 10 €",
+				Edits: []ColumnEdit{
+					{Line: 5, StartColumn: 21, EndColumn: 21, NewText: "  10 €"},
+				},
+			},
+		}, fixes)
+	})
+
+	t.Run("adds a posting for each further commodity of the inferred amount.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+  expenses:Groceries  10 €
+  expenses:Snacks  $2
+  assets:Cash
+`
+		journal := parseTestJournal(t, input)
+
+		fixes := BalancingFixes(input, Transactions(journal)[0], CommodityStyles(journal), nil)
+
+		assert.Equal(t, []BalancingFix{
+			{
+				Title: "Insert inferred amount $-2, -10 €",
+				Edits: []ColumnEdit{
+					{Line: 4, StartColumn: 14, EndColumn: 14, NewText: "  $-2"},
+					{Line: 4, StartColumn: 14, EndColumn: 14, NewText: "\n  assets:Cash  -10 €"},
+				},
+			},
+		}, fixes)
+	})
+
+	t.Run("adds a posting to each of the given accounts if all postings have amounts.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+	expenses:Groceries  10.50 €
+	assets:Cash  -10 €
+`
+		journal := parseTestJournal(t, input)
+
+		fixes := BalancingFixes(input, Transactions(journal)[0], CommodityStyles(journal), []string{"assets:Checking", "expenses:Misc"})
+
+		assert.Equal(t, []BalancingFix{
+			{
+				Title: "Balance with -0.50 € to assets:Checking",
+				Edits: []ColumnEdit{
+					{Line: 3, StartColumn: 20, EndColumn: 20, NewText: "\n\tassets:Checking  -0.50 €"},
+				},
+			},
+			{
+				Title: "Balance with -0.50 € to expenses:Misc",
+				Edits: []ColumnEdit{
+					{Line: 3, StartColumn: 20, EndColumn: 20, NewText: "\n\texpenses:Misc  -0.50 €"},
+				},
+			},
+		}, fixes)
+	})
+
+	t.Run("returns no fixes for balanced transactions.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+    expenses:Groceries  10 €
+    assets:Cash  -10 €
+`
+		journal := parseTestJournal(t, input)
+
+		fixes := BalancingFixes(input, Transactions(journal)[0], CommodityStyles(journal), []string{"assets:Checking"})
+
+		assert.Empty(t, fixes)
+	})
+}
+
+func TestBalancingAccountCandidates(t *testing.T) {
+	t.Run("prefers accounts used together with the accounts of the transaction.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-01 Rent
+    expenses:Rent  100 €
+    assets:Checking
+2024-11-02 Groceries
+    expenses:Groceries  10 €
+    assets:Cash
+2024-11-03 Groceries
+    expenses:Groceries  10 €
+    assets:Cash
+2024-11-25 Rent
+    expenses:Rent  100 €
+`)
+		transaction := Transactions(journal)[3]
+
+		assert.Equal(t, []string{"assets:Checking", "assets:Cash", "expenses:Groceries"}, BalancingAccountCandidates(journal, transaction, 5))
+		assert.Equal(t, []string{"assets:Checking"}, BalancingAccountCandidates(journal, transaction, 1))
+	})
+}
@@ -0,0 +1,316 @@
+package ledger
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	participleLexer "github.com/alecthomas/participle/v2/lexer"
+
+	"github.com/yeldirium/hledger-language-server/internal/lexing"
+)
+
+// amountSeparator is written between an account name and its amount, and
+// between an amount and an inline comment.
+const amountSeparator = "  "
+
+type FormatOptions struct {
+	// PostingIndent is written in front of every posting and every comment line
+	// of a transaction.
+	PostingIndent string
+
+	// AlignAcrossFile aligns the amounts of all transactions in the file on the
+	// same column instead of aligning each transaction on its own.
+	AlignAcrossFile bool
+
+	// AmountColumn is the 1-based column that aligned amounts start in at the
+	// earliest. Longer account names move them further right. Zero aligns the
+	// amounts right after the longest account name.
+	AmountColumn int
+}
+
+func DefaultFormatOptions() FormatOptions {
+	return FormatOptions{
+		PostingIndent: "    ",
+	}
+}
+
+// LineEdit replaces a whole line of a journal, excluding its line break.
+type LineEdit struct {
+	// Line is 1-based.
+	Line    int
+	NewText string
+}
+
+// FormatJournal formats all transactions in the journal. Formatting an already
+// formatted journal does not change it.
+func FormatJournal(input string, options FormatOptions) string {
+	lines := strings.Split(input, "\n")
+	for _, edit := range FormatJournalLines(input, options, 1, len(lines)) {
+		lines[edit.Line-1] = edit.NewText
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// FormatJournalLines formats all transactions that overlap the lines from
+// fromLine to toLine, both 1-based and inclusive. It only returns edits for
+// lines that change.
+//
+// Within a transaction, postings are indented with the configured indent,
+// account names and amounts are separated by at least two spaces and all
+// amounts are aligned on their decimal marks. Comments are kept as they are.
+// Lines outside of transactions are never changed.
+func FormatJournalLines(input string, options FormatOptions, fromLine, toLine int) []LineEdit {
+	if options.PostingIndent == "" {
+		options.PostingIndent = DefaultFormatOptions().PostingIndent
+	}
+
+	lines := classifyLines(input)
+	blocks := transactionBlocks(lines)
+
+	fileLayout := amountLayout{}
+	if options.AlignAcrossFile {
+		for _, block := range blocks {
+			fileLayout.extend(lines[block.start:block.end])
+		}
+	}
+
+	edits := make([]LineEdit, 0)
+	for _, block := range blocks {
+		// Blocks use 0-based, end-exclusive indices.
+		if block.end < fromLine || block.start+1 > toLine {
+			continue
+		}
+
+		layout := fileLayout
+		if !options.AlignAcrossFile {
+			layout.extend(lines[block.start:block.end])
+		}
+		layout.reachAmountColumn(options, utf8.RuneCountInString(options.PostingIndent))
+
+		for i := block.start; i < block.end; i++ {
+			newText := lines[i].format(options, layout)
+			if newText != lines[i].text {
+				edits = append(edits, LineEdit{Line: i + 1, NewText: newText})
+			}
+		}
+	}
+
+	return edits
+}
+
+type lineKind int
+
+const (
+	lineOther lineKind = iota
+	lineBlank
+	lineTransactionHeader
+	linePosting
+	lineIndentedComment
+)
+
+type journalLine struct {
+	kind lineKind
+	// text is the original line without its line break.
+	text string
+	// carriageReturn is set if the line ended in \r\n.
+	carriageReturn bool
+
+	// account contains the status indicator and delimiters of a posting as
+	// well as its account name.
+	account string
+	amount  string
+	// comment starts at the comment indicator and reaches until the end of
+	// the line.
+	comment string
+}
+
+type transactionBlock struct {
+	start int
+	end   int
+}
+
+// amountLayout holds the widths that are needed to align the amounts of a set
+// of postings.
+type amountLayout struct {
+	accountWidth int
+	anchorOffset int
+}
+
+func (layout *amountLayout) extend(lines []journalLine) {
+	for _, line := range lines {
+		if line.kind != linePosting || line.amount == "" {
+			continue
+		}
+		layout.accountWidth = max(layout.accountWidth, utf8.RuneCountInString(line.account))
+		layout.anchorOffset = max(layout.anchorOffset, AmountAnchorOffset(line.amount))
+	}
+}
+
+// reachAmountColumn widens the layout so that amounts start in the configured
+// amount column at the earliest, for postings with the given indent.
+func (layout *amountLayout) reachAmountColumn(options FormatOptions, indentWidth int) {
+	if options.AmountColumn > 0 {
+		layout.accountWidth = max(layout.accountWidth, options.AmountColumn-1-indentWidth-len(amountSeparator))
+	}
+}
+
+func (line journalLine) format(options FormatOptions, layout amountLayout) string {
+	var builder strings.Builder
+
+	switch line.kind {
+	case linePosting:
+		builder.WriteString(options.PostingIndent)
+		builder.WriteString(line.account)
+		if line.amount != "" {
+			padding := layout.accountWidth - utf8.RuneCountInString(line.account)
+			padding += layout.anchorOffset - AmountAnchorOffset(line.amount)
+			builder.WriteString(amountSeparator)
+			builder.WriteString(strings.Repeat(" ", max(padding, 0)))
+			builder.WriteString(line.amount)
+		}
+		if line.comment != "" {
+			builder.WriteString(amountSeparator)
+			builder.WriteString(line.comment)
+		}
+	case lineIndentedComment:
+		builder.WriteString(options.PostingIndent)
+		builder.WriteString(line.comment)
+	default:
+		return line.text
+	}
+
+	if line.carriageReturn {
+		builder.WriteRune('\r')
+	}
+	return builder.String()
+}
+
+func transactionBlocks(lines []journalLine) []transactionBlock {
+	blocks := make([]transactionBlock, 0)
+
+	for i := 0; i < len(lines); i++ {
+		if lines[i].kind != lineTransactionHeader {
+			continue
+		}
+
+		block := transactionBlock{start: i, end: i + 1}
+		for block.end < len(lines) && (lines[block.end].kind == linePosting || lines[block.end].kind == lineIndentedComment) {
+			block.end++
+		}
+		blocks = append(blocks, block)
+		i = block.end - 1
+	}
+
+	return blocks
+}
+
+func classifyLines(input string) []journalLine {
+	rawLines := strings.Split(input, "\n")
+	lines := make([]journalLine, len(rawLines))
+
+	for i, rawLine := range rawLines {
+		lines[i] = classifyLine(rawLine)
+	}
+
+	return lines
+}
+
+var lineLexer = NewJournalLexer()
+
+// classifyLine lexes a single line to find out whether it is part of a
+// transaction, and if it is a posting, splits it into its parts.
+func classifyLine(rawLine string) journalLine {
+	line := journalLine{kind: lineOther, text: rawLine}
+	content, carriageReturn := strings.CutSuffix(rawLine, "\r")
+	line.carriageReturn = carriageReturn
+
+	if strings.TrimSpace(content) == "" {
+		line.kind = lineBlank
+		return line
+	}
+
+	lexer, err := lineLexer.LexString("", content+"\n")
+	if err != nil {
+		return line
+	}
+	tokens, err := lexing.CollectAllLexerTokens(lexer)
+	if err != nil || len(tokens) == 0 {
+		return line
+	}
+
+	switch tokens[0].Type {
+	case lineLexer.Symbol("TransactionDate"), lineLexer.Symbol("PeriodicTransactionIndicator"), lineLexer.Symbol("AutoPostingRuleIndicator"):
+		line.kind = lineTransactionHeader
+		return line
+	case lineLexer.Symbol("Indent"):
+	default:
+		return line
+	}
+
+	if len(tokens) > 1 && tokens[1].Type == lineLexer.Symbol("Garbage") {
+		if strings.ContainsRune(";#", rune(tokens[1].Value[0])) {
+			line.kind = lineIndentedComment
+			line.comment = strings.TrimRight(tokens[1].Value, " \t")
+		}
+		return line
+	}
+
+	return splitPostingLine(line, content, tokens[1:])
+}
+
+func splitPostingLine(line journalLine, content string, tokens []participleLexer.Token) journalLine {
+	var account strings.Builder
+	for _, token := range tokens {
+		switch token.Type {
+		case lineLexer.Symbol("PostingStatusIndicator"):
+			account.WriteString(token.Value)
+			account.WriteRune(' ')
+		case lineLexer.Symbol("AccountNameDelimiter"), lineLexer.Symbol("AccountNameSegment"), lineLexer.Symbol("AccountNameSeparator"):
+			account.WriteString(token.Value)
+		case lineLexer.Symbol("Amount"):
+			amount := token.Value
+			// The lexer only ends amounts at comments preceded by two spaces.
+			if offset := inlineCommentOffset(amount); offset >= 0 {
+				line.comment = strings.TrimRight(content[token.Pos.Offset+offset:], " \t")
+				amount = amount[:offset]
+			}
+			line.amount = strings.TrimRight(amount, " \t")
+		case lineLexer.Symbol("InlineCommentIndicator"):
+			commentStart := token.Pos.Offset + len(token.Value) - 1
+			line.comment = strings.TrimRight(content[commentStart:], " \t")
+		case lineLexer.Symbol("Whitespace"), lineLexer.Symbol("Newline"):
+		default:
+			if line.comment == "" {
+				return line
+			}
+		}
+		if line.comment != "" {
+			break
+		}
+	}
+
+	line.account = strings.TrimRight(account.String(), " ")
+	if line.account == "" {
+		return line
+	}
+	line.kind = linePosting
+
+	return line
+}
+
+// inlineCommentOffset returns the offset of the first `;` outside of a quoted
+// commodity in the text of an amount, or -1. Like in hledger, it starts an
+// inline comment whatever the spacing in front of it.
+func inlineCommentOffset(text string) int {
+	inQuotes := false
+	for offset, character := range text {
+		switch {
+		case character == '"':
+			inQuotes = !inQuotes
+		case character == ';' && !inQuotes:
+			return offset
+		}
+	}
+	return -1
+}
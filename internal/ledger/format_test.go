@@ -0,0 +1,169 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatJournal(t *testing.T) {
+	t.Run("aligns the amounts of each transaction on their decimal marks.", func(t *testing.T) {
+		input := `2024-11-25 Payee | transaction reason
+  expenses:Groceries 	1,234.56 €
+	! assets:Cash:Checking   -1,234.5 €
+
+2024-11-26 Another payee
+        expenses:Rent   $100
+        assets:Checking  $-100.00
+`
+
+		formatted := FormatJournal(input, DefaultFormatOptions())
+
+		assert.Equal(t, `2024-11-25 Payee | transaction reason
+    expenses:Groceries       1,234.56 €
+    ! assets:Cash:Checking  -1,234.5 €
+
+2024-11-26 Another payee
+    expenses:Rent     $100
+    assets:Checking  $-100.00
+`, formatted)
+	})
+
+	t.Run("aligns the amounts of all transactions on the same column, if configured.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+    expenses:Groceries  1.00 €
+    assets:Cash  -1.00 €
+
+2024-11-26 Another payee
+    expenses:Rent  100 €
+    assets:Checking
+`
+
+		options := DefaultFormatOptions()
+		options.AlignAcrossFile = true
+		formatted := FormatJournal(input, options)
+
+		assert.Equal(t, `2024-11-25 Payee
+    expenses:Groceries    1.00 €
+    assets:Cash          -1.00 €
+
+2024-11-26 Another payee
+    expenses:Rent       100 €
+    assets:Checking
+`, formatted)
+	})
+
+	t.Run("starts amounts in the configured amount column, unless an account name is longer.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+    expenses:Food  1.00 €
+    assets:Cash  -1.00 €
+
+2024-11-26 Another payee
+    expenses:Rent:Apartment  100 €
+    assets:Checking
+`
+
+		options := DefaultFormatOptions()
+		options.AmountColumn = 25
+		formatted := FormatJournal(input, options)
+
+		assert.Equal(t, `2024-11-25 Payee
+    expenses:Food        1.00 €
+    assets:Cash         -1.00 €
+
+2024-11-26 Another payee
+    expenses:Rent:Apartment  100 €
+    assets:Checking
+`, formatted)
+	})
+
+	t.Run("keeps comments, virtual postings and balance assertions intact.", func(t *testing.T) {
+		input := `; a comment outside of transactions
+2024-11-25 Payee  ; header comment
+  ; a comment inside of a transaction
+  (virtual:posting)  300 €  ;   inline comment
+  [balanced:virtual:posting]      = 15 €
+  expenses:Food   ; comment without an amount
+`
+
+		formatted := FormatJournal(input, DefaultFormatOptions())
+
+		assert.Equal(t, `; a comment outside of transactions
+2024-11-25 Payee  ; header comment
+    ; a comment inside of a transaction
+    (virtual:posting)            300 €  ;   inline comment
+    [balanced:virtual:posting]  = 15 €
+    expenses:Food  ; comment without an amount
+`, formatted)
+	})
+
+	t.Run("splits off inline comments after a single space.", func(t *testing.T) {
+		input := "2024-11-25 Payee\n    expenses:Food  10 € ; c\n    assets:Cash  -10 \"semi;colon\";comment\n"
+
+		formatted := FormatJournal(input, DefaultFormatOptions())
+
+		assert.Equal(t, "2024-11-25 Payee\n    expenses:Food   10 €  ; c\n    assets:Cash    -10 \"semi;colon\"  ;comment\n", formatted)
+	})
+
+	t.Run("does not change lines outside of transactions.", func(t *testing.T) {
+		input := `account assets:Cash  ; comment
+commodity EUR
+  format 1,000.00 €
+include   foo.journal
+`
+
+		formatted := FormatJournal(input, DefaultFormatOptions())
+
+		assert.Equal(t, input, formatted)
+	})
+
+	t.Run("uses the configured posting indent.", func(t *testing.T) {
+		input := "~ monthly\n    expenses:Rent  100 €\n    assets:Checking\n"
+
+		formatted := FormatJournal(input, FormatOptions{PostingIndent: "  "})
+
+		assert.Equal(t, "~ monthly\n  expenses:Rent  100 €\n  assets:Checking\n", formatted)
+	})
+
+	t.Run("is idempotent.", func(t *testing.T) {
+		input := `2024-11-25 Payee | transaction reason
+  expenses:Groceries 	1,234.56 €  ; comment
+	! assets:Cash:Checking   -1,234.5 € = 0 €
+    (foo)    -2 BTC @ 1,234.50 €
+    b  1 ; c
+    c  2 "semi;colon" ;comment
+`
+
+		once := FormatJournal(input, DefaultFormatOptions())
+		twice := FormatJournal(once, DefaultFormatOptions())
+
+		assert.Equal(t, once, twice)
+	})
+
+	t.Run("keeps windows line endings.", func(t *testing.T) {
+		input := "2024-11-25 Payee\r\n  expenses:Rent  100 €\r\n  assets:Checking\r\n"
+
+		formatted := FormatJournal(input, DefaultFormatOptions())
+
+		assert.Equal(t, "2024-11-25 Payee\r\n    expenses:Rent  100 €\r\n    assets:Checking\r\n", formatted)
+	})
+}
+
+func TestFormatJournalLines(t *testing.T) {
+	t.Run("only returns edits for changed lines of transactions overlapping the range.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+  expenses:Groceries  1.00 €
+  assets:Cash  -1.00 €
+
+2024-11-26 Another payee
+  expenses:Rent  100 €
+    assets:Checking
+`
+
+		edits := FormatJournalLines(input, DefaultFormatOptions(), 6, 6)
+
+		assert.Equal(t, []LineEdit{
+			{Line: 6, NewText: "    expenses:Rent  100 €"},
+		}, edits)
+	})
+}
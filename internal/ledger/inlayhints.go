@@ -0,0 +1,94 @@
+package ledger
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// InlayHint is a label shown in front of the given 1-based line and column.
+type InlayHint struct {
+	Line   int
+	Column int
+	Label  string
+}
+
+// InferredAmountHints returns a hint with the inferred amount for every
+// amountless posting of the given file that hledger infers an amount for.
+func InferredAmountHints(journal *Journal, fileName string, styles map[string]AmountStyle) []InlayHint {
+	hints := make([]InlayHint, 0)
+
+	for _, transaction := range Transactions(journal) {
+		if transaction.Header.Pos.Filename != fileName {
+			continue
+		}
+
+		balance, err := transaction.Balance()
+		if err != nil {
+			continue
+		}
+		for _, group := range []BalanceGroup{balance.Real, balance.Virtual} {
+			posting, inferredAmount, ok := group.InferredAmount()
+			if !ok {
+				continue
+			}
+			hints = append(hints, InlayHint{
+				Line:   posting.AmountPos().Line,
+				Column: posting.AmountPos().Column,
+				Label:  formatMixedAmount(inferredAmount, styles),
+			})
+		}
+	}
+
+	return hints
+}
+
+// RunningBalanceHints returns a hint with the running balance of the account
+// after every posting of the given file that has a balance assertion. Like
+// the assertion, the balance includes subaccounts for `=*` and `==*`. The
+// input is the content of the file, which is needed to place the hints after
+// the amounts.
+func RunningBalanceHints(journal *Journal, fileName string, input string, styles map[string]AmountStyle) []InlayHint {
+	hints := make([]InlayHint, 0)
+	lines := strings.Split(input, "\n")
+
+	for _, assertion := range BalanceAssertions(journal) {
+		posting := assertion.Posting
+		if posting.Account().Pos.Filename != fileName {
+			continue
+		}
+
+		line := posting.AmountPos().Line
+		if line > len(lines) {
+			continue
+		}
+		hints = append(hints, InlayHint{
+			Line:   line,
+			Column: amountEndColumn(lines[line-1], posting),
+			Label:  formatMixedAmount(assertion.RunningBalance, styles),
+		})
+	}
+
+	return hints
+}
+
+// amountEndColumn returns the 1-based column right after the amount of the
+// posting on its line.
+func amountEndColumn(line string, posting Posting) int {
+	runes := []rune(strings.TrimSuffix(line, "\r"))
+	start := min(posting.AmountPos().Column-1, len(runes))
+	rest := string(runes[start:])
+
+	offset := strings.Index(rest, posting.AmountText())
+	if offset < 0 {
+		return len(runes) + 1
+	}
+
+	return start + utf8.RuneCountInString(rest[:offset]) + utf8.RuneCountInString(posting.AmountText()) + 1
+}
+
+func formatMixedAmount(amount MixedAmount, styles map[string]AmountStyle) string {
+	if amount.IsZero() {
+		return "0"
+	}
+	return strings.Join(amount.Format(styles, fallbackAmountStyle), ", ")
+}
@@ -0,0 +1,49 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInferredAmountHints(t *testing.T) {
+	t.Run("returns the inferred amount of amountless postings.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10 €
+    expenses:Snacks  $2
+    assets:Cash  ; paid in cash
+
+2024-11-26 Payee
+    expenses:Groceries  10 €
+    assets:Cash  -10 €
+`)
+
+		hints := InferredAmountHints(journal, "test.journal", CommodityStyles(journal))
+
+		assert.Equal(t, []InlayHint{
+			{Line: 4, Column: 16, Label: "$-2, -10 €"},
+		}, hints)
+	})
+}
+
+func TestRunningBalanceHints(t *testing.T) {
+	t.Run("returns the running balance after postings with assertions.", func(t *testing.T) {
+		input := `2024-11-25 Payee
+    assets:Cash:Wallet  10 €
+    assets:Cash  5 € = 5 €  ; comment
+    income:Salary
+
+2024-11-26 Payee
+    expenses:Groceries  2 €
+    assets:Cash  =* 13 €
+`
+		journal := parseTestJournal(t, input)
+
+		hints := RunningBalanceHints(journal, "test.journal", input, CommodityStyles(journal))
+
+		assert.Equal(t, []InlayHint{
+			{Line: 3, Column: 27, Label: "5 €"},
+			{Line: 8, Column: 25, Label: "13 €"},
+		}, hints)
+	})
+}
@@ -1,7 +1,9 @@
 package ledger
 
 import (
+	"errors"
 	"strings"
+	"unicode"
 
 	"github.com/yeldirium/hledger-language-server/internal/lexing"
 )
@@ -36,7 +38,30 @@ func lexRoot(lexer *lexing.Lexer) lexing.StateFn {
 	}
 
 	if lexer.AssertAfter("\n") || lexer.AssertAtStart() {
-		if ok, _, err := lexer.AcceptRun(" "); err != nil {
+		if ok, _, err := lexer.AcceptFn(unicode.IsDigit); err != nil {
+			lexer.Error(err)
+			return nil
+		} else if ok {
+			return lexTransactionDate
+		}
+
+		if ok, _, err := lexer.Accept("~"); err != nil {
+			lexer.Error(err)
+			return nil
+		} else if ok {
+			lexer.Emit(lexer.Symbol("PeriodicTransactionIndicator"))
+			return lexTransactionDescription
+		}
+
+		if ok, _, err := lexer.Accept("="); err != nil {
+			lexer.Error(err)
+			return nil
+		} else if ok {
+			lexer.Emit(lexer.Symbol("AutoPostingRuleIndicator"))
+			return lexTransactionDescription
+		}
+
+		if ok, _, err := lexer.AcceptRun(" \t"); err != nil {
 			lexer.Error(err)
 			return nil
 		} else if ok {
@@ -77,6 +102,64 @@ func lexRoot(lexer *lexing.Lexer) lexing.StateFn {
 	return lexRoot
 }
 
+// lexTransactionDate expects the first digit of the date to be consumed
+// already, since that is how lexRoot recognizes a transaction header.
+func lexTransactionDate(lexer *lexing.Lexer) lexing.StateFn {
+	if _, _, err := lexer.AcceptRunFn(func(r rune) bool {
+		return unicode.IsDigit(r) || strings.ContainsRune("-/.=", r)
+	}); err != nil {
+		lexer.Error(err)
+		return nil
+	}
+	lexer.Emit(lexer.Symbol("TransactionDate"))
+
+	return lexTransactionDescription
+}
+
+// lexTransactionDescription lexes everything after the date of a transaction
+// header, or after the indicator of a periodic transaction or auto posting
+// rule, up to an inline comment or the end of the line.
+func lexTransactionDescription(lexer *lexing.Lexer) lexing.StateFn {
+	if ok, _, err := lexer.AcceptRun(" \t"); err != nil {
+		lexer.Error(err)
+		return nil
+	} else if ok {
+		lexer.Emit(lexer.Symbol("Whitespace"))
+	}
+
+	if ok, _, err := lexer.AcceptRunFn(func(r rune) bool {
+		if r == ' ' {
+			if ok, backup, _ := lexer.AcceptString(" ;"); ok {
+				backup()
+				return false
+			}
+			if ok, backup, _ := lexer.AcceptString(" #"); ok {
+				backup()
+				return false
+			}
+			return true
+		}
+		return r != '\n' && r != lexing.EOF
+	}); err != nil {
+		lexer.Error(err)
+		return nil
+	} else if ok {
+		lexer.Emit(lexer.Symbol("TransactionDescription"))
+	}
+
+	if ok, _, err := AcceptInlineCommentIndicator(lexer); err != nil {
+		if errors.Is(err, lexing.ErrEof) {
+			return lexRoot
+		}
+		lexer.Error(err)
+		return nil
+	} else if ok {
+		return lexRoot // TODO: Handle inline comment
+	}
+
+	return lexRoot
+}
+
 func lexIncludeDirective(lexer *lexing.Lexer) lexing.StateFn {
 	ok, _, _ := lexer.AcceptUntil("\n")
 	if ok {
@@ -122,7 +205,7 @@ func AcceptAccountName(lexer *lexing.Lexer) (didConsumeAccountNameSegments bool,
 				nextRune := lexer.Peek()
 				return nextRune != ' '
 			}
-			return !strings.ContainsRune("()[]:\n", r)
+			return !strings.ContainsRune("()[]:\t\n", r)
 		}); err != nil {
 			return false, nil, err
 		} else if didConsumeRunes {
@@ -183,11 +266,28 @@ func lexPosting(lexer *lexing.Lexer) lexing.StateFn {
 		lexer.Emit(lexer.Symbol("AccountNameDelimiter"))
 	}
 
-	if ok, _, err := lexer.AcceptRun(" "); err != nil {
+	if ok, _, err := AcceptInlineCommentIndicator(lexer); err != nil {
+		if errors.Is(err, lexing.ErrEof) {
+			return lexRoot
+		}
+		lexer.Error(err)
+		return nil
+	} else if ok {
+		return lexRoot // TODO: Handle inline comment
+	}
+
+	if ok, _, err := lexer.AcceptRun(" \t"); err != nil {
 		lexer.Error(err)
 		return nil
 	} else if ok {
 		lexer.Emit(lexer.Symbol("Whitespace"))
+
+		// A comment may follow the account name after more than two spaces, in
+		// which case there is no amount.
+		if ok, _, _ := lexer.Accept(";#"); ok {
+			lexer.Emit(lexer.Symbol("InlineCommentIndicator"))
+			return lexRoot // TODO: Handle inline comment
+		}
 	}
 
 	if ok, _, err := lexer.AcceptRunFn(func(r rune) bool {
@@ -256,5 +356,9 @@ func NewJournalLexer() *lexing.LexerDefinition {
 		"InlineCommentIndicator",
 		"IncludeDirective",
 		"IncludePath",
+		"TransactionDate",
+		"TransactionDescription",
+		"PeriodicTransactionIndicator",
+		"AutoPostingRuleIndicator",
 	})
 }
@@ -1,11 +1,14 @@
 package ledger
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	participleLexer "github.com/alecthomas/participle/v2/lexer"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/yeldirium/hledger-language-server/internal/journalgen"
 	"github.com/yeldirium/hledger-language-server/internal/lexing"
 	lextesting "github.com/yeldirium/hledger-language-server/internal/lexing/testing"
 )
@@ -392,6 +395,41 @@ account expenses:Food:Groceries
 			)
 		})
 
+		t.Run("lexes a posting separated from its amount by a tab.", func(t *testing.T) {
+			lextesting.AssertLexer(
+				t,
+				NewJournalLexer(),
+				lextesting.LexerInput("\texpenses:Groceries\t1,234.56 €\n"),
+				lextesting.ExpectMiniTokens([]lextesting.MiniToken{
+					{Type: "Indent", Value: "\t"},
+					{Type: "AccountNameSegment", Value: "expenses"},
+					{Type: "AccountNameSeparator", Value: ":"},
+					{Type: "AccountNameSegment", Value: "Groceries"},
+					{Type: "Whitespace", Value: "\t"},
+					{Type: "Amount", Value: "1,234.56 €"},
+					{Type: "Newline", Value: "\n"},
+				}),
+			)
+		})
+
+		t.Run("lexes a posting without an amount, but with an inline comment.", func(t *testing.T) {
+			lextesting.AssertLexer(
+				t,
+				NewJournalLexer(),
+				lextesting.LexerInput("    expenses:Groceries    ; inline comment\n"),
+				lextesting.ExpectMiniTokens([]lextesting.MiniToken{
+					{Type: "Indent", Value: "    "},
+					{Type: "AccountNameSegment", Value: "expenses"},
+					{Type: "AccountNameSeparator", Value: ":"},
+					{Type: "AccountNameSegment", Value: "Groceries"},
+					{Type: "Whitespace", Value: "    "},
+					{Type: "InlineCommentIndicator", Value: ";"},
+					{Type: "Garbage", Value: " inline comment"},
+					{Type: "Newline", Value: "\n"},
+				}),
+			)
+		})
+
 		t.Run("fails on invalid inputs.", func(t *testing.T) {
 			invalidInputs := []string{
 				"    !expenses:Groceries\n",
@@ -429,6 +467,54 @@ account expenses:Food:Groceries
 		})
 	})
 
+	t.Run("Transaction header", func(t *testing.T) {
+		t.Run("lexes the date and description of a transaction.", func(t *testing.T) {
+			lextesting.AssertLexer(
+				t,
+				NewJournalLexer(),
+				lextesting.LexerInput("2024-11-25 ! (code) Payee | transaction reason  ; inline comment\n"),
+				lextesting.ExpectMiniTokens([]lextesting.MiniToken{
+					{Type: "TransactionDate", Value: "2024-11-25"},
+					{Type: "Whitespace", Value: " "},
+					{Type: "TransactionDescription", Value: "! (code) Payee | transaction reason"},
+					{Type: "InlineCommentIndicator", Value: "  ;"},
+					{Type: "Garbage", Value: " inline comment"},
+					{Type: "Newline", Value: "\n"},
+				}),
+			)
+		})
+
+		t.Run("lexes a transaction without a description.", func(t *testing.T) {
+			lextesting.AssertLexer(
+				t,
+				NewJournalLexer(),
+				lextesting.LexerInput("2024/11/25=2024/11/27\n"),
+				lextesting.ExpectMiniTokens([]lextesting.MiniToken{
+					{Type: "TransactionDate", Value: "2024/11/25=2024/11/27"},
+					{Type: "Newline", Value: "\n"},
+				}),
+			)
+		})
+
+		t.Run("lexes periodic transactions and auto posting rules.", func(t *testing.T) {
+			lextesting.AssertLexer(
+				t,
+				NewJournalLexer(),
+				lextesting.LexerInput("~ monthly from 2024-01\n= expenses:Food\n"),
+				lextesting.ExpectMiniTokens([]lextesting.MiniToken{
+					{Type: "PeriodicTransactionIndicator", Value: "~"},
+					{Type: "Whitespace", Value: " "},
+					{Type: "TransactionDescription", Value: "monthly from 2024-01"},
+					{Type: "Newline", Value: "\n"},
+					{Type: "AutoPostingRuleIndicator", Value: "="},
+					{Type: "Whitespace", Value: " "},
+					{Type: "TransactionDescription", Value: "expenses:Food"},
+					{Type: "Newline", Value: "\n"},
+				}),
+			)
+		})
+	})
+
 	t.Run("Mixed", func(t *testing.T) {
 		t.Run("Lexes a journal file containing many different directives, postings and comments", func(t *testing.T) {
 			lextesting.AssertLexer(
@@ -497,6 +583,8 @@ commodity EUR
 					{Type: "Indent", Value: "    "},
 					{Type: "Newline", Value: "\n"},
 					{Type: "Newline", Value: "\n"},
+					{Type: "Whitespace", Value: " "},
+					{Type: "InlineCommentIndicator", Value: "  ;"},
 					{Type: "Newline", Value: "\n"},
 					{Type: "Indent", Value: "    "},
 					{Type: "AccountNameSegment", Value: "expenses"},
@@ -520,3 +608,93 @@ commodity EUR
 		})
 	})
 }
+
+// benchmarkJournal returns a journal with the given number of transactions,
+// each with a few postings, account directives and comments.
+func benchmarkJournal(transactionCount int) string {
+	var builder strings.Builder
+	builder.WriteString("include accounts.journal\n")
+	builder.WriteString("account assets:Cash\naccount expenses:Groceries  ; food\n\n")
+	for i := range transactionCount {
+		fmt.Fprintf(&builder, "2024-%02d-%02d Payee %d\n", i%12+1, i%28+1, i)
+		fmt.Fprintf(&builder, "    expenses:Groceries  %d,%02d €  ; groceries\n", i%1000, i%100)
+		builder.WriteString("    * assets:Cash\n")
+		builder.WriteString("    [budget:Food]  = 100 €\n\n")
+	}
+	return builder.String()
+}
+
+// generatedJournal returns a journal generated like the ones of
+// generate-journals, with the given number of transactions in a single file.
+func generatedJournal(transactionCount int) string {
+	options := journalgen.DefaultOptions
+	options.Transactions = transactionCount
+	options.Includes = 0
+	return journalgen.Generate(options)[journalgen.RootJournal]
+}
+
+// benchmarkInput is a journal that the lexer and the parser are benchmarked
+// on, named after the sub-benchmark.
+type benchmarkInput struct {
+	name  string
+	input string
+}
+
+// benchmarkInputs returns the hand-written and the generated journals with a
+// few and with many transactions.
+func benchmarkInputs() []benchmarkInput {
+	inputs := make([]benchmarkInput, 0)
+	for _, transactionCount := range []int{100, 10000} {
+		inputs = append(inputs, benchmarkInput{
+			name:  fmt.Sprintf("%d transactions", transactionCount),
+			input: benchmarkJournal(transactionCount),
+		})
+	}
+	for _, transactionCount := range []int{100, 10000} {
+		inputs = append(inputs, benchmarkInput{
+			name:  fmt.Sprintf("generated %d transactions", transactionCount),
+			input: generatedJournal(transactionCount),
+		})
+	}
+	return inputs
+}
+
+func BenchmarkJournalLexer(b *testing.B) {
+	lexerDefinition := NewJournalLexer()
+
+	for _, benchmarkInput := range benchmarkInputs() {
+		input := benchmarkInput.input
+
+		b.Run(benchmarkInput.name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			b.ReportAllocs()
+			for b.Loop() {
+				lexer, err := lexerDefinition.LexString("bench.journal", input)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := lexing.CollectAllLexerTokens(lexer); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkJournalParser(b *testing.B) {
+	parser := NewJournalParser()
+
+	for _, benchmarkInput := range benchmarkInputs() {
+		input := benchmarkInput.input
+
+		b.Run(benchmarkInput.name, func(b *testing.B) {
+			b.SetBytes(int64(len(input)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := parser.ParseString("bench.journal", input); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -13,7 +13,30 @@ type Entry interface {
 	value()
 }
 
+// TransactionHeader is the first line of a transaction, a periodic
+// transaction (`~`) or an auto posting rule (`=`). The postings belonging to it
+// follow as separate entries.
+type TransactionHeader struct {
+	Pos    participleLexer.Position
+	EndPos participleLexer.Position
+
+	Indicator   string `parser:"( @(PeriodicTransactionIndicator | AutoPostingRuleIndicator)"`
+	Date        string `parser:"| @TransactionDate )"`
+	Description string `parser:"@TransactionDescription? (InlineCommentIndicator Garbage?)? Newline"`
+}
+
+func (*TransactionHeader) value() {}
+
+// IsRegular reports whether the header belongs to a regular transaction, as
+// opposed to a periodic transaction or an auto posting rule.
+func (header *TransactionHeader) IsRegular() bool {
+	return header.Indicator == ""
+}
+
 type IncludeDirective struct {
+	Pos    participleLexer.Position
+	EndPos participleLexer.Position
+
 	IncludePath string `parser:"'include' Whitespace @IncludePath Newline"`
 }
 
@@ -64,7 +87,7 @@ func NewJournalParser() *JournalParser {
 	parser, err := participle.Build[Journal](
 		participle.Lexer(lexer),
 		participle.UseLookahead(3),
-		participle.Union[Entry](&IncludeDirective{}, &AccountDirective{}, &RealPosting{}, &VirtualPosting{}, &VirtualBalancedPosting{}),
+		participle.Union[Entry](&TransactionHeader{}, &IncludeDirective{}, &AccountDirective{}, &RealPosting{}, &VirtualPosting{}, &VirtualBalancedPosting{}),
 		participle.Elide("Whitespace"),
 	)
 	if err != nil {
@@ -117,6 +117,49 @@ func TestJournalParser(t *testing.T) {
 		})
 	})
 
+	t.Run("Transaction header", func(t *testing.T) {
+		t.Run("Parses transaction headers, periodic transactions and auto posting rules.", func(t *testing.T) {
+			AssertParser(
+				t,
+				NewJournalParser(),
+				ParserInput(`2024-11-25 Payee | transaction reason  ; comment
+    expenses:Groceries  10 €
+~ monthly
+    expenses:Rent  100 €
+= expenses:Food
+`),
+				ExpectAst(&Journal{
+					Entries: []Entry{
+						&TransactionHeader{
+							Date:        "2024-11-25",
+							Description: "Payee | transaction reason",
+						},
+						&RealPosting{
+							AccountName: &AccountName{
+								Segments: []string{"expenses", "Groceries"},
+							},
+							Amount: "10 €",
+						},
+						&TransactionHeader{
+							Indicator:   "~",
+							Description: "monthly",
+						},
+						&RealPosting{
+							AccountName: &AccountName{
+								Segments: []string{"expenses", "Rent"},
+							},
+							Amount: "100 €",
+						},
+						&TransactionHeader{
+							Indicator:   "=",
+							Description: "expenses:Food",
+						},
+					},
+				}),
+			)
+		})
+	})
+
 	t.Run("Mixed", func(t *testing.T) {
 		t.Run("Parses a journal file containing many different directives, postings and comments", func(t *testing.T) {
 			AssertParser(
@@ -169,6 +212,10 @@ commodity EUR
 									Segments: []string{"expenses", "Gro ce", "ries"},
 								},
 							},
+							&TransactionHeader{
+								Date:        "2024-11-25",
+								Description: "! (code) Payee | transaction reason",
+							},
 							&RealPosting{
 								PostingStatus: "",
 								AccountName: &AccountName{
@@ -183,6 +230,10 @@ commodity EUR
 								},
 								Amount: "-1,234.56 €",
 							},
+							&TransactionHeader{
+								Date:        "2024-11-25",
+								Description: "Payee | transaction reason",
+							},
 							&VirtualPosting{
 								PostingStatus: "",
 								AccountName: &AccountName{
@@ -197,6 +248,10 @@ commodity EUR
 								},
 								Amount: "= 15 €",
 							},
+							&TransactionHeader{
+								Date:        "2024-12-01",
+								Description: "Payee | posting with trailing whitespace",
+							},
 							&RealPosting{
 								AccountName: &AccountName{
 									Segments: []string{"expenses", "Groceries"},
@@ -0,0 +1,105 @@
+package ledger
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// ColumnEdit replaces the runes from StartColumn up to, but excluding,
+// EndColumn on a line. Line and columns are 1-based.
+type ColumnEdit struct {
+	Line        int
+	StartColumn int
+	EndColumn   int
+	NewText     string
+}
+
+// NewLineIndentEdit returns an edit that replaces the leading whitespace of the
+// given 1-based line with the posting indent, if the line follows a transaction
+// header or a posting.
+func NewLineIndentEdit(input string, options FormatOptions, line int) (ColumnEdit, bool) {
+	if options.PostingIndent == "" {
+		options.PostingIndent = DefaultFormatOptions().PostingIndent
+	}
+
+	rawLines := strings.Split(input, "\n")
+	if line < 2 || line > len(rawLines) {
+		return ColumnEdit{}, false
+	}
+
+	previousLine := classifyLine(rawLines[line-2])
+	if previousLine.kind != lineTransactionHeader && previousLine.kind != linePosting {
+		return ColumnEdit{}, false
+	}
+
+	currentLine := strings.TrimSuffix(rawLines[line-1], "\r")
+	leadingWhitespace := currentLine[:len(currentLine)-len(strings.TrimLeft(currentLine, " \t"))]
+	if leadingWhitespace == options.PostingIndent {
+		return ColumnEdit{}, false
+	}
+
+	return ColumnEdit{
+		Line:        line,
+		StartColumn: 1,
+		EndColumn:   utf8.RuneCountInString(leadingWhitespace) + 1,
+		NewText:     options.PostingIndent,
+	}, true
+}
+
+// AmountColumnEdit returns an edit that replaces the whitespace between the
+// account name of the posting on the given line and the cursor, so that the
+// cursor ends up in the column that the amounts of the transaction are aligned
+// in. The cursor column is 1-based. There is no edit if the posting already
+// has an amount or if the cursor is not right after the separator that
+// follows the account name.
+func AmountColumnEdit(input string, options FormatOptions, line, cursorColumn int) (ColumnEdit, bool) {
+	if options.PostingIndent == "" {
+		options.PostingIndent = DefaultFormatOptions().PostingIndent
+	}
+
+	lines := classifyLines(input)
+	if line < 1 || line > len(lines) {
+		return ColumnEdit{}, false
+	}
+
+	currentLine := lines[line-1]
+	if currentLine.kind != linePosting || currentLine.amount != "" || currentLine.comment != "" {
+		return ColumnEdit{}, false
+	}
+
+	content := []rune(strings.TrimSuffix(currentLine.text, "\r"))
+	if cursorColumn-1 != len(content) {
+		return ColumnEdit{}, false
+	}
+
+	accountEnd := len([]rune(strings.TrimRight(string(content), " \t")))
+	separator := string(content[accountEnd:])
+	if separator != amountSeparator && !strings.Contains(separator, "\t") {
+		return ColumnEdit{}, false
+	}
+
+	layout := amountLayout{}
+	for _, block := range transactionBlocks(lines) {
+		if options.AlignAcrossFile || (block.start < line && line <= block.end) {
+			layout.extend(lines[block.start:block.end])
+		}
+	}
+	layout.accountWidth = max(layout.accountWidth, utf8.RuneCountInString(currentLine.account))
+
+	indentWidth := len(content) - len([]rune(strings.TrimLeft(string(content), " \t")))
+	layout.reachAmountColumn(options, indentWidth)
+	amountColumn := indentWidth + layout.accountWidth + len(amountSeparator)
+	padding := max(amountColumn-accountEnd, len(amountSeparator))
+
+	newText := strings.Repeat(" ", padding)
+	if newText == separator {
+		return ColumnEdit{}, false
+	}
+
+	return ColumnEdit{
+		Line:        line,
+		StartColumn: accountEnd + 1,
+		EndColumn:   cursorColumn,
+		NewText:     newText,
+	}, true
+}
@@ -0,0 +1,85 @@
+package ledger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLineIndentEdit(t *testing.T) {
+	t.Run("indents a new line after a transaction header.", func(t *testing.T) {
+		input := "2024-11-25 Payee\n\n"
+
+		edit, ok := NewLineIndentEdit(input, DefaultFormatOptions(), 2)
+
+		assert.True(t, ok)
+		assert.Equal(t, ColumnEdit{Line: 2, StartColumn: 1, EndColumn: 1, NewText: "    "}, edit)
+	})
+
+	t.Run("replaces the indent the editor inserted after a posting.", func(t *testing.T) {
+		input := "2024-11-25 Payee\n  expenses:Food  10 €\n  \n"
+
+		edit, ok := NewLineIndentEdit(input, DefaultFormatOptions(), 3)
+
+		assert.True(t, ok)
+		assert.Equal(t, ColumnEdit{Line: 3, StartColumn: 1, EndColumn: 3, NewText: "    "}, edit)
+	})
+
+	t.Run("does nothing after lines that are not part of a transaction.", func(t *testing.T) {
+		input := "account assets:Cash\n\n"
+
+		_, ok := NewLineIndentEdit(input, DefaultFormatOptions(), 2)
+
+		assert.False(t, ok)
+	})
+
+	t.Run("does nothing if the line is already indented correctly.", func(t *testing.T) {
+		input := "2024-11-25 Payee\n    \n"
+
+		_, ok := NewLineIndentEdit(input, DefaultFormatOptions(), 2)
+
+		assert.False(t, ok)
+	})
+}
+
+func TestAmountColumnEdit(t *testing.T) {
+	t.Run("moves the cursor to the amount column of the transaction after two spaces.", func(t *testing.T) {
+		input := "2024-11-25 Payee\n    expenses:Groceries  10 €\n    assets:Cash  \n"
+
+		edit, ok := AmountColumnEdit(input, DefaultFormatOptions(), 3, 18)
+
+		assert.True(t, ok)
+		assert.Equal(t, ColumnEdit{Line: 3, StartColumn: 16, EndColumn: 18, NewText: "         "}, edit)
+	})
+
+	t.Run("replaces a tab after the account name.", func(t *testing.T) {
+		input := "2024-11-25 Payee\n    expenses:Groceries\t\n"
+
+		edit, ok := AmountColumnEdit(input, DefaultFormatOptions(), 2, 24)
+
+		assert.True(t, ok)
+		assert.Equal(t, ColumnEdit{Line: 2, StartColumn: 23, EndColumn: 24, NewText: "  "}, edit)
+	})
+
+	t.Run("moves the cursor to the configured amount column.", func(t *testing.T) {
+		input := "2024-11-25 Payee\n    assets:Cash  \n"
+
+		options := DefaultFormatOptions()
+		options.AmountColumn = 25
+		edit, ok := AmountColumnEdit(input, options, 2, 18)
+
+		assert.True(t, ok)
+		assert.Equal(t, ColumnEdit{Line: 2, StartColumn: 16, EndColumn: 18, NewText: strings.Repeat(" ", 9)}, edit)
+	})
+
+	t.Run("does nothing if the cursor is not right after the account name and separator.", func(t *testing.T) {
+		input := "2024-11-25 Payee\n    expenses:Groceries  10 €\n    assets:Cash \n"
+
+		_, ok := AmountColumnEdit(input, DefaultFormatOptions(), 3, 17)
+		assert.False(t, ok)
+
+		_, ok = AmountColumnEdit(input, DefaultFormatOptions(), 2, 25)
+		assert.False(t, ok)
+	})
+}
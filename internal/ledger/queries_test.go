@@ -176,3 +176,40 @@ func TestFilterAccountNamesByPrefix(t *testing.T) {
 		}
 	})
 }
+
+func BenchmarkAccountNames(b *testing.B) {
+	journal, err := NewJournalParser().ParseString("bench.journal", generatedJournal(10000))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for b.Loop() {
+		AccountNames(journal)
+	}
+}
+
+func BenchmarkFilterAccountNamesByPrefix(b *testing.B) {
+	journal, err := NewJournalParser().ParseString("bench.journal", generatedJournal(10000))
+	if err != nil {
+		b.Fatal(err)
+	}
+	accountNames := AccountNames(journal)
+
+	queries := []struct {
+		name  string
+		query *AccountName
+	}{
+		{name: "no query", query: nil},
+		{name: "one segment", query: &AccountName{Segments: []string{"exp"}}},
+		{name: "two segments", query: &AccountName{Segments: []string{"exp", "Cat"}}},
+	}
+	for _, query := range queries {
+		b.Run(query.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				FilterAccountNamesByPrefix(accountNames, query.query)
+			}
+		})
+	}
+}
@@ -0,0 +1,326 @@
+package ledger
+
+import (
+	"math/big"
+	"slices"
+
+	participleLexer "github.com/alecthomas/participle/v2/lexer"
+)
+
+// Posting gives uniform access to RealPosting, VirtualPosting and
+// VirtualBalancedPosting.
+type Posting interface {
+	Entry
+	Account() *AccountName
+	AmountText() string
+	// AmountPos is where the amount of the posting starts, or where it would
+	// be inserted if the posting has none.
+	AmountPos() participleLexer.Position
+}
+
+func (posting *RealPosting) Account() *AccountName { return posting.AccountName }
+func (posting *RealPosting) AmountText() string    { return posting.Amount }
+func (posting *RealPosting) AmountPos() participleLexer.Position {
+	return posting.AccountName.EndPos
+}
+
+func (posting *VirtualPosting) Account() *AccountName { return posting.AccountName }
+func (posting *VirtualPosting) AmountText() string    { return posting.Amount }
+func (posting *VirtualPosting) AmountPos() participleLexer.Position {
+	return afterClosingDelimiter(posting.AccountName.EndPos)
+}
+
+func (posting *VirtualBalancedPosting) Account() *AccountName { return posting.AccountName }
+func (posting *VirtualBalancedPosting) AmountText() string    { return posting.Amount }
+func (posting *VirtualBalancedPosting) AmountPos() participleLexer.Position {
+	return afterClosingDelimiter(posting.AccountName.EndPos)
+}
+
+func afterClosingDelimiter(pos participleLexer.Position) participleLexer.Position {
+	pos.Advance(")")
+	return pos
+}
+
+// Transaction is a regular transaction header together with its postings.
+type Transaction struct {
+	Header   *TransactionHeader
+	Postings []Posting
+}
+
+// Transactions groups the postings of a journal into the transactions they
+// belong to. Periodic transactions and auto posting rules are skipped, since
+// their postings are templates rather than actual postings.
+func Transactions(journal *Journal) []Transaction {
+	transactions := make([]Transaction, 0)
+
+	var current *Transaction
+	for _, entry := range journal.Entries {
+		switch entry := entry.(type) {
+		case *TransactionHeader:
+			if current != nil {
+				transactions = append(transactions, *current)
+				current = nil
+			}
+			if entry.IsRegular() {
+				current = &Transaction{Header: entry, Postings: make([]Posting, 0)}
+			}
+		case Posting:
+			if current != nil {
+				current.Postings = append(current.Postings, entry)
+			}
+		default:
+			if current != nil {
+				transactions = append(transactions, *current)
+				current = nil
+			}
+		}
+	}
+	if current != nil {
+		transactions = append(transactions, *current)
+	}
+
+	return transactions
+}
+
+// EndLine returns the 1-based line of the last posting of the transaction, or
+// of its header if there are no postings.
+func (transaction Transaction) EndLine() int {
+	if len(transaction.Postings) == 0 {
+		return transaction.Header.Pos.Line
+	}
+	return transaction.Postings[len(transaction.Postings)-1].Account().Pos.Line
+}
+
+// MixedAmount holds quantities of multiple commodities.
+type MixedAmount map[string]*big.Rat
+
+func (mixedAmount MixedAmount) Add(quantity *big.Rat, commodity string) {
+	sum, ok := mixedAmount[commodity]
+	if !ok {
+		sum = new(big.Rat)
+		mixedAmount[commodity] = sum
+	}
+	sum.Add(sum, quantity)
+}
+
+func (mixedAmount MixedAmount) AddMixed(other MixedAmount) {
+	for commodity, quantity := range other {
+		mixedAmount.Add(quantity, commodity)
+	}
+}
+
+func (mixedAmount MixedAmount) Neg() MixedAmount {
+	negated := make(MixedAmount, len(mixedAmount))
+	for commodity, quantity := range mixedAmount {
+		negated[commodity] = new(big.Rat).Neg(quantity)
+	}
+	return negated
+}
+
+// Commodities returns the commodities of all non-zero quantities, sorted.
+func (mixedAmount MixedAmount) Commodities() []string {
+	commodities := make([]string, 0, len(mixedAmount))
+	for commodity, quantity := range mixedAmount {
+		if quantity.Sign() != 0 {
+			commodities = append(commodities, commodity)
+		}
+	}
+	slices.Sort(commodities)
+	return commodities
+}
+
+func (mixedAmount MixedAmount) IsZero() bool {
+	return len(mixedAmount.Commodities()) == 0
+}
+
+// Format writes every non-zero quantity using the style of its commodity.
+// Commodities without a style are written with the given fallback style.
+func (mixedAmount MixedAmount) Format(styles map[string]AmountStyle, fallback AmountStyle) []string {
+	commodities := mixedAmount.Commodities()
+	amounts := make([]string, len(commodities))
+	for i, commodity := range commodities {
+		style, ok := styles[commodity]
+		if !ok {
+			style = fallback
+		}
+		amounts[i] = style.Format(mixedAmount[commodity], commodity)
+	}
+	return amounts
+}
+
+// BalanceGroup is a set of postings of a transaction that have to balance each
+// other. Real postings and balanced virtual postings are balanced separately.
+type BalanceGroup struct {
+	// Residual is the sum of all postings with an amount.
+	Residual MixedAmount
+	// Amountless are the postings without an amount.
+	Amountless []Posting
+	// Unassigned are the balance assignments whose amount is not known, since
+	// it depends on the running balance of their account.
+	Unassigned []Posting
+	// Precisions holds the largest precision of each commodity in the group,
+	// not counting costs.
+	// Residuals smaller than that precision are considered to be zero.
+	Precisions map[string]int
+
+	postings []Posting
+}
+
+func newBalanceGroup() BalanceGroup {
+	return BalanceGroup{
+		Residual:   make(MixedAmount),
+		Amountless: make([]Posting, 0),
+		Unassigned: make([]Posting, 0),
+		Precisions: make(map[string]int),
+		postings:   make([]Posting, 0),
+	}
+}
+
+func (group *BalanceGroup) add(posting Posting, postingAmount PostingAmount, assignedAmounts map[Posting]MixedAmount) {
+	group.postings = append(group.postings, posting)
+
+	if postingAmount.IsEmpty() {
+		group.Amountless = append(group.Amountless, posting)
+		return
+	}
+	if postingAmount.IsAssignment() {
+		assignedAmount, ok := assignedAmounts[posting]
+		if !ok {
+			group.Unassigned = append(group.Unassigned, posting)
+			return
+		}
+		group.Residual.AddMixed(assignedAmount)
+		commodity := postingAmount.Assertion.Commodity
+		group.Precisions[commodity] = max(group.Precisions[commodity], postingAmount.Assertion.Style.Precision)
+		return
+	}
+
+	quantity, commodity := postingAmount.Balance()
+	group.Residual.Add(quantity, commodity)
+
+	// Like in hledger, the precision of costs does not count, since costs are
+	// often written more precisely than the converted amount.
+	if postingAmount.Cost == nil {
+		group.Precisions[commodity] = max(group.Precisions[commodity], postingAmount.Amount.Style.Precision)
+	}
+}
+
+// RoundedResidual returns the residual with all quantities that are too small
+// to be displayed removed.
+func (group BalanceGroup) RoundedResidual() MixedAmount {
+	rounded := make(MixedAmount)
+	for commodity, quantity := range group.Residual {
+		threshold := new(big.Rat).SetFrac(big.NewInt(1), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(group.Precisions[commodity])), nil))
+		threshold.Quo(threshold, big.NewRat(2, 1))
+		if new(big.Rat).Abs(quantity).Cmp(threshold) >= 0 {
+			rounded[commodity] = new(big.Rat).Set(quantity)
+		}
+	}
+	return rounded
+}
+
+// IsBalanced reports whether the postings of the group balance, either because
+// their amounts sum up to zero or because a single amountless posting can take
+// up the residual. Groups with balance assignments of unknown amount are
+// assumed to balance.
+func (group BalanceGroup) IsBalanced() bool {
+	switch len(group.Amountless) {
+	case 0:
+		return len(group.Unassigned) > 0 || group.RoundedResidual().IsZero()
+	case 1:
+		return true
+	default:
+		return false
+	}
+}
+
+// InferredAmount returns the amount that hledger infers for the only
+// amountless posting of the group.
+func (group BalanceGroup) InferredAmount() (Posting, MixedAmount, bool) {
+	if len(group.Amountless) != 1 || len(group.Unassigned) != 0 {
+		return nil, nil, false
+	}
+	return group.Amountless[0], group.RoundedResidual().Neg(), true
+}
+
+type TransactionBalance struct {
+	Real    BalanceGroup
+	Virtual BalanceGroup
+}
+
+func (balance TransactionBalance) IsBalanced() bool {
+	return balance.Real.IsBalanced() && balance.Virtual.IsBalanced()
+}
+
+// Balance sums up the postings of the transaction. Unbalanced virtual postings
+// are ignored. It fails if the amount of a posting can not be parsed.
+func (transaction Transaction) Balance() (TransactionBalance, error) {
+	return transaction.BalanceWith(nil)
+}
+
+// BalanceWith sums up the postings of the transaction like Balance, using the
+// given amounts for its balance assignments.
+func (transaction Transaction) BalanceWith(assignedAmounts map[Posting]MixedAmount) (TransactionBalance, error) {
+	balance := TransactionBalance{
+		Real:    newBalanceGroup(),
+		Virtual: newBalanceGroup(),
+	}
+
+	for _, posting := range transaction.Postings {
+		postingAmount, err := ParsePostingAmount(posting.AmountText())
+		if err != nil {
+			return TransactionBalance{}, err
+		}
+
+		switch posting.(type) {
+		case *RealPosting:
+			balance.Real.add(posting, postingAmount, assignedAmounts)
+		case *VirtualBalancedPosting:
+			balance.Virtual.add(posting, postingAmount, assignedAmounts)
+		}
+	}
+
+	return balance, nil
+}
+
+// CommodityStyles returns the style that each commodity is written in
+// throughout the journal. Like hledger, it uses the first style found for each
+// commodity, with the largest precision found.
+func CommodityStyles(journal *Journal) map[string]AmountStyle {
+	styles := make(map[string]AmountStyle)
+
+	addStyle := func(amount *Amount) {
+		if amount == nil {
+			return
+		}
+		style, ok := styles[amount.Commodity]
+		if !ok {
+			styles[amount.Commodity] = amount.Style
+			return
+		}
+		style.Precision = max(style.Precision, amount.Style.Precision)
+		if style.DecimalMark == 0 {
+			style.DecimalMark = amount.Style.DecimalMark
+		}
+		if style.DigitGroupMark == 0 {
+			style.DigitGroupMark = amount.Style.DigitGroupMark
+		}
+		styles[amount.Commodity] = style
+	}
+
+	for _, entry := range journal.Entries {
+		posting, ok := entry.(Posting)
+		if !ok {
+			continue
+		}
+		postingAmount, err := ParsePostingAmount(posting.AmountText())
+		if err != nil {
+			continue
+		}
+		addStyle(postingAmount.Amount)
+		addStyle(postingAmount.Cost)
+		addStyle(postingAmount.Assertion)
+	}
+
+	return styles
+}
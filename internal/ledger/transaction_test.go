@@ -0,0 +1,188 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseTestJournal(t *testing.T, input string) *Journal {
+	t.Helper()
+
+	journal, err := NewJournalParser().ParseString("test.journal", input)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return journal
+}
+
+func TestTransactions(t *testing.T) {
+	t.Run("groups postings into the transactions they follow.", func(t *testing.T) {
+		journal := parseTestJournal(t, `account assets:Cash
+
+2024-11-25 Payee
+    expenses:Groceries  10 €
+    assets:Cash
+
+2024-11-26 Another payee
+    expenses:Rent  100 €
+    assets:Checking
+`)
+
+		transactions := Transactions(journal)
+
+		assert.Len(t, transactions, 2)
+		assert.Equal(t, "Payee", transactions[0].Header.Description)
+		assert.Len(t, transactions[0].Postings, 2)
+		assert.Equal(t, "expenses:Groceries", transactions[0].Postings[0].Account().String())
+		assert.Equal(t, 5, transactions[0].EndLine())
+		assert.Equal(t, "Another payee", transactions[1].Header.Description)
+		assert.Len(t, transactions[1].Postings, 2)
+	})
+
+	t.Run("skips periodic transactions and auto posting rules.", func(t *testing.T) {
+		journal := parseTestJournal(t, `~ monthly
+    expenses:Rent  100 €
+    assets:Checking
+= expenses:Food
+    (budget:Food)  -1
+2024-11-25 Payee
+    expenses:Groceries  10 €
+    assets:Cash
+`)
+
+		transactions := Transactions(journal)
+
+		assert.Len(t, transactions, 1)
+		assert.Equal(t, "Payee", transactions[0].Header.Description)
+	})
+}
+
+func TestTransactionBalance(t *testing.T) {
+	t.Run("is balanced if all amounts sum up to zero.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10.50 €
+    assets:Cash  -10.5 €
+`)
+
+		balance, err := Transactions(journal)[0].Balance()
+
+		assert.NoError(t, err)
+		assert.True(t, balance.IsBalanced())
+	})
+
+	t.Run("is balanced if a single posting has no amount and infers its amount.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10.50 €
+    expenses:Snacks  $2
+    assets:Cash
+`)
+
+		balance, err := Transactions(journal)[0].Balance()
+
+		assert.NoError(t, err)
+		assert.True(t, balance.IsBalanced())
+
+		posting, inferredAmount, ok := balance.Real.InferredAmount()
+		assert.True(t, ok)
+		assert.Equal(t, "assets:Cash", posting.Account().String())
+		assert.Equal(t, []string{"$-2", "-10.50 €"}, inferredAmount.Format(CommodityStyles(journal), AmountStyle{}))
+	})
+
+	t.Run("is unbalanced if the amounts do not sum up to zero.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10.50 €
+    assets:Cash  -10 €
+`)
+
+		balance, err := Transactions(journal)[0].Balance()
+
+		assert.NoError(t, err)
+		assert.False(t, balance.IsBalanced())
+		assert.Equal(t, []string{"0.50 €"}, balance.Real.RoundedResidual().Format(CommodityStyles(journal), AmountStyle{}))
+	})
+
+	t.Run("is unbalanced if multiple postings have no amount.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries
+    assets:Cash
+`)
+
+		balance, err := Transactions(journal)[0].Balance()
+
+		assert.NoError(t, err)
+		assert.False(t, balance.IsBalanced())
+	})
+
+	t.Run("does not count balance assignments as postings without an amount.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-01-01 Opening balances
+    assets:Bank  = $100
+    equity:Opening
+`)
+
+		balance, err := Transactions(journal)[0].Balance()
+
+		assert.NoError(t, err)
+		assert.True(t, balance.IsBalanced())
+		assert.Len(t, balance.Real.Amountless, 1)
+		assert.Len(t, balance.Real.Unassigned, 1)
+		_, _, ok := balance.Real.InferredAmount()
+		assert.False(t, ok)
+	})
+
+	t.Run("balances real and balanced virtual postings separately and ignores unbalanced virtual postings.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10 €
+    assets:Cash
+    [budget:Food]  -10 €
+    [budget:Available]  10 €
+    (tracking:Food)  1
+`)
+
+		balance, err := Transactions(journal)[0].Balance()
+
+		assert.NoError(t, err)
+		assert.True(t, balance.IsBalanced())
+		assert.Len(t, balance.Virtual.Amountless, 0)
+	})
+
+	t.Run("uses costs and ignores residuals below the precision of the commodity.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Exchange
+    assets:Crypto  3 BTC @ 1.333 €
+    assets:Cash  -4.00 €
+`)
+
+		balance, err := Transactions(journal)[0].Balance()
+
+		assert.NoError(t, err)
+		assert.True(t, balance.IsBalanced())
+	})
+
+	t.Run("fails if an amount can not be parsed.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  10 € 20
+    assets:Cash
+`)
+
+		_, err := Transactions(journal)[0].Balance()
+
+		assert.ErrorIs(t, err, ErrInvalidAmount)
+	})
+}
+
+func TestCommodityStyles(t *testing.T) {
+	t.Run("uses the first style of each commodity with the largest precision.", func(t *testing.T) {
+		journal := parseTestJournal(t, `2024-11-25 Payee
+    expenses:Groceries  1.000,5 €
+    assets:Cash  -1000,500 €
+    assets:Checking  $5
+`)
+
+		styles := CommodityStyles(journal)
+
+		assert.Equal(t, map[string]AmountStyle{
+			"€": {CommoditySpaced: true, DecimalMark: ',', DigitGroupMark: '.', Precision: 3},
+			"$": {CommodityOnLeft: true},
+		}, styles)
+	})
+}
@@ -12,6 +12,12 @@ import (
 func pruneMetadataFromAst(ast *Journal) {
 	for _, entry := range ast.Entries {
 		switch entry := entry.(type) {
+		case *TransactionHeader:
+			entry.Pos = participleLexer.Position{}
+			entry.EndPos = participleLexer.Position{}
+		case *IncludeDirective:
+			entry.Pos = participleLexer.Position{}
+			entry.EndPos = participleLexer.Position{}
 		case *AccountDirective:
 			entry.AccountName.Pos = participleLexer.Position{}
 			entry.AccountName.EndPos = participleLexer.Position{}
@@ -58,7 +58,8 @@ type LexerDefinition struct {
 }
 
 // LexString instantiates a new lexer, which can then be used to iterate over
-// the input and emit tokens.
+// the input and emit tokens. The lexer runs its state functions only when
+// tokens are requested.
 func (lexerDefinition *LexerDefinition) LexString(filename string, input string) (*Lexer, error) {
 	l := &Lexer{
 		name:       filename,
@@ -66,11 +67,9 @@ func (lexerDefinition *LexerDefinition) LexString(filename string, input string)
 		input:      input,
 		start:      participleLexer.Position{Filename: filename, Line: 1, Column: 1, Offset: 0},
 		pos:        participleLexer.Position{Filename: filename, Line: 1, Column: 1, Offset: 0},
-		tokens:     make(chan participleLexer.Token),
+		state:      lexerDefinition.initialState,
 	}
 
-	go l.run(lexerDefinition.initialState)
-
 	return l, nil
 }
 
@@ -105,10 +104,12 @@ type BackupFn func()
 type Lexer struct {
 	name       string // used only for error reports
 	definition *LexerDefinition
-	input      string                     // the string being lexed
-	start      participleLexer.Position   // start of the current token
-	pos        participleLexer.Position   // current position in the input
-	tokens     chan participleLexer.Token // channel of lexed tokens
+	input      string                   // the string being lexed
+	start      participleLexer.Position // start of the current token
+	pos        participleLexer.Position // current position in the input
+	state      StateFn                  // the state function to run next, nil once lexing is done
+	tokens     []participleLexer.Token  // tokens emitted but not yet returned by Next
+	nextToken  int                      // index of the token Next returns next
 }
 
 // NewLexer creates a new lexer instance by hand.
@@ -120,15 +121,17 @@ func NewLexer(
 	input string,
 	start participleLexer.Position,
 	pos participleLexer.Position,
-	tokens chan participleLexer.Token,
+	state StateFn,
+	bufferSize uint,
 ) *Lexer {
 	return &Lexer{
-		name,
-		definition,
-		input,
-		start,
-		pos,
-		tokens,
+		name:       name,
+		definition: definition,
+		input:      input,
+		start:      start,
+		pos:        pos,
+		state:      state,
+		tokens:     make([]participleLexer.Token, 0, bufferSize),
 	}
 }
 
@@ -143,19 +146,13 @@ func PrepareLexer(input string, tokenNames []string, rootState StateFn, bufferSi
 		input,
 		participleLexer.Position{Filename: filename, Line: 1, Column: 1, Offset: 0},
 		participleLexer.Position{Filename: filename, Line: 1, Column: 1, Offset: 0},
-		make(chan participleLexer.Token, bufferSize),
+		rootState,
+		bufferSize,
 	)
 
 	return lexer, filename
 }
 
-func (lexer *Lexer) run(initialState StateFn) {
-	for state := initialState; state != nil; {
-		state = state(lexer)
-	}
-	close(lexer.tokens)
-}
-
 func (lexer *Lexer) Start() participleLexer.Position {
 	return lexer.start
 }
@@ -164,14 +161,25 @@ func (lexer *Lexer) Pos() participleLexer.Position {
 	return lexer.pos
 }
 
+// Next runs state functions until one of them emits a token, and returns the
+// tokens in the order they were emitted.
 func (lexer *Lexer) Next() (participleLexer.Token, error) {
-	token, ok := <-lexer.tokens
-	if !ok {
-		return participleLexer.Token{
-			Type: participleLexer.EOF,
-		}, nil
+	for lexer.nextToken == len(lexer.tokens) {
+		// All buffered tokens were returned, so the buffer can be reused.
+		lexer.tokens = lexer.tokens[:0]
+		lexer.nextToken = 0
+
+		if lexer.state == nil {
+			return participleLexer.Token{
+				Type: participleLexer.EOF,
+			}, nil
+		}
+		lexer.state = lexer.state(lexer)
 	}
 
+	token := lexer.tokens[lexer.nextToken]
+	lexer.nextToken += 1
+
 	if token.Type == symbolError {
 		return token, errors.New(token.Value)
 	}
@@ -185,21 +193,28 @@ func (lexer *Lexer) Symbol(name string) participleLexer.TokenType {
 
 func (lexer *Lexer) NextRune() (rune, BackupFn) {
 	backup := lexer.NewBackup()
+	return lexer.advance(), backup
+}
 
+// advance moves the position past the next rune and returns it. Unlike
+// NextRune it does not allocate a backup, so loops over many runes restore the
+// position themselves.
+func (lexer *Lexer) advance() rune {
 	if lexer.pos.Offset >= len(lexer.input) {
-		return EOF, backup
+		return EOF
 	}
 
 	// TODO: handle potential encoding error
 	rune, _ := utf8.DecodeRuneInString(lexer.input[lexer.pos.Offset:])
 	lexer.pos.Advance(string(rune))
 
-	return rune, backup
+	return rune
 }
 
 func (lexer *Lexer) Peek() rune {
-	rune, backup := lexer.NextRune()
-	backup()
+	pos := lexer.pos
+	rune := lexer.advance()
+	lexer.pos = pos
 	return rune
 }
 
@@ -211,11 +226,11 @@ func (lexer *Lexer) NewBackup() BackupFn {
 }
 
 func (lexer *Lexer) Emit(t participleLexer.TokenType) {
-	lexer.tokens <- participleLexer.Token{
+	lexer.tokens = append(lexer.tokens, participleLexer.Token{
 		Type:  t,
 		Value: lexer.input[lexer.start.Offset:lexer.pos.Offset],
 		Pos:   lexer.start,
-	}
+	})
 	lexer.start = lexer.pos
 }
 
@@ -223,22 +238,20 @@ func (lexer *Lexer) Ignore() {
 	lexer.start = lexer.pos
 }
 
+// Error emits an error token and stops the lexer.
 func (lexer *Lexer) Error(err error) StateFn {
-	lexer.tokens <- participleLexer.Token{
+	lexer.tokens = append(lexer.tokens, participleLexer.Token{
 		Type:  symbolError,
 		Value: err.Error(),
 		Pos:   lexer.start,
-	}
+	})
+	lexer.state = nil
 	return nil
 }
 
+// Errorf emits an error token with the formatted message and stops the lexer.
 func (lexer *Lexer) Errorf(format string, args ...interface{}) StateFn {
-	lexer.tokens <- participleLexer.Token{
-		Type:  symbolError,
-		Value: fmt.Sprintf(format, args...),
-		Pos:   lexer.start,
-	}
-	return nil
+	return lexer.Error(errors.New(fmt.Sprintf(format, args...)))
 }
 
 func (lexer *Lexer) AcceptEof() (bool, BackupFn) {
@@ -294,9 +307,10 @@ func (lexer *Lexer) AcceptRun(valid string) (didConsumeRunes bool, backup Backup
 
 	didConsumeRunes = false
 	for {
-		rune, backupOnce := lexer.NextRune()
+		pos := lexer.pos
+		rune := lexer.advance()
 		if !strings.ContainsRune(valid, rune) {
-			backupOnce()
+			lexer.pos = pos
 			break
 		}
 		didConsumeRunes = true
@@ -311,9 +325,10 @@ func (lexer *Lexer) AcceptRunFn(predicate func(rune) bool) (didConsumeRunes bool
 
 	didConsumeRunes = false
 	for {
-		rune, backupOnce := lexer.NextRune()
+		pos := lexer.pos
+		rune := lexer.advance()
 		if !predicate(rune) {
-			backupOnce()
+			lexer.pos = pos
 			break
 		}
 		didConsumeRunes = true
@@ -326,9 +341,10 @@ func (lexer *Lexer) AcceptUntil(invalid string) (didConsumeRunes bool, backup Ba
 
 	didConsumeRunes = false
 	for {
-		rune, backupOnce := lexer.NextRune()
+		pos := lexer.pos
+		rune := lexer.advance()
 		if strings.ContainsRune(invalid, rune) || rune == EOF {
-			backupOnce()
+			lexer.pos = pos
 			break
 		}
 		didConsumeRunes = true
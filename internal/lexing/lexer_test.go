@@ -98,6 +98,36 @@ func TestLexer(t *testing.T) {
 				token, _ := lexer.Next()
 				assert.Equal(t, participleLexer.EOF, token.Type)
 			})
+
+			t.Run("runs state functions only when the next token is requested.", func(t *testing.T) {
+				stateCalls := 0
+				var rootState StateFn
+				rootState = func(lexer *Lexer) StateFn {
+					stateCalls += 1
+					ok, _ := lexer.AcceptEof()
+					if ok {
+						return nil
+					}
+					lexer.NextRune()
+					lexer.Emit(1337)
+					return rootState
+				}
+
+				lexerDefinition := NewLexerDefinition(
+					rootState,
+					[]string{
+						"Char",
+					},
+				)
+				lexer, err := lexerDefinition.LexString("testFile", "foo")
+				assert.NoError(t, err)
+				assert.Equal(t, 0, stateCalls)
+
+				token, err := lexer.Next()
+				assert.NoError(t, err)
+				assert.Equal(t, "f", token.Value)
+				assert.Equal(t, 1, stateCalls)
+			})
 		})
 	})
 
@@ -155,9 +185,7 @@ func TestLexer(t *testing.T) {
 				ok, _, err := lexer.AcceptString("foo")
 				assert.NoError(t, err)
 				assert.True(t, ok)
-				go func() {
-					lexer.Emit(lexer.Symbol("String"))
-				}()
+				lexer.Emit(lexer.Symbol("String"))
 
 				token, _ := lexer.Next()
 				assert.Equal(t, participleLexer.Token{Type: lexer.Symbol("String"), Value: "foo", Pos: participleLexer.Position{Filename: filename, Line: 1, Column: 1, Offset: 0}}, token)
@@ -183,9 +211,7 @@ func TestLexer(t *testing.T) {
 			t.Run("emits an error token with the given message.", func(t *testing.T) {
 				lexer, _ := PrepareLexer("foo", []string{"String"}, nil, 0)
 
-				go func() {
-					lexer.Errorf("something went wrong")
-				}()
+				lexer.Errorf("something went wrong")
 
 				_, err := lexer.Next()
 				assert.ErrorContains(t, err, "something went wrong")
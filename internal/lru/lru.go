@@ -0,0 +1,185 @@
+// Package lru implements a least recently used cache with limits on the number
+// of entries and on their total size. The cache is not safe for concurrent use,
+// callers have to synchronise access themselves.
+package lru
+
+import (
+	"container/list"
+)
+
+// Limits bound a cache. A limit of zero means no limit.
+type Limits struct {
+	MaxEntries int
+	MaxBytes   int
+}
+
+// Stats counts how the cache has been used.
+type Stats struct {
+	Hits      int
+	Misses    int
+	Evictions int
+	Entries   int
+	Bytes     int
+}
+
+type entry[K comparable, V any] struct {
+	key    K
+	value  V
+	size   int
+	pinned bool
+}
+
+// Cache evicts the least recently used entries once it exceeds its limits.
+// Pinned entries are never evicted, so a cache may exceed its limits if it
+// holds too many of them.
+type Cache[K comparable, V any] struct {
+	limits  Limits
+	entries map[K]*list.Element
+	order   *list.List
+	bytes   int
+	stats   Stats
+	onEvict func(key K, value V)
+}
+
+func New[K comparable, V any](limits Limits) *Cache[K, V] {
+	return &Cache[K, V]{
+		limits:  limits,
+		entries: make(map[K]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// SetLimits changes the limits and evicts entries until the cache is within
+// them.
+func (cache *Cache[K, V]) SetLimits(limits Limits) {
+	cache.limits = limits
+	cache.evict()
+}
+
+// OnEvict sets a function that is called with every entry evicted to stay
+// within the limits, but not with entries that are removed or replaced.
+func (cache *Cache[K, V]) OnEvict(onEvict func(key K, value V)) {
+	cache.onEvict = onEvict
+}
+
+// Get returns the value for the key and marks it as recently used. It counts
+// as a hit or a miss.
+func (cache *Cache[K, V]) Get(key K) (V, bool) {
+	element, ok := cache.entries[key]
+	if !ok {
+		cache.stats.Misses += 1
+		var zero V
+		return zero, false
+	}
+
+	cache.stats.Hits += 1
+	cache.order.MoveToFront(element)
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Peek returns the value for the key without marking it as used or counting
+// a hit or a miss.
+func (cache *Cache[K, V]) Peek(key K) (V, bool) {
+	element, ok := cache.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return element.Value.(*entry[K, V]).value, true
+}
+
+// Add stores the value of the given size for the key, replacing an existing
+// one, and evicts the least recently used entries that do not fit anymore.
+func (cache *Cache[K, V]) Add(key K, value V, size int, pinned bool) {
+	if element, ok := cache.entries[key]; ok {
+		existing := element.Value.(*entry[K, V])
+		cache.bytes += size - existing.size
+		existing.value = value
+		existing.size = size
+		existing.pinned = pinned
+		cache.order.MoveToFront(element)
+	} else {
+		cache.entries[key] = cache.order.PushFront(&entry[K, V]{
+			key:    key,
+			value:  value,
+			size:   size,
+			pinned: pinned,
+		})
+		cache.bytes += size
+	}
+
+	cache.evict()
+}
+
+// IsPinned reports whether the key is pinned.
+func (cache *Cache[K, V]) IsPinned(key K) bool {
+	element, ok := cache.entries[key]
+	return ok && element.Value.(*entry[K, V]).pinned
+}
+
+// Remove deletes the entry for the key and reports whether there was one.
+func (cache *Cache[K, V]) Remove(key K) bool {
+	element, ok := cache.entries[key]
+	if !ok {
+		return false
+	}
+
+	cache.removeElement(element)
+	return true
+}
+
+// Clear removes all entries, keeping the stats.
+func (cache *Cache[K, V]) Clear() {
+	clear(cache.entries)
+	cache.order.Init()
+	cache.bytes = 0
+}
+
+// Keys returns the keys of all entries, most recently used first.
+func (cache *Cache[K, V]) Keys() []K {
+	keys := make([]K, 0, len(cache.entries))
+	for element := cache.order.Front(); element != nil; element = element.Next() {
+		keys = append(keys, element.Value.(*entry[K, V]).key)
+	}
+	return keys
+}
+
+func (cache *Cache[K, V]) Len() int {
+	return len(cache.entries)
+}
+
+func (cache *Cache[K, V]) Stats() Stats {
+	stats := cache.stats
+	stats.Entries = len(cache.entries)
+	stats.Bytes = cache.bytes
+	return stats
+}
+
+func (cache *Cache[K, V]) exceedsLimits() bool {
+	return (cache.limits.MaxEntries > 0 && len(cache.entries) > cache.limits.MaxEntries) ||
+		(cache.limits.MaxBytes > 0 && cache.bytes > cache.limits.MaxBytes)
+}
+
+// evict removes the least recently used entries that are not pinned until the
+// cache is within its limits.
+func (cache *Cache[K, V]) evict() {
+	element := cache.order.Back()
+	for element != nil && cache.exceedsLimits() {
+		previous := element.Prev()
+		if evicted := element.Value.(*entry[K, V]); !evicted.pinned {
+			cache.removeElement(element)
+			cache.stats.Evictions += 1
+			if cache.onEvict != nil {
+				cache.onEvict(evicted.key, evicted.value)
+			}
+		}
+		element = previous
+	}
+}
+
+func (cache *Cache[K, V]) removeElement(element *list.Element) {
+	removed := element.Value.(*entry[K, V])
+	delete(cache.entries, removed.key)
+	cache.order.Remove(element)
+	cache.bytes -= removed.size
+}
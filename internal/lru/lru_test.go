@@ -0,0 +1,98 @@
+package lru
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestCache(t *testing.T) {
+	t.Run("returns stored values and counts hits and misses.", func(t *testing.T) {
+		cache := New[string, int](Limits{})
+		cache.Add("a", 1, 10, false)
+
+		value, ok := cache.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, value)
+
+		_, ok = cache.Get("b")
+		assert.False(t, ok)
+
+		assert.Equal(t, Stats{Hits: 1, Misses: 1, Entries: 1, Bytes: 10}, cache.Stats())
+	})
+
+	t.Run("evicts the least recently used entries beyond the entry limit.", func(t *testing.T) {
+		cache := New[string, int](Limits{MaxEntries: 2})
+		cache.Add("a", 1, 0, false)
+		cache.Add("b", 2, 0, false)
+		cache.Get("a")
+		cache.Add("c", 3, 0, false)
+
+		assert.Equal(t, []string{"c", "a"}, cache.Keys())
+		assert.Equal(t, 1, cache.Stats().Evictions)
+	})
+
+	t.Run("evicts the least recently used entries beyond the byte limit.", func(t *testing.T) {
+		cache := New[string, int](Limits{MaxBytes: 100})
+		cache.Add("a", 1, 40, false)
+		cache.Add("b", 2, 40, false)
+		cache.Add("c", 3, 40, false)
+
+		assert.Equal(t, []string{"c", "b"}, cache.Keys())
+		assert.Equal(t, 80, cache.Stats().Bytes)
+	})
+
+	t.Run("never evicts pinned entries.", func(t *testing.T) {
+		cache := New[string, int](Limits{MaxEntries: 1})
+		cache.Add("a", 1, 0, true)
+		cache.Add("b", 2, 0, false)
+		cache.Add("c", 3, 0, true)
+
+		assert.Equal(t, []string{"c", "a"}, cache.Keys())
+		assert.True(t, cache.IsPinned("a"))
+		assert.False(t, cache.IsPinned("b"))
+	})
+
+	t.Run("calls the eviction function only for evicted entries.", func(t *testing.T) {
+		cache := New[string, int](Limits{MaxEntries: 1})
+		evicted := make([]string, 0)
+		cache.OnEvict(func(key string, value int) {
+			evicted = append(evicted, key)
+		})
+		cache.Add("a", 1, 0, false)
+		cache.Add("a", 2, 0, false)
+		cache.Add("b", 3, 0, false)
+		cache.Remove("b")
+
+		assert.Equal(t, []string{"a"}, evicted)
+	})
+
+	t.Run("evicts entries when the limits are lowered.", func(t *testing.T) {
+		cache := New[string, int](Limits{})
+		cache.Add("a", 1, 0, false)
+		cache.Add("b", 2, 0, false)
+
+		cache.SetLimits(Limits{MaxEntries: 1})
+
+		assert.Equal(t, []string{"b"}, cache.Keys())
+	})
+
+	t.Run("replaces values and their sizes.", func(t *testing.T) {
+		cache := New[string, int](Limits{})
+		cache.Add("a", 1, 10, false)
+		cache.Add("a", 2, 20, false)
+
+		value, _ := cache.Peek("a")
+		assert.Equal(t, 2, value)
+		assert.Equal(t, Stats{Entries: 1, Bytes: 20}, cache.Stats())
+	})
+
+	t.Run("removes entries.", func(t *testing.T) {
+		cache := New[string, int](Limits{})
+		cache.Add("a", 1, 10, false)
+
+		assert.True(t, cache.Remove("a"))
+		assert.False(t, cache.Remove("a"))
+		assert.Equal(t, Stats{}, cache.Stats())
+	})
+}
@@ -0,0 +1,128 @@
+package parsercache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+// diskCacheVersion is part of the key of each entry. It has to be increased
+// whenever the AST types change, so that old entries are not decoded into the
+// new types.
+const diskCacheVersion = 1
+
+const diskCacheExtension = ".gob"
+
+func init() {
+	gob.Register(&ledger.TransactionHeader{})
+	gob.Register(&ledger.IncludeDirective{})
+	gob.Register(&ledger.AccountDirective{})
+	gob.Register(&ledger.RealPosting{})
+	gob.Register(&ledger.VirtualPosting{})
+	gob.Register(&ledger.VirtualBalancedPosting{})
+}
+
+// DiskCache stores the ASTs of journals in a directory, so that they survive
+// restarts of the server. Entries are keyed by the path and the content of the
+// journal, so a changed journal is never loaded from an old entry.
+type DiskCache struct {
+	directory string
+}
+
+func NewDiskCache(directory string) *DiskCache {
+	return &DiskCache{
+		directory: directory,
+	}
+}
+
+func (cache *DiskCache) entryPath(filePath string, content []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d\x00%s\x00", diskCacheVersion, filePath)
+	hash.Write(content)
+	return filepath.Join(cache.directory, hex.EncodeToString(hash.Sum(nil))+diskCacheExtension)
+}
+
+// Load returns the AST stored for the journal with the given content. Entries
+// that can not be read are treated as missing.
+func (cache *DiskCache) Load(filePath string, content []byte) (*ledger.Journal, bool) {
+	entryPath := cache.entryPath(filePath, content)
+	encodedJournal, err := os.ReadFile(entryPath)
+	if err != nil {
+		return nil, false
+	}
+
+	var journal ledger.Journal
+	if err := gob.NewDecoder(bytes.NewReader(encodedJournal)).Decode(&journal); err != nil {
+		return nil, false
+	}
+
+	// Entries still in use must not be pruned.
+	now := time.Now()
+	_ = os.Chtimes(entryPath, now, now)
+
+	return &journal, true
+}
+
+// Store writes the AST of the journal with the given content.
+func (cache *DiskCache) Store(filePath string, content []byte, journal *ledger.Journal) error {
+	var encodedJournal bytes.Buffer
+	if err := gob.NewEncoder(&encodedJournal).Encode(journal); err != nil {
+		return fmt.Errorf("failed to encode journal: %w", err)
+	}
+
+	if err := os.MkdirAll(cache.directory, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Writing to a temporary file first keeps concurrent readers from seeing
+	// partial entries.
+	entryFile, err := os.CreateTemp(cache.directory, "entry-*")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	_, err = entryFile.Write(encodedJournal.Bytes())
+	err = errors.Join(err, entryFile.Close())
+	if err == nil {
+		err = os.Rename(entryFile.Name(), cache.entryPath(filePath, content))
+	}
+	if err != nil {
+		_ = os.Remove(entryFile.Name())
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	return nil
+}
+
+// Prune deletes the entries that were neither written nor loaded for the given
+// duration, since the journals they were stored for have most likely changed.
+func (cache *DiskCache) Prune(maxAge time.Duration) error {
+	entries, err := os.ReadDir(cache.directory)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != diskCacheExtension {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		_ = os.Remove(filepath.Join(cache.directory, entry.Name()))
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package parsercache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/yeldirium/hledger-language-server/internal/documentcache"
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+func TestDiskCache(t *testing.T) {
+	content := []byte("include accounts.journal\naccount assets:Cash\n2024-11-25 Payee\n    assets:Cash  10 €\n    [budget:Food]\n")
+
+	t.Run("loads the stored AST for the same path and content.", func(t *testing.T) {
+		diskCache := NewDiskCache(t.TempDir())
+		journal, err := ledger.NewJournalParser().ParseBytes("/ledger/main.journal", content)
+		assert.NoError(t, err)
+
+		assert.NoError(t, diskCache.Store("/ledger/main.journal", content, journal))
+		loadedJournal, ok := diskCache.Load("/ledger/main.journal", content)
+
+		assert.True(t, ok)
+		assert.Equal(t, journal, loadedJournal)
+	})
+
+	t.Run("misses for a different path or content.", func(t *testing.T) {
+		diskCache := NewDiskCache(t.TempDir())
+		journal, err := ledger.NewJournalParser().ParseBytes("/ledger/main.journal", content)
+		assert.NoError(t, err)
+		assert.NoError(t, diskCache.Store("/ledger/main.journal", content, journal))
+
+		_, ok := diskCache.Load("/ledger/other.journal", content)
+		assert.False(t, ok)
+		_, ok = diskCache.Load("/ledger/main.journal", []byte("account assets\n"))
+		assert.False(t, ok)
+	})
+
+	t.Run("prunes entries that were not used for the given duration.", func(t *testing.T) {
+		directory := t.TempDir()
+		diskCache := NewDiskCache(directory)
+		journal, err := ledger.NewJournalParser().ParseBytes("/ledger/main.journal", content)
+		assert.NoError(t, err)
+		assert.NoError(t, diskCache.Store("/ledger/main.journal", content, journal))
+		assert.NoError(t, diskCache.Store("/ledger/old.journal", content, journal))
+		old := time.Now().Add(-48 * time.Hour)
+		assert.NoError(t, os.Chtimes(diskCache.entryPath("/ledger/old.journal", content), old, old))
+
+		assert.NoError(t, diskCache.Prune(24*time.Hour))
+
+		_, ok := diskCache.Load("/ledger/main.journal", content)
+		assert.True(t, ok)
+		_, ok = diskCache.Load("/ledger/old.journal", content)
+		assert.False(t, ok)
+	})
+
+	t.Run("is used by the parser cache for documents that are not pinned.", func(t *testing.T) {
+		directory := t.TempDir()
+		documentCache := documentcache.NewCache("/", fstest.MapFS{
+			"ledger/main.journal": &fstest.MapFile{Data: content},
+		})
+		documentCache.SetFile("/ledger/open.journal", "account expenses\n")
+		cache := NewCache(documentCache)
+		cache.SetDiskCache(NewDiskCache(directory))
+
+		journal, err := cache.Parse(context.Background(), "/ledger/main.journal")
+		assert.NoError(t, err)
+		_, err = cache.Parse(context.Background(), "/ledger/open.journal")
+		assert.NoError(t, err)
+
+		entries, err := filepath.Glob(filepath.Join(directory, "*"+diskCacheExtension))
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(entries))
+
+		otherCache := NewCache(documentCache)
+		otherCache.SetDiskCache(NewDiskCache(directory))
+		loadedJournal, err := otherCache.Parse(context.Background(), "/ledger/main.journal")
+		assert.NoError(t, err)
+		assert.Equal(t, journal, loadedJournal)
+	})
+}
@@ -0,0 +1,249 @@
+package parsercache
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+	"github.com/yeldirium/hledger-language-server/internal/telemetry"
+)
+
+// IncludeEdge is an include directive together with the file containing it and
+// one of the files it includes.
+type IncludeEdge struct {
+	Directive *ledger.IncludeDirective
+	From      string
+	To        string
+}
+
+// IncludeCycle is an include directive that includes a file which, directly or
+// indirectly, includes the file containing the directive again.
+type IncludeCycle struct {
+	Edge IncludeEdge
+	// Files is the chain of files from the included file back to the file
+	// containing the directive.
+	Files []string
+}
+
+// IncludeGraph describes which files include which other files, starting at a
+// set of root journals.
+type IncludeGraph struct {
+	roots     []string
+	edges     map[string][]IncludeEdge
+	reachedBy map[string][]string
+	cycles    []IncludeCycle
+}
+
+// IncludeGraphProgress is told how many files have been parsed while building
+// an include graph, out of how many files have been discovered so far.
+type IncludeGraphProgress func(parsedCount int, discoveredCount int)
+
+// BuildIncludeGraph follows the include directives of the given root journals.
+// Includes are resolved relative to the file containing them. Files that can
+// not be parsed and includes that can not be resolved are left out, since they
+// are reported as diagnostics elsewhere.
+func (cache *ParserCache) BuildIncludeGraph(ctx context.Context, rootFilePaths ...string) *IncludeGraph {
+	return cache.BuildIncludeGraphWithProgress(ctx, nil, rootFilePaths...)
+}
+
+// BuildIncludeGraphWithProgress is BuildIncludeGraph, but reports its progress
+// after each parsed file. The number of discovered files grows as the include
+// directives of parsed files are followed. Files are parsed concurrently, so
+// progress may be reported from different goroutines, but never at the same
+// time.
+func (cache *ParserCache) BuildIncludeGraphWithProgress(ctx context.Context, progress IncludeGraphProgress, rootFilePaths ...string) *IncludeGraph {
+	tracer := telemetry.TracerFromContext(ctx)
+	ctx, span := tracer.Start(ctx, "parsercache/buildIncludeGraph")
+	defer span.End()
+
+	graph := &IncludeGraph{
+		roots:     rootFilePaths,
+		edges:     make(map[string][]IncludeEdge),
+		reachedBy: make(map[string][]string),
+		cycles:    make([]IncludeCycle, 0),
+	}
+	builder := &includeGraphBuilder{
+		graph:    graph,
+		progress: progress,
+	}
+
+	rootsToParse := make([]string, 0, len(rootFilePaths))
+	for _, rootFilePath := range rootFilePaths {
+		if _, ok := graph.edges[rootFilePath]; !ok {
+			graph.edges[rootFilePath] = make([]IncludeEdge, 0)
+			rootsToParse = append(rootsToParse, rootFilePath)
+		}
+	}
+	for _, rootFilePath := range rootsToParse {
+		builder.Add(1)
+		go cache.addToIncludeGraph(ctx, builder, rootFilePath)
+	}
+	builder.Wait()
+
+	reportedCycles := make(map[*ledger.IncludeDirective]bool)
+	for _, rootFilePath := range rootFilePaths {
+		graph.visit(rootFilePath, rootFilePath, []string{}, make(map[string]bool), reportedCycles)
+	}
+
+	span.SetAttributes(
+		attribute.Int("parsercache.includeGraph.fileCount", len(graph.edges)),
+		attribute.Int("parsercache.includeGraph.cycleCount", len(graph.cycles)),
+	)
+
+	return graph
+}
+
+// includeGraphBuilder counts the files parsed while building an include
+// graph and waits for the files that are still being parsed. Its lock guards
+// the graph and the count.
+type includeGraphBuilder struct {
+	sync.Mutex
+	sync.WaitGroup
+	graph       *IncludeGraph
+	progress    IncludeGraphProgress
+	parsedCount int
+}
+
+func (builder *includeGraphBuilder) reportProgress() {
+	if builder.progress != nil {
+		builder.progress(builder.parsedCount, len(builder.graph.edges))
+	}
+}
+
+// addToIncludeGraph parses a file that was added to the graph already, adds
+// the files it includes and then parses them concurrently, bounded by the
+// parse slots of the cache. Adding the included files first lets the progress
+// tell how many files are left. The edges of each file are added in the order
+// of its include directives.
+func (cache *ParserCache) addToIncludeGraph(ctx context.Context, builder *includeGraphBuilder, filePath string) {
+	defer builder.Done()
+
+	cache.parseSlots <- struct{}{}
+	journal, err := cache.Parse(ctx, filePath)
+	<-cache.parseSlots
+
+	edges := make([]IncludeEdge, 0)
+	journalIncludes := make(map[string]bool)
+	if err == nil {
+		for _, entry := range journal.Entries {
+			directive, ok := entry.(*ledger.IncludeDirective)
+			if !ok {
+				continue
+			}
+
+			includedFilePaths, err := cache.ResolveIncludePath(ctx, filePath, directive.IncludePath)
+			if err != nil {
+				continue
+			}
+
+			format, _ := SplitIncludeFormat(directive.IncludePath)
+			for _, includedFilePath := range includedFilePaths {
+				edges = append(edges, IncludeEdge{
+					Directive: directive,
+					From:      filePath,
+					To:        includedFilePath,
+				})
+				if isJournalInclude(format, includedFilePath) {
+					journalIncludes[includedFilePath] = true
+				}
+			}
+		}
+	}
+
+	builder.Lock()
+	graph := builder.graph
+	discoveredFilePaths := make([]string, 0)
+	for _, edge := range edges {
+		graph.edges[filePath] = append(graph.edges[filePath], edge)
+
+		if _, ok := graph.edges[edge.To]; !ok && journalIncludes[edge.To] {
+			graph.edges[edge.To] = make([]IncludeEdge, 0)
+			discoveredFilePaths = append(discoveredFilePaths, edge.To)
+		}
+	}
+	builder.parsedCount += 1
+	builder.reportProgress()
+	builder.Unlock()
+
+	for _, includedFilePath := range discoveredFilePaths {
+		builder.Add(1)
+		go cache.addToIncludeGraph(ctx, builder, includedFilePath)
+	}
+}
+
+// visit walks the graph depth first, recording which root reaches each file
+// and which include directives close a cycle.
+func (graph *IncludeGraph) visit(rootFilePath string, filePath string, chain []string, visited map[string]bool, reportedCycles map[*ledger.IncludeDirective]bool) {
+	visited[filePath] = true
+	chain = append(chain, filePath)
+	if !slices.Contains(graph.reachedBy[filePath], rootFilePath) {
+		graph.reachedBy[filePath] = append(graph.reachedBy[filePath], rootFilePath)
+	}
+
+	for _, edge := range graph.edges[filePath] {
+		if index := slices.Index(chain, edge.To); index >= 0 {
+			if !reportedCycles[edge.Directive] {
+				reportedCycles[edge.Directive] = true
+				graph.cycles = append(graph.cycles, IncludeCycle{
+					Edge:  edge,
+					Files: slices.Clone(chain[index:]),
+				})
+			}
+			continue
+		}
+		if !visited[edge.To] {
+			graph.visit(rootFilePath, edge.To, chain, visited, reportedCycles)
+		}
+	}
+}
+
+// Roots returns the root journals the graph was built from.
+func (graph *IncludeGraph) Roots() []string {
+	return graph.roots
+}
+
+// Includes returns the edges for the include directives of the given file.
+func (graph *IncludeGraph) Includes(filePath string) []IncludeEdge {
+	return graph.edges[filePath]
+}
+
+// RootsReaching returns the root journals that include the given file,
+// directly or indirectly. A root journal reaches itself.
+func (graph *IncludeGraph) RootsReaching(filePath string) []string {
+	return graph.reachedBy[filePath]
+}
+
+// Cycles returns the include directives that close a cycle.
+func (graph *IncludeGraph) Cycles() []IncludeCycle {
+	return graph.cycles
+}
+
+// CyclesIn returns the cycles that the given file is part of. Each cycle is
+// seen from the file: its edge is the include directive in the file that leads
+// into the cycle, and its files start with the file itself.
+func (graph *IncludeGraph) CyclesIn(filePath string) []IncludeCycle {
+	cycles := make([]IncludeCycle, 0)
+	for _, cycle := range graph.cycles {
+		index := slices.Index(cycle.Files, filePath)
+		if index < 0 {
+			continue
+		}
+
+		files := append(slices.Clone(cycle.Files[index:]), cycle.Files[:index]...)
+		next := files[0]
+		if len(files) > 1 {
+			next = files[1]
+		}
+
+		for _, edge := range graph.edges[filePath] {
+			if edge.To == next {
+				cycles = append(cycles, IncludeCycle{Edge: edge, Files: files})
+				break
+			}
+		}
+	}
+	return cycles
+}
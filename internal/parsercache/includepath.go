@@ -0,0 +1,94 @@
+package parsercache
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// Formats of the files that hledger can read.
+const (
+	FormatJournal   = "journal"
+	FormatTimeclock = "timeclock"
+	FormatTimedot   = "timedot"
+	FormatCsv       = "csv"
+	FormatRules     = "rules"
+)
+
+// formatPrefixes maps the prefixes that include paths may start with, like in
+// `include timedot:hours.md`, to the format they select.
+var formatPrefixes = map[string]string{
+	"journal":   FormatJournal,
+	"timeclock": FormatTimeclock,
+	"timedot":   FormatTimedot,
+	"csv":       FormatCsv,
+	"ssv":       FormatCsv,
+	"tsv":       FormatCsv,
+	"rules":     FormatRules,
+}
+
+var formatExtensions = map[string]string{
+	".journal":   FormatJournal,
+	".j":         FormatJournal,
+	".hledger":   FormatJournal,
+	".ledger":    FormatJournal,
+	".timeclock": FormatTimeclock,
+	".timedot":   FormatTimedot,
+	".csv":       FormatCsv,
+	".ssv":       FormatCsv,
+	".tsv":       FormatCsv,
+	".rules":     FormatRules,
+}
+
+// userHomeDir is replaced in tests.
+var userHomeDir = os.UserHomeDir
+
+// SplitIncludeFormat splits the format prefix off an include path. The format
+// is empty if the path has no prefix.
+func SplitIncludeFormat(includePath string) (format string, filePath string) {
+	prefix, rest, ok := strings.Cut(includePath, ":")
+	if !ok {
+		return "", includePath
+	}
+	format, ok = formatPrefixes[prefix]
+	if !ok {
+		return "", includePath
+	}
+	return format, rest
+}
+
+// FileFormat guesses the format of a file from its extension. Files with an
+// unknown extension are read as journals, like hledger does.
+func FileFormat(filePath string) string {
+	if format, ok := formatExtensions[strings.ToLower(path.Ext(filePath))]; ok {
+		return format
+	}
+	return FormatJournal
+}
+
+// HasJournalExtension reports whether the file has one of the extensions of
+// journals. Unlike FileFormat, it does not count unknown extensions.
+func HasJournalExtension(filePath string) bool {
+	return formatExtensions[strings.ToLower(path.Ext(filePath))] == FormatJournal
+}
+
+// isJournalInclude reports whether an included file is read as a journal,
+// given the format prefix of the include path.
+func isJournalInclude(format string, includedFilePath string) bool {
+	if format == "" {
+		format = FileFormat(includedFilePath)
+	}
+	return format == FormatJournal
+}
+
+// ExpandHome replaces a leading `~` with the home directory of the user.
+func ExpandHome(filePath string) string {
+	if filePath != "~" && !strings.HasPrefix(filePath, "~/") {
+		return filePath
+	}
+	homeDir, err := userHomeDir()
+	if err != nil {
+		return filePath
+	}
+	return path.Join(homeDir, filePath[1:])
+}
@@ -2,39 +2,140 @@ package parsercache
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"path"
+	"runtime"
+	"slices"
 	"sync"
 
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/yeldirium/hledger-language-server/internal/documentcache"
 	"github.com/yeldirium/hledger-language-server/internal/ledger"
+	"github.com/yeldirium/hledger-language-server/internal/lru"
 	"github.com/yeldirium/hledger-language-server/internal/telemetry"
 )
 
+var (
+	ErrIncludeNotFound = errors.New("included file not found")
+)
+
 type ParsingResult struct {
 	journal *ledger.Journal
 	err     error
 }
 
+// parseCall is a parse in progress.
+type parseCall struct {
+	done    chan struct{}
+	journal *ledger.Journal
+	err     error
+	// removed is set if the file was removed from the cache during the parse,
+	// so that the result is not cached.
+	removed bool
+	// cancelled is set if the context of the caller that started the parse
+	// was cancelled, so that the callers waiting for it parse the file
+	// themselves.
+	cancelled bool
+}
+
+// resolvedJournal is a journal with its includes resolved, together with the
+// files it was resolved from.
+type resolvedJournal struct {
+	source  *ledger.Journal
+	journal *ledger.Journal
+	files   []string
+}
+
+// ParserCache holds the ASTs of parsed journals. The ASTs of documents pinned
+// in the document cache stay until they are removed, all others are evicted
+// once the cache exceeds its limits, least recently used first. The limits
+// count the size of the parsed documents.
 type ParserCache struct {
 	sync.RWMutex
 	documentCache *documentcache.DocumentCache
-	asts          map[string]ParsingResult
-	parser        *ledger.JournalParser
+	asts          *lru.Cache[string, ParsingResult]
+	// resolvedJournals are the journals resolved by ResolveIncludes, keyed by
+	// the file they were resolved for. They are dropped with the AST of any of
+	// their files, so that the limits of the ASTs bound them too.
+	resolvedJournals map[string]resolvedJournal
+	// dependents maps each file to the resolved journals it is part of.
+	dependents map[string]map[string]bool
+	// parseCalls are the parses in progress. Concurrent Parse calls for the
+	// same file wait for the same parse.
+	parseCalls map[string]*parseCall
+	// parseSlots bounds how many included files are parsed concurrently.
+	parseSlots chan struct{}
+	// diskCache optionally keeps the ASTs of documents that are not pinned
+	// across restarts.
+	diskCache *DiskCache
+	// sharedCache optionally shares the ASTs of documents that are not pinned
+	// with other parser caches.
+	sharedCache *SharedCache
+	parser      *ledger.JournalParser
 }
 
 func NewCache(documentCache *documentcache.DocumentCache) *ParserCache {
-	return &ParserCache{
-		asts:          make(map[string]ParsingResult),
-		parser:        ledger.NewJournalParser(),
-		documentCache: documentCache,
+	cache := &ParserCache{
+		asts:             lru.New[string, ParsingResult](lru.Limits{}),
+		resolvedJournals: make(map[string]resolvedJournal),
+		dependents:       make(map[string]map[string]bool),
+		parseCalls:       make(map[string]*parseCall),
+		parseSlots:       make(chan struct{}, runtime.GOMAXPROCS(0)),
+		parser:           ledger.NewJournalParser(),
+		documentCache:    documentCache,
 	}
+	// Evictions happen while the cache is locked.
+	cache.asts.OnEvict(func(filePath string, _ ParsingResult) {
+		cache.removeDependentsLocked(filePath)
+	})
+	return cache
 }
 
 func (cache *ParserCache) Size() int {
-	return len(cache.asts)
+	cache.RLock()
+	defer cache.RUnlock()
+
+	return cache.asts.Len()
+}
+
+// SetLimits bounds the ASTs that the cache keeps.
+func (cache *ParserCache) SetLimits(limits lru.Limits) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.asts.SetLimits(limits)
+}
+
+// SetDiskCache makes the cache load and store the ASTs of documents that are
+// not pinned in the document cache from and to the disk cache. Passing nil
+// disables it.
+func (cache *ParserCache) SetDiskCache(diskCache *DiskCache) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.diskCache = diskCache
+}
+
+// SetSharedCache makes the cache share the ASTs of documents that are not
+// pinned in the document cache with other parser caches using the same shared
+// cache. It is looked up before the disk cache. Passing nil disables it.
+func (cache *ParserCache) SetSharedCache(sharedCache *SharedCache) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.sharedCache = sharedCache
+}
+
+// Stats returns how often ASTs were found in the cache and evicted.
+func (cache *ParserCache) Stats() lru.Stats {
+	cache.RLock()
+	defer cache.RUnlock()
+
+	return cache.asts.Stats()
 }
 
 func (cache *ParserCache) Parse(ctx context.Context, filePath string) (*ledger.Journal, error) {
@@ -46,70 +147,361 @@ func (cache *ParserCache) Parse(ctx context.Context, filePath string) (*ledger.J
 		attribute.String("parsercache.filePath", filePath),
 	)
 
-	cache.RLock()
-	ast, ok := cache.asts[filePath]
-	cache.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	ast, ok := cache.asts.Get(filePath)
+	stats := cache.asts.Stats()
+	call, shared := cache.parseCalls[filePath]
+	if !ok && !shared {
+		call = &parseCall{done: make(chan struct{})}
+		cache.parseCalls[filePath] = call
+	}
+	cache.Unlock()
 
 	span.SetAttributes(
 		attribute.Bool("parsercache.hit", ok),
+		attribute.Bool("parsercache.sharedParse", !ok && shared),
+		attribute.Int("parsercache.hitCount", stats.Hits),
+		attribute.Int("parsercache.missCount", stats.Misses),
+		attribute.Int("parsercache.evictionCount", stats.Evictions),
+		attribute.Int("parsercache.astCount", stats.Entries),
 	)
 	if ok {
 		return ast.journal, ast.err
 	}
+	if shared {
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.cancelled {
+			return cache.Parse(ctx, filePath)
+		}
+		return call.journal, call.err
+	}
+
+	journal, size, cacheable, err := cache.parse(ctx, filePath)
+	call.cancelled = ctx.Err() != nil && err == ctx.Err()
+
+	cache.Lock()
+	if cache.parseCalls[filePath] == call {
+		delete(cache.parseCalls, filePath)
+	}
+	if cacheable && !call.removed {
+		cache.asts.Add(filePath, ParsingResult{
+			journal,
+			err,
+		}, size, cache.documentCache.IsPinned(filePath))
+	}
+	cache.Unlock()
+
+	call.journal, call.err = journal, err
+	close(call.done)
+
+	return journal, err
+}
+
+// parse reads and parses the document, or loads its AST from the shared or
+// the disk cache.
+// Results are cacheable unless the document could not be read or the context
+// was cancelled before parsing.
+func (cache *ParserCache) parse(ctx context.Context, filePath string) (journal *ledger.Journal, size int, cacheable bool, err error) {
+	span := trace.SpanFromContext(ctx)
 
 	file, err := cache.documentCache.Open(ctx, filePath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open document: %w", err)
+		return nil, 0, false, fmt.Errorf("failed to open document: %w", err)
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	cache.RLock()
+	diskCache := cache.diskCache
+	sharedCache := cache.sharedCache
+	cache.RUnlock()
+	if cache.documentCache.IsPinned(filePath) {
+		diskCache = nil
+		sharedCache = nil
+	}
+
+	sharedHit := false
+	if sharedCache != nil {
+		journal, sharedHit = sharedCache.Load(filePath, content)
+	}
+	span.SetAttributes(
+		attribute.Bool("parsercache.sharedHit", sharedHit),
+	)
+	if sharedHit {
+		return journal, len(content), true, nil
 	}
 
-	journal, err := cache.parser.Parse(filePath, file)
+	diskHit := false
+	if diskCache != nil {
+		journal, diskHit = diskCache.Load(filePath, content)
+	}
+	span.SetAttributes(
+		attribute.Bool("parsercache.diskHit", diskHit),
+	)
 
+	if !diskHit {
+		if err := ctx.Err(); err != nil {
+			return nil, 0, false, err
+		}
+		journal, err = cache.parser.ParseBytes(filePath, content)
+		if err == nil && diskCache != nil {
+			if storeErr := diskCache.Store(filePath, content, journal); storeErr != nil {
+				span.RecordError(storeErr)
+			}
+		}
+	}
+	if err == nil && sharedCache != nil {
+		sharedCache.Store(filePath, content, journal)
+	}
+
+	return journal, len(content), true, err
+}
+
+// Remove drops the AST of the file and every resolved journal that the file
+// is part of, so that they are parsed and resolved again when needed next.
+func (cache *ParserCache) Remove(filePath string) {
 	cache.Lock()
 	defer cache.Unlock()
 
-	cache.asts[filePath] = ParsingResult{
-		journal,
-		err,
+	cache.asts.Remove(filePath)
+	if call, ok := cache.parseCalls[filePath]; ok {
+		// The parse in progress may have read the document before it changed.
+		call.removed = true
+		delete(cache.parseCalls, filePath)
 	}
+	cache.removeDependentsLocked(filePath)
+}
 
-	return journal, err
+// removeDependentsLocked drops every resolved journal that the file is part
+// of.
+func (cache *ParserCache) removeDependentsLocked(filePath string) {
+	for journalFilePath := range cache.dependents[filePath] {
+		cache.removeResolvedJournalLocked(journalFilePath)
+	}
+	cache.removeResolvedJournalLocked(filePath)
 }
 
-func (cache *ParserCache) Remove(filePath string) {
-	delete(cache.asts, filePath)
+// RemoveResolvedJournals drops all resolved journals but keeps the ASTs. This
+// is needed when files are created or deleted, since include globs may match
+// other files then.
+func (cache *ParserCache) RemoveResolvedJournals() {
+	cache.Lock()
+	defer cache.Unlock()
+
+	clear(cache.resolvedJournals)
+	clear(cache.dependents)
+}
+
+func (cache *ParserCache) removeResolvedJournalLocked(journalFilePath string) {
+	resolved, ok := cache.resolvedJournals[journalFilePath]
+	if !ok {
+		return
+	}
+
+	delete(cache.resolvedJournals, journalFilePath)
+	for _, filePath := range resolved.files {
+		delete(cache.dependents[filePath], journalFilePath)
+		if len(cache.dependents[filePath]) == 0 {
+			delete(cache.dependents, filePath)
+		}
+	}
 }
 
+// ResolveIncludes replaces the include directives of the journal with the
+// entries of the journals they include, recursively. The includes of each file
+// are resolved relative to the directory of that file, not to the one of the
+// journal the resolution started at. Included files in other formats than
+// the journal format are skipped, since they can not be parsed yet, and so are
+// includes that would include a file again that is already being included,
+// which are reported by the include graph.
+//
+// The resolved journal is cached until one of the files it was resolved from
+// is removed, and must not be modified.
 func (cache *ParserCache) ResolveIncludes(ctx context.Context, journal *ledger.Journal, journalFilePath string) (*ledger.Journal, error) {
-	newJournal := ledger.Journal{
-		Entries: make([]ledger.Entry, 0),
+	span := trace.SpanFromContext(ctx)
+
+	cache.RLock()
+	resolved, ok := cache.resolvedJournals[journalFilePath]
+	cache.RUnlock()
+
+	hit := ok && resolved.source == journal
+	span.SetAttributes(
+		attribute.Bool("parsercache.resolvedJournalHit", hit),
+	)
+	if hit {
+		return resolved.journal, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	newJournal, includedFiles, err := cache.resolveIncludes(ctx, journal, journalFilePath, []string{journalFilePath})
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	defer cache.Unlock()
+
+	// A file removed or evicted while resolving would leave the result stale,
+	// or never be dropped.
+	files := append([]string{journalFilePath}, includedFiles...)
+	for _, filePath := range files {
+		if _, ok := cache.asts.Peek(filePath); !ok {
+			return newJournal, nil
+		}
 	}
-	journalDir := path.Dir(journalFilePath)
 
+	cache.removeResolvedJournalLocked(journalFilePath)
+	cache.resolvedJournals[journalFilePath] = resolvedJournal{
+		source:  journal,
+		journal: newJournal,
+		files:   files,
+	}
+	for _, filePath := range files {
+		if cache.dependents[filePath] == nil {
+			cache.dependents[filePath] = make(map[string]bool)
+		}
+		cache.dependents[filePath][journalFilePath] = true
+	}
+
+	return newJournal, nil
+}
+
+// includedJournal is an included file with its includes resolved, together
+// with the files it was resolved from.
+type includedJournal struct {
+	journal *ledger.Journal
+	files   []string
+	err     error
+}
+
+// resolveIncludes parses the included files concurrently, but merges their
+// entries in the order of the include directives. It also returns the files
+// that were included, directly or indirectly.
+func (cache *ParserCache) resolveIncludes(ctx context.Context, journal *ledger.Journal, journalFilePath string, includeChain []string) (*ledger.Journal, []string, error) {
+	// Each part is either an entry of the journal or an included file.
+	type part struct {
+		entry    ledger.Entry
+		included *includedJournal
+	}
+	parts := make([]part, 0, len(journal.Entries))
+
+	var waitGroup sync.WaitGroup
 	for _, entry := range journal.Entries {
-		switch entry := entry.(type) {
-		case *ledger.IncludeDirective:
-			includePath := entry.IncludePath
-			if !path.IsAbs(includePath) {
-				includePath = path.Join(journalDir, includePath)
-			}
-			if path.IsAbs(includePath) {
-				includePath = includePath[1:]
-			}
+		directive, ok := entry.(*ledger.IncludeDirective)
+		if !ok {
+			parts = append(parts, part{entry: entry})
+			continue
+		}
 
-			includeJournal, err := cache.Parse(ctx, includePath)
-			if err != nil {
-				return nil, err
-			}
-			resolvedIncludeJournal, err := cache.ResolveIncludes(ctx, includeJournal, journalFilePath)
-			if err != nil {
-				return nil, err
+		includedFilePaths, err := cache.ResolveIncludePath(ctx, journalFilePath, directive.IncludePath)
+		if err != nil {
+			parts = append(parts, part{included: &includedJournal{err: err}})
+			continue
+		}
+
+		format, _ := SplitIncludeFormat(directive.IncludePath)
+		for _, includedFilePath := range includedFilePaths {
+			if !isJournalInclude(format, includedFilePath) || slices.Contains(includeChain, includedFilePath) {
+				continue
 			}
 
-			newJournal.Entries = append(newJournal.Entries, resolvedIncludeJournal.Entries...)
-		default:
-			newJournal.Entries = append(newJournal.Entries, entry)
+			included := &includedJournal{}
+			parts = append(parts, part{included: included})
+
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+
+				cache.parseSlots <- struct{}{}
+				includeJournal, err := cache.Parse(ctx, includedFilePath)
+				<-cache.parseSlots
+				if err != nil {
+					included.err = err
+					return
+				}
+
+				included.journal, included.files, included.err = cache.resolveIncludes(ctx, includeJournal, includedFilePath, append(slices.Clone(includeChain), includedFilePath))
+				included.files = append([]string{includedFilePath}, included.files...)
+			}()
+		}
+	}
+	waitGroup.Wait()
+
+	newJournal := ledger.Journal{
+		Entries: make([]ledger.Entry, 0, len(journal.Entries)),
+	}
+	files := make([]string, 0)
+	for _, part := range parts {
+		if part.included == nil {
+			newJournal.Entries = append(newJournal.Entries, part.entry)
+			continue
+		}
+		if part.included.err != nil {
+			return nil, nil, part.included.err
+		}
+
+		newJournal.Entries = append(newJournal.Entries, part.included.journal.Entries...)
+		for _, filePath := range part.included.files {
+			if !slices.Contains(files, filePath) {
+				files = append(files, filePath)
+			}
 		}
 	}
 
-	return &newJournal, nil
+	return &newJournal, files, nil
+}
+
+// ResolveIncludePath returns the files that an include directive in the given
+// journal refers to, sorted. Relative include paths are resolved relative to
+// the directory of the journal, `~` is expanded to the home directory and a
+// format prefix like `timedot:` is ignored. Glob patterns, including `**`, may
+// match several files, but never the journal itself. It fails if no file
+// matches.
+func (cache *ParserCache) ResolveIncludePath(ctx context.Context, journalFilePath string, includePath string) ([]string, error) {
+	tracer := telemetry.TracerFromContext(ctx)
+	_, span := tracer.Start(ctx, "parsercache/resolveIncludePath")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("parsercache.filePath", journalFilePath),
+		attribute.String("parsercache.includePath", includePath),
+	)
+
+	_, pattern := SplitIncludeFormat(includePath)
+	pattern = ExpandHome(pattern)
+	if !path.IsAbs(pattern) {
+		pattern = path.Join(path.Dir(journalFilePath), pattern)
+	}
+
+	matches, err := cache.documentCache.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid include path %q: %w", includePath, err)
+	}
+	if pattern != journalFilePath {
+		matches = slices.DeleteFunc(matches, func(match string) bool {
+			return match == journalFilePath
+		})
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrIncludeNotFound, includePath)
+	}
+
+	span.SetAttributes(
+		attribute.Int("parsercache.includeMatchCount", len(matches)),
+	)
+
+	return matches, nil
 }
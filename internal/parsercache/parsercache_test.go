@@ -2,19 +2,31 @@ package parsercache
 
 import (
 	"context"
+	"fmt"
+	"io/fs"
+	"sync"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/alecthomas/assert/v2"
 	participleLexer "github.com/alecthomas/participle/v2/lexer"
 
 	"github.com/yeldirium/hledger-language-server/internal/documentcache"
+	"github.com/yeldirium/hledger-language-server/internal/journalgen"
 	"github.com/yeldirium/hledger-language-server/internal/ledger"
+	"github.com/yeldirium/hledger-language-server/internal/lru"
 )
 
 func pruneMetadataFromAst(ast *ledger.Journal) {
 	for _, entry := range ast.Entries {
 		switch entry := entry.(type) {
+		case *ledger.TransactionHeader:
+			entry.Pos = participleLexer.Position{}
+			entry.EndPos = participleLexer.Position{}
+		case *ledger.IncludeDirective:
+			entry.Pos = participleLexer.Position{}
+			entry.EndPos = participleLexer.Position{}
 		case *ledger.AccountDirective:
 			entry.AccountName.Pos = participleLexer.Position{}
 			entry.AccountName.EndPos = participleLexer.Position{}
@@ -34,7 +46,7 @@ func pruneMetadataFromAst(ast *ledger.Journal) {
 func TestParserCache(t *testing.T) {
 	t.Run("NewCache", func(t *testing.T) {
 		t.Run("creates an empty cache.", func(t *testing.T) {
-			documentCache := documentcache.NewCache(fstest.MapFS{})
+			documentCache := documentcache.NewCache("/", fstest.MapFS{})
 			cache := NewCache(documentCache)
 			cacheSize := cache.Size()
 
@@ -44,14 +56,14 @@ func TestParserCache(t *testing.T) {
 
 	t.Run("Parse", func(t *testing.T) {
 		t.Run("parses a journal, if it wasn't cached before.", func(t *testing.T) {
-			documentCache := documentcache.NewCache(fstest.MapFS{
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
 				"tmp/foo/bar.journal": &fstest.MapFile{
 					Data: []byte("account assets:Cash:Checking\n"),
 				},
 			})
 			cache := NewCache(documentCache)
 
-			ast, err := cache.Parse(context.Background(), "tmp/foo/bar.journal")
+			ast, err := cache.Parse(context.Background(), "/tmp/foo/bar.journal")
 			pruneMetadataFromAst(ast)
 
 			assert.NoError(t, err)
@@ -67,32 +79,32 @@ func TestParserCache(t *testing.T) {
 		})
 
 		t.Run("returns an error if parsing a journal fails.", func(t *testing.T) {
-			documentCache := documentcache.NewCache(fstest.MapFS{
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
 				"tmp/foo/bar.journal": &fstest.MapFile{
 					Data: []byte("account\n"),
 				},
 			})
 			cache := NewCache(documentCache)
 
-			_, err := cache.Parse(context.Background(), "tmp/foo/bar.journal")
+			_, err := cache.Parse(context.Background(), "/tmp/foo/bar.journal")
 
 			assert.Error(t, err)
 		})
 
 		t.Run("takes the AST from the cache, if there is an entry for the file path. In this case, the file is not retrieved from the document cache.", func(t *testing.T) {
-			documentCache := documentcache.NewCache(fstest.MapFS{
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
 				"tmp/foo/bar.journal": &fstest.MapFile{
 					Data: []byte("account assets:Cash:Checking\n"),
 				},
 			})
 			cache := NewCache(documentCache)
 
-			_, err := cache.Parse(context.Background(), "tmp/foo/bar.journal")
+			_, err := cache.Parse(context.Background(), "/tmp/foo/bar.journal")
 			assert.NoError(t, err)
 
-			documentCache.SetFile("tmp/foo/bar.journal", "account\n")
+			documentCache.SetFile("/tmp/foo/bar.journal", "account\n")
 
-			_, err = cache.Parse(context.Background(), "tmp/foo/bar.journal")
+			_, err = cache.Parse(context.Background(), "/tmp/foo/bar.journal")
 			// If this Parse call had tried to parse the file from the document cache
 			// again, it would have failed, since that document now contains an
 			// invalid ledger format.
@@ -100,33 +112,33 @@ func TestParserCache(t *testing.T) {
 		})
 
 		t.Run("also caches errors.", func(t *testing.T) {
-			documentCache := documentcache.NewCache(fstest.MapFS{
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
 				"tmp/foo/bar.journal": &fstest.MapFile{
 					Data: []byte("account\n"),
 				},
 			})
 			cache := NewCache(documentCache)
 
-			_, err := cache.Parse(context.Background(), "tmp/foo/bar.journal")
+			_, err := cache.Parse(context.Background(), "/tmp/foo/bar.journal")
 			assert.Error(t, err)
 
-			documentCache.SetFile("tmp/foo/bar.journal", "account assets:Cash:Checking\n")
+			documentCache.SetFile("/tmp/foo/bar.journal", "account assets:Cash:Checking\n")
 
-			_, err = cache.Parse(context.Background(), "tmp/foo/bar.journal")
+			_, err = cache.Parse(context.Background(), "/tmp/foo/bar.journal")
 			assert.Error(t, err)
 		})
 	})
 
 	t.Run("Remove", func(t *testing.T) {
 		t.Run("removes an entry from the cache and makes the next Parse call parse the journal again.", func(t *testing.T) {
-			documentCache := documentcache.NewCache(fstest.MapFS{
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
 				"tmp/foo/bar.journal": &fstest.MapFile{
 					Data: []byte("account assets:Cash:Checking\n"),
 				},
 			})
 			cache := NewCache(documentCache)
 
-			ast, err := cache.Parse(context.Background(), "tmp/foo/bar.journal")
+			ast, err := cache.Parse(context.Background(), "/tmp/foo/bar.journal")
 			pruneMetadataFromAst(ast)
 
 			assert.NoError(t, err)
@@ -140,10 +152,10 @@ func TestParserCache(t *testing.T) {
 				},
 			}, ast)
 
-			cache.Remove("tmp/foo/bar.journal")
-			documentCache.SetFile("tmp/foo/bar.journal", "account assets:Cash:Something Else\n")
+			cache.Remove("/tmp/foo/bar.journal")
+			documentCache.SetFile("/tmp/foo/bar.journal", "account assets:Cash:Something Else\n")
 
-			ast, err = cache.Parse(context.Background(), "tmp/foo/bar.journal")
+			ast, err = cache.Parse(context.Background(), "/tmp/foo/bar.journal")
 			pruneMetadataFromAst(ast)
 
 			assert.NoError(t, err)
@@ -159,17 +171,124 @@ func TestParserCache(t *testing.T) {
 		})
 	})
 
+	t.Run("SetLimits", func(t *testing.T) {
+		t.Run("evicts the least recently used ASTs, but never the ones of documents pinned in the document cache.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/a.journal": &fstest.MapFile{Data: []byte("account a\n")},
+				"ledger/b.journal": &fstest.MapFile{Data: []byte("account b\n")},
+			})
+			documentCache.SetFile("/ledger/open.journal", "account open\n")
+			cache := NewCache(documentCache)
+			cache.SetLimits(lru.Limits{MaxEntries: 2})
+
+			_, err := cache.Parse(context.Background(), "/ledger/open.journal")
+			assert.NoError(t, err)
+			_, err = cache.Parse(context.Background(), "/ledger/a.journal")
+			assert.NoError(t, err)
+			_, err = cache.Parse(context.Background(), "/ledger/b.journal")
+			assert.NoError(t, err)
+			_, err = cache.Parse(context.Background(), "/ledger/open.journal")
+			assert.NoError(t, err)
+
+			stats := cache.Stats()
+			assert.Equal(t, 2, cache.Size())
+			assert.Equal(t, 1, stats.Hits)
+			assert.Equal(t, 3, stats.Misses)
+			assert.Equal(t, 1, stats.Evictions)
+		})
+
+		t.Run("bounds the resolved journals, since they are dropped with the ASTs they were resolved from.", func(t *testing.T) {
+			files := fstest.MapFS{}
+			for i := range 10 {
+				files[fmt.Sprintf("ledger/%d.journal", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("include %d-accounts.journal\n", i))}
+				files[fmt.Sprintf("ledger/%d-accounts.journal", i)] = &fstest.MapFile{Data: []byte("account assets\n")}
+			}
+			cache := NewCache(documentcache.NewCache("/", files))
+			cache.SetLimits(lru.Limits{MaxEntries: 4})
+
+			for i := range 10 {
+				journalFilePath := fmt.Sprintf("/ledger/%d.journal", i)
+				journal, err := cache.Parse(context.Background(), journalFilePath)
+				assert.NoError(t, err)
+				_, err = cache.ResolveIncludes(context.Background(), journal, journalFilePath)
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, 4, cache.Size())
+			assert.True(t, len(cache.resolvedJournals) <= 2)
+			for filePath := range cache.dependents {
+				_, ok := cache.asts.Peek(filePath)
+				assert.True(t, ok, filePath)
+			}
+		})
+	})
+
+	t.Run("Remove with resolved journals", func(t *testing.T) {
+		newCache := func() (*documentcache.DocumentCache, *ParserCache) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/main.journal":     &fstest.MapFile{Data: []byte("include accounts.journal\n")},
+				"ledger/accounts.journal": &fstest.MapFile{Data: []byte("account assets\n")},
+				"ledger/other.journal":    &fstest.MapFile{Data: []byte("account expenses\n")},
+			})
+			return documentCache, NewCache(documentCache)
+		}
+		resolve := func(t *testing.T, cache *ParserCache) *ledger.Journal {
+			t.Helper()
+			journal, err := cache.Parse(context.Background(), "/ledger/main.journal")
+			assert.NoError(t, err)
+			resolvedJournal, err := cache.ResolveIncludes(context.Background(), journal, "/ledger/main.journal")
+			assert.NoError(t, err)
+			return resolvedJournal
+		}
+
+		t.Run("keeps resolved journals that the removed file is not part of.", func(t *testing.T) {
+			_, cache := newCache()
+			resolvedJournal := resolve(t, cache)
+
+			cache.Remove("/ledger/other.journal")
+
+			assert.True(t, resolvedJournal == resolve(t, cache))
+		})
+
+		t.Run("drops the resolved journals of all files including the removed file.", func(t *testing.T) {
+			documentCache, cache := newCache()
+			resolvedJournal := resolve(t, cache)
+
+			documentCache.SetFile("/ledger/accounts.journal", "account liabilities\n")
+			cache.Remove("/ledger/accounts.journal")
+			newResolvedJournal := resolve(t, cache)
+			pruneMetadataFromAst(newResolvedJournal)
+
+			assert.False(t, resolvedJournal == newResolvedJournal)
+			assert.Equal(t, &ledger.Journal{
+				Entries: []ledger.Entry{
+					&ledger.AccountDirective{AccountName: &ledger.AccountName{Segments: []string{"liabilities"}}},
+				},
+			}, newResolvedJournal)
+		})
+
+		t.Run("drops all resolved journals on request.", func(t *testing.T) {
+			_, cache := newCache()
+			resolvedJournal := resolve(t, cache)
+
+			cache.RemoveResolvedJournals()
+
+			assert.False(t, resolvedJournal == resolve(t, cache))
+			assert.Equal(t, 2, cache.Size())
+		})
+	})
+
 	t.Run("ResolveIncludes", func(t *testing.T) {
 		t.Run("it resolves include directives and replaces them in the journal with their parsed content.", func(t *testing.T) {
-			journalFilePath := "some/path/root.journal"
-			includedFilePath := "some/path/to/an/include.journal"
+			journalFilePath := "/some/path/root.journal"
+			includedFilePath := "/some/path/to/an/include.journal"
 
 			fs := fstest.MapFS{
-				includedFilePath: &fstest.MapFile{
+				includedFilePath[1:]: &fstest.MapFile{
 					Data: []byte("account assets:Checking\n"),
 				},
 			}
-			documentCache := documentcache.NewCache(fs)
+			documentCache := documentcache.NewCache("/", fs)
 			cache := NewCache(documentCache)
 			inputJournal := &ledger.Journal{
 				Entries: []ledger.Entry{
@@ -205,16 +324,16 @@ func TestParserCache(t *testing.T) {
 			}, resolvedJournal)
 		})
 
-		t.Run("it never uses absolute paths, instead it converts paths to be relative by removing the preceding /.", func(t *testing.T) {
-			journalFilePath := "some/path/root.journal"
-			includedFilePath := "some/path/to/an/include.journal"
+		t.Run("it resolves absolute include paths as they are.", func(t *testing.T) {
+			journalFilePath := "/some/path/root.journal"
+			includedFilePath := "/some/path/to/an/include.journal"
 
 			fs := fstest.MapFS{
-				includedFilePath: &fstest.MapFile{
+				includedFilePath[1:]: &fstest.MapFile{
 					Data: []byte("account assets:Checking\n"),
 				},
 			}
-			documentCache := documentcache.NewCache(fs)
+			documentCache := documentcache.NewCache("/", fs)
 			cache := NewCache(documentCache)
 			inputJournal := &ledger.Journal{
 				Entries: []ledger.Entry{
@@ -249,5 +368,568 @@ func TestParserCache(t *testing.T) {
 				},
 			}, resolvedJournal)
 		})
+		t.Run("it returns the cached resolved journal, unless a different journal is passed for the file.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/main.journal":     &fstest.MapFile{Data: []byte("include accounts.journal\n")},
+				"ledger/accounts.journal": &fstest.MapFile{Data: []byte("account assets\n")},
+			})
+			cache := NewCache(documentCache)
+			journal, err := cache.Parse(context.Background(), "/ledger/main.journal")
+			assert.NoError(t, err)
+
+			resolvedJournal, err := cache.ResolveIncludes(context.Background(), journal, "/ledger/main.journal")
+			assert.NoError(t, err)
+			cachedJournal, err := cache.ResolveIncludes(context.Background(), journal, "/ledger/main.journal")
+			assert.NoError(t, err)
+			otherJournal, err := cache.ResolveIncludes(context.Background(), &ledger.Journal{}, "/ledger/main.journal")
+			assert.NoError(t, err)
+
+			assert.True(t, resolvedJournal == cachedJournal)
+			assert.Equal(t, 0, len(otherJournal.Entries))
+		})
+	})
+
+	t.Run("ResolveIncludes with nested includes", func(t *testing.T) {
+		resolve := func(t *testing.T, fs fstest.MapFS, rootFilePath string) *ledger.Journal {
+			t.Helper()
+
+			cache := NewCache(documentcache.NewCache("/", fs))
+			journal, err := cache.Parse(context.Background(), rootFilePath)
+			assert.NoError(t, err)
+
+			resolvedJournal, err := cache.ResolveIncludes(context.Background(), journal, rootFilePath)
+			assert.NoError(t, err)
+
+			pruneMetadataFromAst(resolvedJournal)
+			return resolvedJournal
+		}
+		accounts := func(names ...string) *ledger.Journal {
+			journal := &ledger.Journal{Entries: make([]ledger.Entry, len(names))}
+			for i, name := range names {
+				journal.Entries[i] = &ledger.AccountDirective{AccountName: &ledger.AccountName{Segments: []string{name}}}
+			}
+			return journal
+		}
+
+		t.Run("resolves the includes of each file relative to that file in a deep layout.", func(t *testing.T) {
+			resolvedJournal := resolve(t, fstest.MapFS{
+				"ledger/2026/main.journal":               &fstest.MapFile{Data: []byte("include months/*.journal\n")},
+				"ledger/2026/months/01.journal":          &fstest.MapFile{Data: []byte("account january\ninclude 01/receipts.journal\n")},
+				"ledger/2026/months/02.journal":          &fstest.MapFile{Data: []byte("account february\n")},
+				"ledger/2026/months/01/receipts.journal": &fstest.MapFile{Data: []byte("account receipts\n")},
+			}, "/ledger/2026/main.journal")
+
+			assert.Equal(t, accounts("january", "receipts", "february"), resolvedJournal)
+		})
+
+		t.Run("resolves includes of sibling directories.", func(t *testing.T) {
+			resolvedJournal := resolve(t, fstest.MapFS{
+				"ledger/main.journal":            &fstest.MapFile{Data: []byte("include 2026/main.journal\n")},
+				"ledger/2026/main.journal":       &fstest.MapFile{Data: []byte("include ../shared/accounts.journal\naccount main\n")},
+				"ledger/shared/accounts.journal": &fstest.MapFile{Data: []byte("account shared\n")},
+			}, "/ledger/main.journal")
+
+			assert.Equal(t, accounts("shared", "main"), resolvedJournal)
+		})
+
+		t.Run("resolves absolute includes of nested files independent of their directory.", func(t *testing.T) {
+			resolvedJournal := resolve(t, fstest.MapFS{
+				"ledger/main.journal":       &fstest.MapFile{Data: []byte("include 2026/main.journal\n")},
+				"ledger/2026/main.journal":  &fstest.MapFile{Data: []byte("include /etc/ledger/prices.journal\n")},
+				"etc/ledger/prices.journal": &fstest.MapFile{Data: []byte("account prices\n")},
+			}, "/ledger/main.journal")
+
+			assert.Equal(t, accounts("prices"), resolvedJournal)
+		})
+	})
+
+	t.Run("ResolveIncludes with globs", func(t *testing.T) {
+		t.Run("includes all matching journals in sorted order and skips files in other formats.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/2024.journal":  &fstest.MapFile{Data: []byte("account b\n")},
+				"ledger/2023.journal":  &fstest.MapFile{Data: []byte("account a\n")},
+				"ledger/hours.timedot": &fstest.MapFile{Data: []byte("2024-01-01\nfos.haskell  ....\n")},
+				"ledger/hours.md":      &fstest.MapFile{Data: []byte("# Hours\n")},
+			})
+			cache := NewCache(documentCache)
+			inputJournal := &ledger.Journal{
+				Entries: []ledger.Entry{
+					&ledger.IncludeDirective{IncludePath: "*.journal"},
+					&ledger.IncludeDirective{IncludePath: "hours.timedot"},
+					&ledger.IncludeDirective{IncludePath: "timedot:hours.md"},
+				},
+			}
+
+			resolvedJournal, err := cache.ResolveIncludes(context.Background(), inputJournal, "/ledger/main.journal")
+			pruneMetadataFromAst(resolvedJournal)
+
+			assert.NoError(t, err)
+			assert.Equal(t, &ledger.Journal{
+				Entries: []ledger.Entry{
+					&ledger.AccountDirective{AccountName: &ledger.AccountName{Segments: []string{"a"}}},
+					&ledger.AccountDirective{AccountName: &ledger.AccountName{Segments: []string{"b"}}},
+				},
+			}, resolvedJournal)
+		})
+	})
+
+	t.Run("ResolveIncludePath", func(t *testing.T) {
+		t.Run("resolves a relative path relative to the directory of the journal.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"some/path/to/an/include.journal": &fstest.MapFile{},
+			})
+			cache := NewCache(documentCache)
+
+			filePaths, err := cache.ResolveIncludePath(context.Background(), "/some/path/root.journal", "to/an/include.journal")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/some/path/to/an/include.journal"}, filePaths)
+		})
+
+		t.Run("expands glob patterns to all matching files.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"some/path/2024.journal": &fstest.MapFile{},
+				"some/path/2023.journal": &fstest.MapFile{},
+			})
+			cache := NewCache(documentCache)
+
+			filePaths, err := cache.ResolveIncludePath(context.Background(), "/root.journal", "/some/path/*.journal")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/some/path/2023.journal", "/some/path/2024.journal"}, filePaths)
+		})
+
+		t.Run("expands ** to any number of directories and never includes the journal itself.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/main.journal":         &fstest.MapFile{},
+				"ledger/2024/main.journal":    &fstest.MapFile{},
+				"ledger/2024/01/food.journal": &fstest.MapFile{},
+			})
+			cache := NewCache(documentCache)
+
+			filePaths, err := cache.ResolveIncludePath(context.Background(), "/ledger/main.journal", "**/*.journal")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/ledger/2024/01/food.journal", "/ledger/2024/main.journal"}, filePaths)
+		})
+
+		t.Run("expands ~ to the home directory and ignores format prefixes.", func(t *testing.T) {
+			originalUserHomeDir := userHomeDir
+			userHomeDir = func() (string, error) { return "/home/user", nil }
+			defer func() { userHomeDir = originalUserHomeDir }()
+
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"home/user/time/hours.md": &fstest.MapFile{},
+			})
+			cache := NewCache(documentCache)
+
+			filePaths, err := cache.ResolveIncludePath(context.Background(), "/some/path/root.journal", "timedot:~/time/hours.md")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/home/user/time/hours.md"}, filePaths)
+		})
+
+		t.Run("fails if no file matches.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{})
+			cache := NewCache(documentCache)
+
+			_, err := cache.ResolveIncludePath(context.Background(), "/some/path/root.journal", "*.journal")
+
+			assert.IsError(t, err, ErrIncludeNotFound)
+		})
+	})
+
+	t.Run("BuildIncludeGraph", func(t *testing.T) {
+		t.Run("records which root journals reach each file.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/2023.journal":     &fstest.MapFile{Data: []byte("include accounts.journal\n")},
+				"ledger/2024.journal":     &fstest.MapFile{Data: []byte("include accounts.journal\ninclude 2024/*.journal\n")},
+				"ledger/accounts.journal": &fstest.MapFile{Data: []byte("account assets\n")},
+				"ledger/2024/01.journal":  &fstest.MapFile{Data: []byte("account expenses\n")},
+			})
+			cache := NewCache(documentCache)
+
+			graph := cache.BuildIncludeGraph(context.Background(), "/ledger/2023.journal", "/ledger/2024.journal")
+
+			assert.Equal(t, []string{"/ledger/2023.journal", "/ledger/2024.journal"}, graph.Roots())
+			assert.Equal(t, []string{"/ledger/2023.journal", "/ledger/2024.journal"}, graph.RootsReaching("/ledger/accounts.journal"))
+			assert.Equal(t, []string{"/ledger/2024.journal"}, graph.RootsReaching("/ledger/2024/01.journal"))
+			assert.Equal(t, []string{"/ledger/2024.journal"}, graph.RootsReaching("/ledger/2024.journal"))
+			assert.Equal(t, 2, len(graph.Includes("/ledger/2024.journal")))
+			assert.Equal(t, 0, len(graph.Cycles()))
+		})
+
+		t.Run("reports how many of the discovered files have been parsed.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/2023.journal":     &fstest.MapFile{Data: []byte("include accounts.journal\n")},
+				"ledger/2024.journal":     &fstest.MapFile{Data: []byte("include accounts.journal\ninclude 2024/*.journal\n")},
+				"ledger/accounts.journal": &fstest.MapFile{Data: []byte("account assets\n")},
+				"ledger/2024/01.journal":  &fstest.MapFile{Data: []byte("account expenses\n")},
+			})
+			cache := NewCache(documentCache)
+
+			progress := make([][2]int, 0)
+			cache.BuildIncludeGraphWithProgress(context.Background(), func(parsedCount int, discoveredCount int) {
+				progress = append(progress, [2]int{parsedCount, discoveredCount})
+			}, "/ledger/2023.journal", "/ledger/2024.journal")
+
+			// Files are parsed concurrently, so the order of the reports varies.
+			assert.Equal(t, 4, len(progress))
+			for i, report := range progress {
+				assert.Equal(t, i+1, report[0])
+				assert.True(t, report[0] <= report[1])
+			}
+			assert.Equal(t, [2]int{4, 4}, progress[3])
+		})
+
+		t.Run("detects journals that include themselves, directly or indirectly.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/main.journal": &fstest.MapFile{Data: []byte("include a.journal\ninclude main.journal\n")},
+				"ledger/a.journal":    &fstest.MapFile{Data: []byte("include b.journal\n")},
+				"ledger/b.journal":    &fstest.MapFile{Data: []byte("account assets\ninclude a.journal\n")},
+			})
+			cache := NewCache(documentCache)
+
+			graph := cache.BuildIncludeGraph(context.Background(), "/ledger/main.journal")
+			cycles := graph.Cycles()
+
+			assert.Equal(t, 2, len(cycles))
+			assert.Equal(t, "/ledger/b.journal", cycles[0].Edge.From)
+			assert.Equal(t, "/ledger/a.journal", cycles[0].Edge.To)
+			assert.Equal(t, 2, cycles[0].Edge.Directive.Pos.Line)
+			assert.Equal(t, []string{"/ledger/a.journal", "/ledger/b.journal"}, cycles[0].Files)
+			assert.Equal(t, "/ledger/main.journal", cycles[1].Edge.From)
+			assert.Equal(t, []string{"/ledger/main.journal"}, cycles[1].Files)
+
+			cyclesInA := graph.CyclesIn("/ledger/a.journal")
+			assert.Equal(t, 1, len(cyclesInA))
+			assert.Equal(t, "/ledger/b.journal", cyclesInA[0].Edge.To)
+			assert.Equal(t, 1, cyclesInA[0].Edge.Directive.Pos.Line)
+			assert.Equal(t, []string{"/ledger/a.journal", "/ledger/b.journal"}, cyclesInA[0].Files)
+
+			cyclesInMain := graph.CyclesIn("/ledger/main.journal")
+			assert.Equal(t, 1, len(cyclesInMain))
+			assert.Equal(t, 2, cyclesInMain[0].Edge.Directive.Pos.Line)
+		})
+
+		t.Run("does not recurse endlessly when resolving includes with a cycle.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/main.journal": &fstest.MapFile{Data: []byte("include a.journal\n")},
+				"ledger/a.journal":    &fstest.MapFile{Data: []byte("account assets\ninclude main.journal\n")},
+			})
+			cache := NewCache(documentCache)
+			journal, err := cache.Parse(context.Background(), "/ledger/main.journal")
+			assert.NoError(t, err)
+
+			resolvedJournal, err := cache.ResolveIncludes(context.Background(), journal, "/ledger/main.journal")
+			pruneMetadataFromAst(resolvedJournal)
+
+			assert.NoError(t, err)
+			assert.Equal(t, &ledger.Journal{
+				Entries: []ledger.Entry{
+					&ledger.AccountDirective{AccountName: &ledger.AccountName{Segments: []string{"assets"}}},
+				},
+			}, resolvedJournal)
+		})
+	})
+
+	t.Run("FindJournals", func(t *testing.T) {
+		t.Run("finds the files with a journal extension below the directory.", func(t *testing.T) {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/main.journal":       &fstest.MapFile{Data: []byte("include 2024/*.journal\n")},
+				"ledger/2024/01.journal":    &fstest.MapFile{Data: []byte("")},
+				"ledger/2024/hours.timedot": &fstest.MapFile{Data: []byte("")},
+				"ledger/notes.md":           &fstest.MapFile{Data: []byte("")},
+				"other/other.hledger":       &fstest.MapFile{Data: []byte("")},
+			})
+			cache := NewCache(documentCache)
+
+			journals, err := cache.FindJournals(context.Background(), "/ledger")
+
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"/ledger/2024/01.journal", "/ledger/main.journal"}, journals)
+		})
+	})
+
+	t.Run("FindRootJournals", func(t *testing.T) {
+		documentCache := documentcache.NewCache("/", fstest.MapFS{
+			"ledger/main.journal":     &fstest.MapFile{Data: []byte("include 2023.journal\ninclude 2024.journal\n")},
+			"ledger/2023.journal":     &fstest.MapFile{Data: []byte("include accounts.journal\n")},
+			"ledger/2024.journal":     &fstest.MapFile{Data: []byte("include accounts.journal\n")},
+			"ledger/accounts.journal": &fstest.MapFile{Data: []byte("account assets\n")},
+			"ledger/budget.journal":   &fstest.MapFile{Data: []byte("include accounts.journal\n")},
+			"ledger/a.journal":        &fstest.MapFile{Data: []byte("include b.journal\n")},
+			"ledger/b.journal":        &fstest.MapFile{Data: []byte("include a.journal\n")},
+		})
+		candidates := []string{
+			"/ledger/2023.journal",
+			"/ledger/2024.journal",
+			"/ledger/a.journal",
+			"/ledger/accounts.journal",
+			"/ledger/b.journal",
+			"/ledger/budget.journal",
+			"/ledger/main.journal",
+		}
+
+		t.Run("returns the outermost journals including the file.", func(t *testing.T) {
+			cache := NewCache(documentCache)
+
+			rootJournals := cache.FindRootJournals(context.Background(), "/ledger/accounts.journal", candidates)
+
+			assert.Equal(t, []string{"/ledger/budget.journal", "/ledger/main.journal"}, rootJournals)
+		})
+
+		t.Run("returns the file itself if no other journal includes it.", func(t *testing.T) {
+			cache := NewCache(documentCache)
+
+			rootJournals := cache.FindRootJournals(context.Background(), "/ledger/main.journal", candidates)
+
+			assert.Equal(t, []string{"/ledger/main.journal"}, rootJournals)
+		})
+
+		t.Run("returns all journals of an include cycle.", func(t *testing.T) {
+			cache := NewCache(documentCache)
+
+			rootJournals := cache.FindRootJournals(context.Background(), "/ledger/a.journal", candidates)
+
+			assert.Equal(t, []string{"/ledger/a.journal", "/ledger/b.journal"}, rootJournals)
+		})
+
+		t.Run("returns nothing for files that are not reached.", func(t *testing.T) {
+			cache := NewCache(documentCache)
+
+			rootJournals := cache.FindRootJournals(context.Background(), "/ledger/unknown.journal", candidates)
+
+			assert.Equal(t, 0, len(rootJournals))
+		})
+	})
+}
+
+// countingFS counts how often each file is opened and delays opening, so
+// that concurrent calls overlap. It also records how many files were opened
+// at the same time at most.
+type countingFS struct {
+	fstest.MapFS
+	mutex        sync.Mutex
+	opens        map[string]int
+	openCount    int
+	maxOpenCount int
+}
+
+func (countingFS *countingFS) Open(name string) (fs.File, error) {
+	countingFS.mutex.Lock()
+	countingFS.opens[name] += 1
+	countingFS.openCount += 1
+	countingFS.maxOpenCount = max(countingFS.maxOpenCount, countingFS.openCount)
+	countingFS.mutex.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	countingFS.mutex.Lock()
+	countingFS.openCount -= 1
+	countingFS.mutex.Unlock()
+	return countingFS.MapFS.Open(name)
+}
+
+func TestParserCacheConcurrency(t *testing.T) {
+	t.Run("concurrent Parse calls for the same file share one parse.", func(t *testing.T) {
+		workspace := &countingFS{
+			MapFS: fstest.MapFS{
+				"ledger/main.journal": &fstest.MapFile{Data: []byte("account assets\n")},
+			},
+			opens: make(map[string]int),
+		}
+		cache := NewCache(documentcache.NewCache("/", workspace))
+
+		journals := make([]*ledger.Journal, 10)
+		var waitGroup sync.WaitGroup
+		for i := range journals {
+			waitGroup.Add(1)
+			go func() {
+				defer waitGroup.Done()
+				journals[i], _ = cache.Parse(context.Background(), "/ledger/main.journal")
+			}()
+		}
+		waitGroup.Wait()
+
+		assert.Equal(t, 1, workspace.opens["ledger/main.journal"])
+		for _, journal := range journals {
+			assert.True(t, journal == journals[0])
+		}
+	})
+
+	t.Run("ResolveIncludes merges concurrently parsed includes in the order of the include directives.", func(t *testing.T) {
+		mapFS := fstest.MapFS{}
+		mainJournal := ""
+		expectedAccounts := make([]string, 0)
+		for i := range 20 {
+			mainJournal += fmt.Sprintf("account main%02d\ninclude %02d.journal\n", i, i)
+			mapFS[fmt.Sprintf("ledger/%02d.journal", i)] = &fstest.MapFile{
+				Data: []byte(fmt.Sprintf("account file%02d\ninclude %02d/*.journal\n", i, i)),
+			}
+			mapFS[fmt.Sprintf("ledger/%02d/a.journal", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("account nested%02da\n", i))}
+			mapFS[fmt.Sprintf("ledger/%02d/b.journal", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("account nested%02db\n", i))}
+			expectedAccounts = append(expectedAccounts,
+				fmt.Sprintf("main%02d", i),
+				fmt.Sprintf("file%02d", i),
+				fmt.Sprintf("nested%02da", i),
+				fmt.Sprintf("nested%02db", i),
+			)
+		}
+		mapFS["ledger/main.journal"] = &fstest.MapFile{Data: []byte(mainJournal)}
+		cache := NewCache(documentcache.NewCache("/", &countingFS{MapFS: mapFS, opens: make(map[string]int)}))
+
+		journal, err := cache.Parse(context.Background(), "/ledger/main.journal")
+		assert.NoError(t, err)
+		resolvedJournal, err := cache.ResolveIncludes(context.Background(), journal, "/ledger/main.journal")
+		assert.NoError(t, err)
+
+		accounts := make([]string, 0)
+		for _, entry := range resolvedJournal.Entries {
+			accounts = append(accounts, entry.(*ledger.AccountDirective).AccountName.String())
+		}
+		assert.Equal(t, expectedAccounts, accounts)
+	})
+
+	t.Run("BuildIncludeGraph parses included files concurrently and keeps the order of the include directives.", func(t *testing.T) {
+		mapFS := fstest.MapFS{}
+		mainJournal := ""
+		expectedIncludes := make([]string, 0)
+		for i := range 20 {
+			mainJournal += fmt.Sprintf("include %02d.journal\n", i)
+			mapFS[fmt.Sprintf("ledger/%02d.journal", i)] = &fstest.MapFile{Data: []byte(fmt.Sprintf("account file%02d\n", i))}
+			expectedIncludes = append(expectedIncludes, fmt.Sprintf("/ledger/%02d.journal", i))
+		}
+		mapFS["ledger/main.journal"] = &fstest.MapFile{Data: []byte(mainJournal)}
+		workspace := &countingFS{MapFS: mapFS, opens: make(map[string]int)}
+		cache := NewCache(documentcache.NewCache("/", workspace))
+		// The slots default to the number of processors, which may be one.
+		cache.parseSlots = make(chan struct{}, 4)
+
+		graph := cache.BuildIncludeGraph(context.Background(), "/ledger/main.journal")
+
+		includes := make([]string, 0)
+		for _, edge := range graph.Includes("/ledger/main.journal") {
+			includes = append(includes, edge.To)
+		}
+		assert.Equal(t, expectedIncludes, includes)
+		assert.Equal(t, []string{"/ledger/main.journal"}, graph.RootsReaching("/ledger/19.journal"))
+		assert.True(t, workspace.maxOpenCount > 1)
+		assert.True(t, workspace.maxOpenCount <= 4)
+	})
+
+	t.Run("ResolveIncludes returns the error of the first failing include.", func(t *testing.T) {
+		cache := NewCache(documentcache.NewCache("/", fstest.MapFS{
+			"ledger/main.journal": &fstest.MapFile{Data: []byte("include a.journal\ninclude missing.journal\ninclude b.journal\n")},
+			"ledger/a.journal":    &fstest.MapFile{Data: []byte("account a\n")},
+			"ledger/b.journal":    &fstest.MapFile{Data: []byte("account\n")},
+		}))
+
+		journal, err := cache.Parse(context.Background(), "/ledger/main.journal")
+		assert.NoError(t, err)
+		_, err = cache.ResolveIncludes(context.Background(), journal, "/ledger/main.journal")
+
+		assert.IsError(t, err, ErrIncludeNotFound)
+	})
+
+	t.Run("Parse and ResolveIncludes fail with a cancelled context and do not cache anything.", func(t *testing.T) {
+		cache := NewCache(documentcache.NewCache("/", fstest.MapFS{
+			"ledger/main.journal": &fstest.MapFile{Data: []byte("include a.journal\n")},
+			"ledger/a.journal":    &fstest.MapFile{Data: []byte("account a\n")},
+		}))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := cache.Parse(ctx, "/ledger/main.journal")
+		assert.IsError(t, err, context.Canceled)
+
+		journal, err := cache.Parse(context.Background(), "/ledger/main.journal")
+		assert.NoError(t, err)
+		_, err = cache.ResolveIncludes(ctx, journal, "/ledger/main.journal")
+		assert.IsError(t, err, context.Canceled)
+		assert.Equal(t, 1, cache.Size())
+	})
+
+	t.Run("Parse calls waiting for a cancelled parse parse the file themselves.", func(t *testing.T) {
+		workspace := &countingFS{
+			MapFS: fstest.MapFS{
+				"ledger/main.journal": &fstest.MapFile{Data: []byte("account assets\n")},
+			},
+			opens: make(map[string]int),
+		}
+		cache := NewCache(documentcache.NewCache("/", workspace))
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var cancelledErr error
+		var waitGroup sync.WaitGroup
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			_, cancelledErr = cache.Parse(ctx, "/ledger/main.journal")
+		}()
+
+		// Opening the file takes longer than this, so the second call waits
+		// for the first one.
+		time.Sleep(2 * time.Millisecond)
+		waitGroup.Add(1)
+		var journal *ledger.Journal
+		var err error
+		go func() {
+			defer waitGroup.Done()
+			journal, err = cache.Parse(context.Background(), "/ledger/main.journal")
+		}()
+		time.Sleep(2 * time.Millisecond)
+		cancel()
+		waitGroup.Wait()
+
+		assert.IsError(t, cancelledErr, context.Canceled)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(journal.Entries))
+	})
+}
+
+func BenchmarkParserCacheResolveIncludes(b *testing.B) {
+	workspace := fstest.MapFS{}
+	for fileName, content := range journalgen.Generate(journalgen.DefaultOptions) {
+		workspace["ledger/"+fileName] = &fstest.MapFile{Data: []byte(content)}
+	}
+	rootJournal := "/ledger/" + journalgen.RootJournal
+
+	resolve := func(b *testing.B, cache *ParserCache) {
+		journal, err := cache.Parse(context.Background(), rootJournal)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := cache.ResolveIncludes(context.Background(), journal, rootJournal); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("without cached files", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			resolve(b, NewCache(documentcache.NewCache("/", workspace)))
+		}
+	})
+
+	b.Run("after an included file changed", func(b *testing.B) {
+		cache := NewCache(documentcache.NewCache("/", workspace))
+		resolve(b, cache)
+
+		b.ReportAllocs()
+		for b.Loop() {
+			cache.Remove("/ledger/" + journalgen.IncludedJournal(0))
+			resolve(b, cache)
+		}
+	})
+
+	b.Run("without changes", func(b *testing.B) {
+		cache := NewCache(documentcache.NewCache("/", workspace))
+		resolve(b, cache)
+
+		b.ReportAllocs()
+		for b.Loop() {
+			resolve(b, cache)
+		}
 	})
 }
@@ -0,0 +1,58 @@
+package parsercache
+
+import (
+	"context"
+	"path"
+	"slices"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/yeldirium/hledger-language-server/internal/telemetry"
+)
+
+// FindJournals returns all files below the given directory that have the
+// extension of a journal, sorted. Files with an unknown extension are left
+// out, even though hledger would read them as journals when included.
+func (cache *ParserCache) FindJournals(ctx context.Context, directory string) ([]string, error) {
+	tracer := telemetry.TracerFromContext(ctx)
+	_, span := tracer.Start(ctx, "parsercache/findJournals")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.String("parsercache.directory", directory),
+	)
+
+	files, err := cache.documentCache.Glob(path.Join(directory, "**", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	journals := slices.DeleteFunc(files, func(filePath string) bool {
+		return !HasJournalExtension(filePath)
+	})
+
+	span.SetAttributes(
+		attribute.Int("parsercache.journalCount", len(journals)),
+	)
+
+	return journals, nil
+}
+
+// FindRootJournals returns those of the candidate journals that include the
+// given file, directly or indirectly, and are not included by another one of
+// them themselves, sorted. A candidate that is the file itself counts as
+// including it. Candidates that include each other are all returned.
+func (cache *ParserCache) FindRootJournals(ctx context.Context, filePath string, candidates []string) []string {
+	includeGraph := cache.BuildIncludeGraph(ctx, candidates...)
+
+	rootJournals := slices.DeleteFunc(slices.Clone(includeGraph.RootsReaching(filePath)), func(candidate string) bool {
+		for _, includingJournal := range includeGraph.RootsReaching(candidate) {
+			if includingJournal != candidate && !slices.Contains(includeGraph.RootsReaching(includingJournal), candidate) {
+				return true
+			}
+		}
+		return false
+	})
+	slices.Sort(rootJournals)
+	return rootJournals
+}
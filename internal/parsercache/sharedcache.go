@@ -0,0 +1,58 @@
+package parsercache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+	"github.com/yeldirium/hledger-language-server/internal/lru"
+)
+
+// SharedCache keeps ASTs in memory for several parser caches, like the ones
+// of the clients connected to the same server. Like in the disk cache, entries
+// are keyed by the path and the content of the journal, so parser caches that
+// see different content for a file never get each other's ASTs.
+type SharedCache struct {
+	sync.Mutex
+	asts *lru.Cache[string, *ledger.Journal]
+}
+
+func NewSharedCache(limits lru.Limits) *SharedCache {
+	return &SharedCache{
+		asts: lru.New[string, *ledger.Journal](limits),
+	}
+}
+
+func sharedCacheKey(filePath string, content []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(filePath))
+	hash.Write([]byte{0})
+	hash.Write(content)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Load returns the AST stored for the journal with the given content.
+func (cache *SharedCache) Load(filePath string, content []byte) (*ledger.Journal, bool) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	return cache.asts.Get(sharedCacheKey(filePath, content))
+}
+
+// Store keeps the AST of the journal with the given content. The AST must not
+// be changed afterwards, since other parser caches may use it.
+func (cache *SharedCache) Store(filePath string, content []byte, journal *ledger.Journal) {
+	cache.Lock()
+	defer cache.Unlock()
+
+	cache.asts.Add(sharedCacheKey(filePath, content), journal, len(content), false)
+}
+
+// Stats returns how often ASTs were found in the cache and evicted.
+func (cache *SharedCache) Stats() lru.Stats {
+	cache.Lock()
+	defer cache.Unlock()
+
+	return cache.asts.Stats()
+}
@@ -0,0 +1,60 @@
+package parsercache
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alecthomas/assert/v2"
+
+	"github.com/yeldirium/hledger-language-server/internal/documentcache"
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+	"github.com/yeldirium/hledger-language-server/internal/lru"
+)
+
+func TestSharedCache(t *testing.T) {
+	content := []byte("account assets:Cash\n2024-11-25 Payee\n    assets:Cash  10 €\n    expenses:Food\n")
+
+	t.Run("loads the stored AST for the same path and content only.", func(t *testing.T) {
+		sharedCache := NewSharedCache(lru.Limits{})
+		journal, err := ledger.NewJournalParser().ParseBytes("/ledger/main.journal", content)
+		assert.NoError(t, err)
+
+		sharedCache.Store("/ledger/main.journal", content, journal)
+
+		loadedJournal, ok := sharedCache.Load("/ledger/main.journal", content)
+		assert.True(t, ok)
+		assert.True(t, journal == loadedJournal)
+		_, ok = sharedCache.Load("/ledger/other.journal", content)
+		assert.False(t, ok)
+		_, ok = sharedCache.Load("/ledger/main.journal", []byte("account assets\n"))
+		assert.False(t, ok)
+	})
+
+	t.Run("shares the ASTs of documents that are not pinned between parser caches.", func(t *testing.T) {
+		sharedCache := NewSharedCache(lru.Limits{})
+		newParserCache := func() *ParserCache {
+			documentCache := documentcache.NewCache("/", fstest.MapFS{
+				"ledger/main.journal": &fstest.MapFile{Data: content},
+			})
+			documentCache.SetFile("/ledger/open.journal", "account expenses\n")
+			cache := NewCache(documentCache)
+			cache.SetSharedCache(sharedCache)
+			return cache
+		}
+		cache, otherCache := newParserCache(), newParserCache()
+
+		journal, err := cache.Parse(context.Background(), "/ledger/main.journal")
+		assert.NoError(t, err)
+		openJournal, err := cache.Parse(context.Background(), "/ledger/open.journal")
+		assert.NoError(t, err)
+
+		otherJournal, err := otherCache.Parse(context.Background(), "/ledger/main.journal")
+		assert.NoError(t, err)
+		assert.True(t, journal == otherJournal)
+		otherOpenJournal, err := otherCache.Parse(context.Background(), "/ledger/open.journal")
+		assert.NoError(t, err)
+		assert.False(t, openJournal == otherOpenJournal)
+		assert.Equal(t, 1, sharedCache.Stats().Hits)
+	})
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+// errDocumentChanged is the cause of cancelling requests whose document
+// changed before they were handled.
+var errDocumentChanged = errors.New("document changed")
+
+// supersededMethods are the requests whose results are useless once their
+// document changes. Clients send them again for the new content anyway.
+var supersededMethods = map[string]bool{
+	protocol.MethodTextDocumentCompletion: true,
+	protocol.MethodTextDocumentHover:      true,
+}
+
+type runningRequest struct {
+	cancel context.CancelCauseFunc
+	// documentURI is set for requests that are superseded by changes of
+	// their document.
+	documentURI protocol.DocumentURI
+}
+
+// requestCanceller keeps the contexts of the requests that have been
+// received, but not replied to yet.
+type requestCanceller struct {
+	sync.Mutex
+	requests map[jsonrpc2.ID]runningRequest
+}
+
+func (canceller *requestCanceller) add(id jsonrpc2.ID, request runningRequest) {
+	canceller.Lock()
+	defer canceller.Unlock()
+
+	canceller.requests[id] = request
+}
+
+func (canceller *requestCanceller) remove(id jsonrpc2.ID) {
+	canceller.Lock()
+	defer canceller.Unlock()
+
+	delete(canceller.requests, id)
+}
+
+func (canceller *requestCanceller) cancel(id jsonrpc2.ID) {
+	canceller.Lock()
+	defer canceller.Unlock()
+
+	if request, ok := canceller.requests[id]; ok {
+		request.cancel(context.Canceled)
+	}
+}
+
+// supersede cancels the requests for the document, which were all received
+// before the change of the document.
+func (canceller *requestCanceller) supersede(documentURI protocol.DocumentURI) {
+	canceller.Lock()
+	defer canceller.Unlock()
+
+	for _, request := range canceller.requests {
+		if request.documentURI == documentURI {
+			request.cancel(errDocumentChanged)
+		}
+	}
+}
+
+// documentURIFromParams returns the URI of the text document the parameters
+// refer to, if any.
+func documentURIFromParams(params json.RawMessage) protocol.DocumentURI {
+	var textDocumentParams struct {
+		TextDocument struct {
+			URI protocol.DocumentURI `json:"uri"`
+		} `json:"textDocument"`
+	}
+	_ = json.Unmarshal(params, &textDocumentParams)
+	return textDocumentParams.TextDocument.URI
+}
+
+// CancellationHandler gives each request a context that is cancelled when the
+// client sends $/cancelRequest for it, and cancels completion and hover
+// requests whose document changes before they are handled. Cancelled requests
+// are answered with an error instead of their result.
+//
+// Cancellation only has an effect if the wrapped handler handles requests
+// asynchronously, since otherwise no further messages are read while a
+// request is handled.
+func CancellationHandler(handler jsonrpc2.Handler) jsonrpc2.Handler {
+	canceller := &requestCanceller{
+		requests: make(map[jsonrpc2.ID]runningRequest),
+	}
+
+	return func(ctx context.Context, reply jsonrpc2.Replier, req jsonrpc2.Request) error {
+		switch req.Method() {
+		case protocol.MethodCancelRequest:
+			var params struct {
+				ID jsonrpc2.ID `json:"id"`
+			}
+			if err := json.Unmarshal(req.Params(), &params); err != nil {
+				return reply(ctx, nil, fmt.Errorf("%s: %w", jsonrpc2.ErrParse, err))
+			}
+			canceller.cancel(params.ID)
+			return reply(ctx, nil, nil)
+		case protocol.MethodTextDocumentDidChange:
+			canceller.supersede(documentURIFromParams(req.Params()))
+		}
+
+		call, ok := req.(*jsonrpc2.Call)
+		if !ok {
+			return handler(ctx, reply, req)
+		}
+
+		requestCtx, cancel := context.WithCancelCause(ctx)
+		request := runningRequest{cancel: cancel}
+		if supersededMethods[req.Method()] {
+			request.documentURI = documentURIFromParams(req.Params())
+		}
+		canceller.add(call.ID(), request)
+
+		innerReply := reply
+		reply = func(ctx context.Context, result interface{}, err error) error {
+			canceller.remove(call.ID())
+			if requestCtx.Err() != nil {
+				result = nil
+				err = protocol.ErrRequestCancelled
+				if errors.Is(context.Cause(requestCtx), errDocumentChanged) {
+					err = protocol.ErrContentModified
+				}
+			}
+			cancel(nil)
+
+			return innerReply(context.WithoutCancel(ctx), result, err)
+		}
+
+		return handler(requestCtx, reply, req)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+)
+
+type reply struct {
+	result interface{}
+	err    error
+}
+
+// blockingHandler handles requests in the background until their context is
+// cancelled or they are released, like the asynchronous handler of the server.
+func blockingHandler(release <-chan struct{}) jsonrpc2.Handler {
+	return func(ctx context.Context, replier jsonrpc2.Replier, req jsonrpc2.Request) error {
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-release:
+			}
+			_ = replier(ctx, "result", nil)
+		}()
+		return nil
+	}
+}
+
+func recordReply(replies chan<- reply) jsonrpc2.Replier {
+	return func(ctx context.Context, result interface{}, err error) error {
+		replies <- reply{result, err}
+		return nil
+	}
+}
+
+func textDocumentCall(t *testing.T, id int32, method string, uri protocol.DocumentURI) jsonrpc2.Request {
+	t.Helper()
+	call, err := jsonrpc2.NewCall(jsonrpc2.NewNumberID(id), method, &protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+	assert.NoError(t, err)
+	return call
+}
+
+func TestCancellationHandler(t *testing.T) {
+	t.Run("cancels a request on $/cancelRequest and replies with an error.", func(t *testing.T) {
+		handler := CancellationHandler(blockingHandler(nil))
+		replies := make(chan reply, 1)
+
+		err := handler(context.Background(), recordReply(replies), textDocumentCall(t, 1, protocol.MethodTextDocumentDefinition, "file:///a.journal"))
+		assert.NoError(t, err)
+
+		cancel, err := jsonrpc2.NewNotification(protocol.MethodCancelRequest, map[string]int{"id": 1})
+		assert.NoError(t, err)
+		err = handler(context.Background(), func(context.Context, interface{}, error) error { return nil }, cancel)
+		assert.NoError(t, err)
+
+		assert.Equal(t, reply{nil, protocol.ErrRequestCancelled}, <-replies)
+	})
+
+	t.Run("drops completion and hover requests for a document that changed.", func(t *testing.T) {
+		release := make(chan struct{})
+		handler := CancellationHandler(blockingHandler(release))
+		replies := make(chan reply, 3)
+
+		for i, method := range []string{protocol.MethodTextDocumentCompletion, protocol.MethodTextDocumentHover} {
+			err := handler(context.Background(), recordReply(replies), textDocumentCall(t, int32(i), method, "file:///a.journal"))
+			assert.NoError(t, err)
+		}
+
+		change, err := jsonrpc2.NewNotification(protocol.MethodTextDocumentDidChange, &protocol.DidChangeTextDocumentParams{
+			TextDocument: protocol.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: "file:///a.journal"},
+			},
+		})
+		assert.NoError(t, err)
+		err = handler(context.Background(), func(context.Context, interface{}, error) error { return nil }, change)
+		assert.NoError(t, err)
+
+		assert.Equal(t, reply{nil, protocol.ErrContentModified}, <-replies)
+		assert.Equal(t, reply{nil, protocol.ErrContentModified}, <-replies)
+		close(release)
+	})
+
+	t.Run("keeps requests for other documents and other methods when a document changes.", func(t *testing.T) {
+		release := make(chan struct{})
+		handler := CancellationHandler(blockingHandler(release))
+		replies := make(chan reply, 2)
+
+		err := handler(context.Background(), recordReply(replies), textDocumentCall(t, 1, protocol.MethodTextDocumentCompletion, "file:///b.journal"))
+		assert.NoError(t, err)
+		err = handler(context.Background(), recordReply(replies), textDocumentCall(t, 2, protocol.MethodTextDocumentDefinition, "file:///a.journal"))
+		assert.NoError(t, err)
+
+		change, err := jsonrpc2.NewNotification(protocol.MethodTextDocumentDidChange, &protocol.DidChangeTextDocumentParams{
+			TextDocument: protocol.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: "file:///a.journal"},
+			},
+		})
+		assert.NoError(t, err)
+		err = handler(context.Background(), func(context.Context, interface{}, error) error { return nil }, change)
+		assert.NoError(t, err)
+		close(release)
+
+		assert.Equal(t, reply{"result", nil}, <-replies)
+		assert.Equal(t, reply{"result", nil}, <-replies)
+	})
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yeldirium/hledger-language-server/internal/diagnostics"
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+// balancingAccountCandidateLimit is how many accounts are offered when a
+// transaction is balanced by adding a posting.
+const balancingAccountCandidateLimit = 5
+
+func registerCodeActionCapabilities(capabilities *protocol.ServerCapabilities) {
+	capabilities.CodeActionProvider = &protocol.CodeActionOptions{
+		CodeActionKinds: []protocol.CodeActionKind{
+			protocol.QuickFix,
+		},
+	}
+}
+
+func (server server) CodeAction(ctx context.Context, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("lsp.documentURI", string(params.TextDocument.URI)),
+		attribute.Int("lsp.rangeStartLineNumber", int(params.Range.Start.Line+1)),
+		attribute.Int("lsp.rangeEndLineNumber", int(params.Range.End.Line+1)),
+	)
+
+	filePath := getFilePathFromURI(params.TextDocument.URI)
+	span.SetAttributes(
+		attribute.String("lsp.documentFilePath", filePath),
+	)
+
+	content, err := server.readDocument(ctx, filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read document: %w", err)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	folder := server.workspace.folderFor(filePath)
+
+	journal, err := folder.parserCache.Parse(ctx, filePath)
+	if err != nil {
+		// There is nothing to offer for documents that do not parse.
+		return nil, nil
+	}
+
+	resolvedJournal, err := folder.resolveJournal(ctx, filePath)
+	if err != nil {
+		span.RecordError(fmt.Errorf("failed to resolve includes: %w", err))
+		resolvedJournal = journal
+	}
+
+	codeActions := server.balancingCodeActions(params, content, journal, resolvedJournal)
+	codeActions = append(codeActions, server.declareAccountCodeActions(ctx, params, filePath, resolvedJournal)...)
+
+	span.SetAttributes(
+		attribute.Int("lsp.codeAction.count", len(codeActions)),
+	)
+
+	return codeActions, nil
+}
+
+// balancingCodeActions offers to balance the transactions overlapping the
+// requested range.
+func (server server) balancingCodeActions(params *protocol.CodeActionParams, content string, journal, resolvedJournal *ledger.Journal) []protocol.CodeAction {
+	codeActions := make([]protocol.CodeAction, 0)
+	lines := strings.Split(content, "\n")
+	styles := ledger.CommodityStyles(resolvedJournal)
+	fromLine := int(params.Range.Start.Line + 1)
+	toLine := int(params.Range.End.Line + 1)
+
+	for _, transaction := range ledger.Transactions(journal) {
+		if transaction.EndLine() < fromLine || transaction.Header.Pos.Line > toLine {
+			continue
+		}
+
+		accounts := ledger.BalancingAccountCandidates(resolvedJournal, transaction, balancingAccountCandidateLimit)
+		fixes := ledger.BalancingFixes(content, transaction, styles, accounts)
+		if len(fixes) == 0 {
+			continue
+		}
+
+		headerLine := uint32(transaction.Header.Pos.Line - 1)
+		matchingDiagnostics := make([]protocol.Diagnostic, 0)
+		for _, diagnostic := range params.Context.Diagnostics {
+			if diagnostic.Range.Start.Line == headerLine && diagnosticHasCode(diagnostic, diagnostics.CodeUnbalancedTransaction) {
+				matchingDiagnostics = append(matchingDiagnostics, diagnostic)
+			}
+		}
+
+		for i, fix := range fixes {
+			textEdits := make([]protocol.TextEdit, len(fix.Edits))
+			for j, edit := range fix.Edits {
+				textEdits[j] = textEditFromColumnEdit(lines, edit)
+			}
+
+			codeActions = append(codeActions, protocol.CodeAction{
+				Title:       fix.Title,
+				Kind:        protocol.QuickFix,
+				Diagnostics: matchingDiagnostics,
+				IsPreferred: i == 0 && len(matchingDiagnostics) > 0,
+				Edit: &protocol.WorkspaceEdit{
+					Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+						params.TextDocument.URI: textEdits,
+					},
+				},
+			})
+		}
+	}
+
+	return codeActions
+}
+
+// declareAccountCodeActions offers to declare the undeclared accounts of the
+// postings in the requested range.
+func (server server) declareAccountCodeActions(ctx context.Context, params *protocol.CodeActionParams, filePath string, resolvedJournal *ledger.Journal) []protocol.CodeAction {
+	span := trace.SpanFromContext(ctx)
+	codeActions := make([]protocol.CodeAction, 0)
+	fromLine := int(params.Range.Start.Line + 1)
+	toLine := int(params.Range.End.Line + 1)
+
+	offered := make(map[string]bool)
+	for _, accountName := range ledger.UndeclaredAccountNames(resolvedJournal) {
+		if accountName.Pos.Filename != filePath || accountName.Pos.Line < fromLine || accountName.Pos.Line > toLine {
+			continue
+		}
+		if offered[accountName.String()] {
+			continue
+		}
+		offered[accountName.String()] = true
+
+		declaration := ledger.DeclareAccount(resolvedJournal, accountName.String(), filePath)
+		content, err := server.readDocument(ctx, declaration.FileName)
+		if err != nil {
+			span.RecordError(fmt.Errorf("failed to read document: %w", err))
+			continue
+		}
+
+		lines := strings.Split(content, "\n")
+		declaration = declaration.SkipIndentedLines(lines)
+
+		codeActions = append(codeActions, protocol.CodeAction{
+			Title: fmt.Sprintf("Declare account %s", accountName),
+			Kind:  protocol.QuickFix,
+			Edit: &protocol.WorkspaceEdit{
+				Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+					protocol.DocumentURI(getURIFromFilePath(declaration.FileName)): {
+						textEditFromAccountDeclaration(lines, declaration),
+					},
+				},
+			},
+		})
+	}
+
+	return codeActions
+}
+
+func textEditFromAccountDeclaration(lines []string, declaration ledger.AccountDeclaration) protocol.TextEdit {
+	if declaration.Line > len(lines) {
+		lastLine := uint32(len(lines) - 1)
+		end := protocol.Position{Line: lastLine, Character: utf16Length(lines[lastLine])}
+		return protocol.TextEdit{
+			Range:   protocol.Range{Start: end, End: end},
+			NewText: "\n" + declaration.Text,
+		}
+	}
+
+	start := protocol.Position{Line: uint32(declaration.Line - 1), Character: 0}
+	return protocol.TextEdit{
+		Range:   protocol.Range{Start: start, End: start},
+		NewText: declaration.Text + "\n",
+	}
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+func registerCodeLensCapabilities(capabilities *protocol.ServerCapabilities) {
+	capabilities.CodeLensProvider = &protocol.CodeLensOptions{
+		ResolveProvider: false,
+	}
+}
+
+// CodeLens shows the balance and posting count of the account above every
+// account directive.
+func (server server) CodeLens(ctx context.Context, params *protocol.CodeLensParams) ([]protocol.CodeLens, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("lsp.documentURI", string(params.TextDocument.URI)),
+	)
+
+	filePath := getFilePathFromURI(params.TextDocument.URI)
+	span.SetAttributes(
+		attribute.String("lsp.documentFilePath", filePath),
+	)
+
+	folder := server.workspace.folderFor(filePath)
+
+	journal, err := folder.parserCache.Parse(ctx, filePath)
+	if err != nil {
+		// Parse errors are reported as diagnostics already.
+		return nil, nil
+	}
+
+	resolvedJournal, err := folder.resolveJournal(ctx, filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve includes: %w", err)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	balances := ledger.AccountBalances(resolvedJournal)
+	styles := ledger.CommodityStyles(resolvedJournal)
+
+	codeLenses := make([]protocol.CodeLens, 0)
+	for _, entry := range journal.Entries {
+		directive, ok := entry.(*ledger.AccountDirective)
+		if !ok || directive.AccountName == nil {
+			continue
+		}
+
+		line := uint32(directive.AccountName.Pos.Line - 1)
+		codeLenses = append(codeLenses, protocol.CodeLens{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: line, Character: 0},
+				End:   protocol.Position{Line: line, Character: 0},
+			},
+			Command: &protocol.Command{
+				Title: accountBalanceTitle(balances[directive.AccountName.String()], styles),
+			},
+		})
+	}
+
+	span.SetAttributes(
+		attribute.Int("lsp.codeLens.count", len(codeLenses)),
+	)
+
+	return codeLenses, nil
+}
+
+func accountBalanceTitle(balance ledger.AccountBalance, styles map[string]ledger.AmountStyle) string {
+	amounts := []string{"0"}
+	if balance.Amount != nil && !balance.Amount.IsZero() {
+		amounts = balance.Amount.Format(styles, ledger.AmountStyle{CommoditySpaced: true})
+	}
+
+	postings := "postings"
+	if balance.PostingCount == 1 {
+		postings = "posting"
+	}
+
+	return fmt.Sprintf("Balance: %s | %d %s", strings.Join(amounts, ", "), balance.PostingCount, postings)
+}
@@ -37,16 +37,14 @@ func (server server) Completion(ctx context.Context, params *protocol.Completion
 		attribute.String("lsp.documentFilePath", filePath),
 	)
 
-	journal, err := server.parserCache.Parse(ctx, filePath)
-	if err != nil {
-		err = fmt.Errorf("failed to open/parse journal: %w", err)
-		span.RecordError(err)
-		return nil, err
+	completionSettings := server.settings.Get().Completion
+	if !completionSettings.Enabled {
+		return &protocol.CompletionList{Items: []protocol.CompletionItem{}}, nil
 	}
 
-	resolvedJournal, err := server.parserCache.ResolveIncludes(ctx, journal, filePath)
+	resolvedJournal, err := server.workspace.folderFor(filePath).resolveJournal(ctx, filePath)
 	if err != nil {
-		err = fmt.Errorf("failed to resolve includes: %w", err)
+		err = fmt.Errorf("failed to open/parse journal: %w", err)
 		span.RecordError(err)
 		return nil, err
 	}
@@ -65,10 +63,13 @@ func (server server) Completion(ctx context.Context, params *protocol.Completion
 		})
 	}
 	matchingAccountNames := ledger.FilterAccountNamesByPrefix(accountNames, accountNameUnderCursor)
+	if completionSettings.MaxItems > 0 && len(matchingAccountNames) > completionSettings.MaxItems {
+		matchingAccountNames = matchingAccountNames[:completionSettings.MaxItems]
+	}
 
 	result := protocol.CompletionList{
 		IsIncomplete: true,
-		Items:        make([]protocol.CompletionItem, len(accountNames)),
+		Items:        make([]protocol.CompletionItem, len(matchingAccountNames)),
 	}
 
 	replaceTextLine := params.Position.Line
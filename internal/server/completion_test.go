@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.lsp.dev/protocol"
+	"go.uber.org/zap"
+
+	"github.com/yeldirium/hledger-language-server/internal/journalgen"
+)
+
+func BenchmarkCompletion(b *testing.B) {
+	directory := b.TempDir()
+	journals := journalgen.Generate(journalgen.DefaultOptions)
+	for fileName, content := range journals {
+		if err := os.WriteFile(filepath.Join(directory, fileName), []byte(content), 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	server := server{
+		logger:      zap.NewNop(),
+		workspace:   newWorkspace(),
+		fileWatcher: newFileWatcher(),
+		settings:    newSettingsStore(),
+	}
+	server.workspace.AddFolder("bench", filepath.ToSlash(directory))
+
+	// Completion is requested in an open document included by the root
+	// journal, as it would be while editing.
+	filePath := filepath.ToSlash(filepath.Join(directory, journalgen.IncludedJournal(0)))
+	content := journals[journalgen.IncludedJournal(0)]
+	server.workspace.OpenDocument(filePath, content)
+
+	positions := []struct {
+		name     string
+		position protocol.Position
+	}{
+		// The second line is the first posting of the first transaction.
+		{name: "in an account name", position: protocol.Position{Line: 1, Character: 10}},
+		{name: "on an empty line", position: protocol.Position{
+			Line: uint32(strings.Count(content[:strings.Index(content, "\n\n")+1], "\n")),
+		}},
+	}
+	for _, position := range positions {
+		b.Run(position.name, func(b *testing.B) {
+			params := &protocol.CompletionParams{
+				TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+					TextDocument: protocol.TextDocumentIdentifier{URI: getURIFromFilePath(filePath)},
+					Position:     position.position,
+				},
+			}
+
+			// The journals are parsed once, like they are after opening the
+			// document.
+			completionList, err := server.Completion(context.Background(), params)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if len(completionList.Items) == 0 {
+				b.Fatal("expected completion items")
+			}
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := server.Completion(context.Background(), params); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
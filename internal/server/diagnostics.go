@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	participleLexer "github.com/alecthomas/participle/v2/lexer"
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yeldirium/hledger-language-server/internal/check"
+	"github.com/yeldirium/hledger-language-server/internal/diagnostics"
+	"github.com/yeldirium/hledger-language-server/internal/telemetry"
+)
+
+const diagnosticSource = "hledger-language-server"
+
+// diagnosticsDelay is how long a document has to stay unchanged before it is
+// checked, so that typing does not check the whole journal on every keystroke.
+const diagnosticsDelay = 200 * time.Millisecond
+
+// diagnosticsJobs are the pending checks of the open documents, at most one
+// per document.
+type diagnosticsJobs struct {
+	sync.Mutex
+	jobs map[string]*diagnosticsJob
+}
+
+type diagnosticsJob struct {
+	cancel context.CancelFunc
+}
+
+func newDiagnosticsJobs() *diagnosticsJobs {
+	return &diagnosticsJobs{
+		jobs: make(map[string]*diagnosticsJob),
+	}
+}
+
+// scheduleDiagnostics checks the document and publishes its diagnostics in
+// the background once it did not change for diagnosticsDelay. A job that is
+// still pending or running for the document is cancelled, since its
+// diagnostics would be outdated.
+func (server server) scheduleDiagnostics(ctx context.Context, documentURI protocol.DocumentURI, filePath string) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	job := &diagnosticsJob{cancel: cancel}
+
+	server.diagnosticsJobs.Lock()
+	if previousJob, ok := server.diagnosticsJobs.jobs[filePath]; ok {
+		previousJob.cancel()
+	}
+	server.diagnosticsJobs.jobs[filePath] = job
+	server.diagnosticsJobs.Unlock()
+
+	go func() {
+		defer func() {
+			server.diagnosticsJobs.Lock()
+			if server.diagnosticsJobs.jobs[filePath] == job {
+				delete(server.diagnosticsJobs.jobs, filePath)
+			}
+			server.diagnosticsJobs.Unlock()
+			cancel()
+		}()
+
+		timer := time.NewTimer(diagnosticsDelay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		tracer := telemetry.TracerFromContext(ctx)
+		ctx, span := tracer.Start(ctx, "server/publishDiagnostics")
+		defer span.End()
+		span.SetAttributes(
+			attribute.String("lsp.documentFilePath", filePath),
+		)
+
+		// Errors are recorded on the span already.
+		_ = server.publishDiagnostics(ctx, documentURI, filePath)
+	}()
+}
+
+// cancelDiagnostics cancels the pending check of the document, if any.
+func (server server) cancelDiagnostics(filePath string) {
+	server.diagnosticsJobs.Lock()
+	defer server.diagnosticsJobs.Unlock()
+
+	if job, ok := server.diagnosticsJobs.jobs[filePath]; ok {
+		job.cancel()
+		delete(server.diagnosticsJobs.jobs, filePath)
+	}
+}
+
+// publishDiagnostics checks the document and sends all problems found in it
+// to the client, replacing the ones sent before.
+func (server server) publishDiagnostics(ctx context.Context, documentURI protocol.DocumentURI, filePath string) error {
+	span := trace.SpanFromContext(ctx)
+
+	content, err := server.readDocument(ctx, filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read document: %w", err)
+		span.RecordError(err)
+		return err
+	}
+
+	settings := server.settings.Get()
+	foundDiagnostics := make([]diagnostics.Diagnostic, 0)
+	if settings.Diagnostics.Enabled {
+		folder := server.workspace.folderFor(filePath)
+		journalFilePath := folder.journalFilePath(ctx, filePath)
+		span.SetAttributes(
+			attribute.String("lsp.journalFilePath", journalFilePath),
+		)
+		foundDiagnostics = check.File(ctx, folder.parserCache, journalFilePath, filePath, check.Options{Strict: settings.Strict})
+		foundDiagnostics = slices.DeleteFunc(foundDiagnostics, func(diagnostic diagnostics.Diagnostic) bool {
+			return !settings.Diagnostics.reportsDiagnostic(diagnostic.Code)
+		})
+	}
+
+	span.SetAttributes(
+		attribute.Int("lsp.diagnostics.count", len(foundDiagnostics)),
+	)
+
+	// A later change of the document may have cancelled the checks, which
+	// then report outdated or no diagnostics.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lines := strings.Split(content, "\n")
+	protocolDiagnostics := make([]protocol.Diagnostic, len(foundDiagnostics))
+	for i, diagnostic := range foundDiagnostics {
+		protocolDiagnostics[i] = protocolDiagnosticFromDiagnostic(lines, diagnostic)
+	}
+
+	return server.client.PublishDiagnostics(ctx, &protocol.PublishDiagnosticsParams{
+		URI:         documentURI,
+		Diagnostics: protocolDiagnostics,
+	})
+}
+
+func protocolDiagnosticFromDiagnostic(lines []string, diagnostic diagnostics.Diagnostic) protocol.Diagnostic {
+	return protocol.Diagnostic{
+		Range: protocol.Range{
+			Start: protocolPositionFromPosition(lines, diagnostic.Pos),
+			End:   protocolPositionFromPosition(lines, diagnostic.EndPos),
+		},
+		Severity: protocol.DiagnosticSeverity(diagnostic.Severity),
+		Code:     diagnostic.Code,
+		Source:   diagnosticSource,
+		Message:  diagnostic.Message,
+	}
+}
+
+// protocolPositionFromPosition converts a parser position into an LSP
+// position. Positions after the last line are moved to the end of the
+// document.
+func protocolPositionFromPosition(lines []string, pos participleLexer.Position) protocol.Position {
+	if pos.Line > len(lines) {
+		lastLine := uint32(len(lines) - 1)
+		return protocol.Position{Line: lastLine, Character: utf16Length(lines[lastLine])}
+	}
+
+	return protocol.Position{
+		Line:      uint32(pos.Line - 1),
+		Character: utf16Column(lines[pos.Line-1], pos.Column),
+	}
+}
+
+// diagnosticHasCode reports whether a diagnostic sent by the client is one of
+// ours with the given code.
+func diagnosticHasCode(diagnostic protocol.Diagnostic, code string) bool {
+	diagnosticCode, ok := diagnostic.Code.(string)
+	return ok && diagnostic.Source == diagnosticSource && diagnosticCode == code
+}
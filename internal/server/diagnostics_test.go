@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+// publishingClient records the diagnostics published to it.
+type publishingClient struct {
+	protocol.Client
+	mutex     sync.Mutex
+	published []*protocol.PublishDiagnosticsParams
+}
+
+func (client *publishingClient) PublishDiagnostics(ctx context.Context, params *protocol.PublishDiagnosticsParams) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.published = append(client.published, params)
+	return nil
+}
+
+func (client *publishingClient) Published() []*protocol.PublishDiagnosticsParams {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return append([]*protocol.PublishDiagnosticsParams{}, client.published...)
+}
+
+func TestScheduleDiagnostics(t *testing.T) {
+	t.Run("checks a document once after a burst of changes, with its last content.", func(t *testing.T) {
+		client := &publishingClient{}
+		server := server{
+			client:          client,
+			logger:          zap.NewNop(),
+			workspace:       newWorkspace(),
+			fileWatcher:     newFileWatcher(),
+			diagnosticsJobs: newDiagnosticsJobs(),
+			settings:        newSettingsStore(),
+		}
+		documentURI := protocol.DocumentURI("file:///ledger/main.journal")
+
+		assert.NoError(t, server.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+			TextDocument: protocol.TextDocumentItem{URI: documentURI, Text: ""},
+		}))
+		contents := []string{
+			"2024-11-25 Payee\n",
+			"2024-11-25 Payee\n    expenses:Food  10 €\n",
+			"2024-11-25 Payee\n    expenses:Food  10 €\n    assets:Cash  -9 €\n",
+		}
+		for _, content := range contents {
+			assert.NoError(t, server.DidChange(context.Background(), &protocol.DidChangeTextDocumentParams{
+				TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: documentURI}},
+				ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: content}},
+			}))
+		}
+		assert.Equal(t, 0, len(client.Published()))
+
+		for deadline := time.Now().Add(5 * time.Second); len(client.Published()) == 0 && time.Now().Before(deadline); {
+			time.Sleep(diagnosticsDelay)
+		}
+		time.Sleep(2 * diagnosticsDelay)
+
+		published := client.Published()
+		assert.Equal(t, 1, len(published))
+		assert.Equal(t, 1, len(published[0].Diagnostics))
+		assert.Equal(t, "transaction is unbalanced by 1 €", published[0].Diagnostics[0].Message)
+	})
+
+	t.Run("does not check documents that were closed in the meantime.", func(t *testing.T) {
+		client := &publishingClient{}
+		server := server{
+			client:          client,
+			logger:          zap.NewNop(),
+			workspace:       newWorkspace(),
+			fileWatcher:     newFileWatcher(),
+			diagnosticsJobs: newDiagnosticsJobs(),
+			settings:        newSettingsStore(),
+		}
+		documentURI := protocol.DocumentURI("file:///ledger/main.journal")
+
+		assert.NoError(t, server.DidOpen(context.Background(), &protocol.DidOpenTextDocumentParams{
+			TextDocument: protocol.TextDocumentItem{URI: documentURI, Text: "account assets\n"},
+		}))
+		assert.NoError(t, server.DidClose(context.Background(), &protocol.DidCloseTextDocumentParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: documentURI},
+		}))
+		time.Sleep(3 * diagnosticsDelay)
+
+		assert.Equal(t, 0, len(client.Published()))
+	})
+}
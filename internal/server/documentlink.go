@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+func registerDocumentLinkCapabilities(capabilities *protocol.ServerCapabilities) {
+	capabilities.DocumentLinkProvider = &protocol.DocumentLinkOptions{
+		ResolveProvider: false,
+	}
+}
+
+// DocumentLink turns the paths of include directives into links to the files
+// they include. Glob patterns link to the first file they match, in sorted
+// order, and list all matches in the tooltip, since links can not share a
+// range.
+func (server server) DocumentLink(ctx context.Context, params *protocol.DocumentLinkParams) ([]protocol.DocumentLink, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("lsp.documentURI", string(params.TextDocument.URI)),
+	)
+
+	filePath := getFilePathFromURI(params.TextDocument.URI)
+	span.SetAttributes(
+		attribute.String("lsp.documentFilePath", filePath),
+	)
+
+	folder := server.workspace.folderFor(filePath)
+
+	journal, err := folder.parserCache.Parse(ctx, filePath)
+	if err != nil {
+		// Parse errors are reported as diagnostics already.
+		return nil, nil
+	}
+
+	content, err := server.readDocument(ctx, filePath)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	lines := strings.Split(content, "\n")
+
+	documentLinks := make([]protocol.DocumentLink, 0)
+	for _, entry := range journal.Entries {
+		directive, ok := entry.(*ledger.IncludeDirective)
+		if !ok || directive.Pos.Line > len(lines) {
+			continue
+		}
+
+		// Unresolved includes are reported as diagnostics.
+		includedFilePaths, err := folder.parserCache.ResolveIncludePath(ctx, filePath, directive.IncludePath)
+		if err != nil {
+			continue
+		}
+
+		if len(includedFilePaths) == 0 {
+			continue
+		}
+		includedFilePaths = slices.Sorted(slices.Values(includedFilePaths))
+
+		tooltip := includedFilePaths[0]
+		if len(includedFilePaths) > 1 {
+			tooltip = fmt.Sprintf("%s matches %d files:\n%s", directive.IncludePath, len(includedFilePaths), strings.Join(includedFilePaths, "\n"))
+		}
+		documentLinks = append(documentLinks, protocol.DocumentLink{
+			Range:   includePathRange(lines[directive.Pos.Line-1], directive),
+			Target:  protocol.DocumentURI(getURIFromFilePath(includedFilePaths[0])),
+			Tooltip: tooltip,
+		})
+	}
+
+	span.SetAttributes(
+		attribute.Int("lsp.documentLink.count", len(documentLinks)),
+	)
+
+	return documentLinks, nil
+}
+
+// includePathRange returns the range of the path on the line of an include
+// directive.
+func includePathRange(line string, directive *ledger.IncludeDirective) protocol.Range {
+	lineNumber := uint32(directive.Pos.Line - 1)
+	startColumn := directive.Pos.Column
+	keywordEnd := min(len("include"), len(line))
+	if offset := strings.Index(line[keywordEnd:], directive.IncludePath); offset >= 0 {
+		startColumn = utf8.RuneCountInString(line[:keywordEnd+offset]) + 1
+	}
+	endColumn := startColumn + utf8.RuneCountInString(directive.IncludePath)
+
+	return protocol.Range{
+		Start: protocol.Position{Line: lineNumber, Character: utf16Column(line, startColumn)},
+		End:   protocol.Position{Line: lineNumber, Character: utf16Column(line, endColumn)},
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+func TestDocumentLink(t *testing.T) {
+	t.Run("links glob includes to the first file they match.", func(t *testing.T) {
+		directory := t.TempDir()
+		assert.NoError(t, os.Mkdir(filepath.Join(directory, "2024"), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "2024", "b.journal"), []byte("account assets:B\n"), 0o644))
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "2024", "a.journal"), []byte("account assets:A\n"), 0o644))
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "main.journal"), []byte("include 2024/*.journal\n"), 0o644))
+
+		server := server{
+			logger:      zap.NewNop(),
+			workspace:   newWorkspace(),
+			fileWatcher: newFileWatcher(),
+			settings:    newSettingsStore(),
+		}
+		folderPath := filepath.ToSlash(directory)
+		server.workspace.AddFolder("ledger", folderPath)
+
+		documentLinks, err := server.DocumentLink(context.Background(), &protocol.DocumentLinkParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: getURIFromFilePath(folderPath + "/main.journal")},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, []protocol.DocumentLink{
+			{
+				Range: protocol.Range{
+					Start: protocol.Position{Line: 0, Character: 8},
+					End:   protocol.Position{Line: 0, Character: 22},
+				},
+				Target:  protocol.DocumentURI(getURIFromFilePath(folderPath + "/2024/a.journal")),
+				Tooltip: "2024/*.journal matches 2 files:\n" + folderPath + "/2024/a.journal\n" + folderPath + "/2024/b.journal",
+			},
+		}, documentLinks)
+	})
+}
@@ -23,8 +23,8 @@ func (server server) DidOpen(ctx context.Context, params *protocol.DidOpenTextDo
 		attribute.String("lsp.documentFilePath", filePath),
 	)
 
-	server.documentCache.SetFile(filePath, params.TextDocument.Text)
-	server.parserCache.Remove(filePath)
+	server.workspace.OpenDocument(filePath, params.TextDocument.Text)
+	server.scheduleDiagnostics(ctx, params.TextDocument.URI, filePath)
 
 	return nil
 }
@@ -41,13 +41,14 @@ func (server server) DidChange(ctx context.Context, params *protocol.DidChangeTe
 	)
 
 	if len(params.ContentChanges) == 1 {
-		server.documentCache.SetFile(filePath, params.ContentChanges[0].Text)
-		server.parserCache.Remove(filePath)
+		server.workspace.OpenDocument(filePath, params.ContentChanges[0].Text)
 	} else {
 		span.AddEvent("unexpected amount of content changes", trace.WithAttributes(
 			attribute.Int("lsp.didChange.contentChangeSize", len(params.ContentChanges)),
 		))
+		return nil
 	}
+	server.scheduleDiagnostics(ctx, params.TextDocument.URI, filePath)
 
 	return nil
 }
@@ -63,7 +64,8 @@ func (server server) DidClose(ctx context.Context, params *protocol.DidCloseText
 		attribute.String("lsp.documentFilePath", filePath),
 	)
 
-	server.documentCache.DeleteFile(filePath)
+	server.cancelDiagnostics(filePath)
+	server.workspace.CloseDocument(filePath)
 
 	return nil
 }
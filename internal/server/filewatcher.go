@@ -0,0 +1,295 @@
+package server
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// watchedFileExtensions are the extensions of all formats that hledger reads,
+// and watchedFilesPattern matches the files with them.
+const (
+	watchedFileExtensions = "journal,j,hledger,ledger,timeclock,timedot,csv,ssv,tsv,rules"
+	watchedFilesPattern   = "**/*.{" + watchedFileExtensions + "}"
+)
+
+// isWatchedFile reports whether the file has one of the watchedFileExtensions,
+// so that the fsnotify watcher reports the same files as clients do.
+func isWatchedFile(filePath string) bool {
+	extension := strings.TrimPrefix(path.Ext(filePath), ".")
+	return extension != "" && slices.Contains(strings.Split(watchedFileExtensions, ","), extension)
+}
+
+// fileSystemEventsDelay is how long the fsnotify watcher waits for further
+// events before handling them together, since saving a file or checking out a
+// branch causes many events in quick succession.
+const fileSystemEventsDelay = 100 * time.Millisecond
+
+// fileWatcher notices files in the workspace folders that change outside of
+// the editor. Clients that can watch files send workspace/didChangeWatchedFiles
+// notifications, for all others the server watches the folders itself.
+type fileWatcher struct {
+	sync.Mutex
+	// clientWatchesFiles is set if the client supports registering for
+	// workspace/didChangeWatchedFiles.
+	clientWatchesFiles bool
+	// watching is set from the initialized notification until shutdown, so
+	// that settings changes only start the fsnotify watcher in between.
+	watching bool
+	watcher  *fsnotify.Watcher
+}
+
+func newFileWatcher() *fileWatcher {
+	return &fileWatcher{}
+}
+
+// initializeFileWatcher remembers whether the client can watch files for the
+// server.
+func (server server) initializeFileWatcher(params *protocol.InitializeParams) {
+	server.fileWatcher.Lock()
+	defer server.fileWatcher.Unlock()
+
+	workspaceCapabilities := params.Capabilities.Workspace
+	server.fileWatcher.clientWatchesFiles = workspaceCapabilities != nil &&
+		workspaceCapabilities.DidChangeWatchedFiles != nil &&
+		workspaceCapabilities.DidChangeWatchedFiles.DynamicRegistration
+}
+
+// watchFiles starts watching the workspace folders, either by asking the client
+// to do it or by watching them with fsnotify, unless the fileWatcher.enabled
+// setting is off. Like other registrations, this must not block the message
+// handler.
+func (server server) watchFiles(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+
+	server.fileWatcher.Lock()
+	defer server.fileWatcher.Unlock()
+
+	server.fileWatcher.watching = true
+	if server.fileWatcher.clientWatchesFiles {
+		go func() {
+			err := server.client.RegisterCapability(ctx, &protocol.RegistrationParams{
+				Registrations: []protocol.Registration{
+					{
+						ID:     protocol.MethodWorkspaceDidChangeWatchedFiles,
+						Method: protocol.MethodWorkspaceDidChangeWatchedFiles,
+						RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{
+							Watchers: []protocol.FileSystemWatcher{
+								{GlobPattern: watchedFilesPattern},
+							},
+						},
+					},
+				},
+			})
+			if err != nil {
+				server.logger.Warn("failed to register for watched file changes", zap.Error(err))
+			}
+		}()
+		return
+	}
+
+	if server.settings.Get().FileWatcher.Enabled {
+		server.startFileSystemWatcher(ctx)
+	}
+}
+
+// setFileSystemWatcherEnabled starts or stops the fsnotify watcher after the
+// fileWatcher.enabled setting changed. Clients that watch files are not
+// affected.
+func (server server) setFileSystemWatcherEnabled(ctx context.Context, enabled bool) {
+	ctx = context.WithoutCancel(ctx)
+
+	server.fileWatcher.Lock()
+	defer server.fileWatcher.Unlock()
+
+	if !server.fileWatcher.watching || server.fileWatcher.clientWatchesFiles {
+		return
+	}
+	if enabled && server.fileWatcher.watcher == nil {
+		server.startFileSystemWatcher(ctx)
+	}
+	if !enabled && server.fileWatcher.watcher != nil {
+		_ = server.fileWatcher.watcher.Close()
+		server.fileWatcher.watcher = nil
+	}
+}
+
+// startFileSystemWatcher watches the workspace folders with fsnotify. The
+// caller must hold the lock of the file watcher.
+func (server server) startFileSystemWatcher(ctx context.Context) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		server.logger.Warn("failed to watch the workspace folders", zap.Error(err))
+		return
+	}
+	server.fileWatcher.watcher = watcher
+
+	for _, folder := range server.workspace.Folders() {
+		server.watchDirectory(folder.path)
+	}
+
+	go server.handleFileSystemEvents(ctx, watcher)
+}
+
+// watchDirectory adds the directory and all its subdirectories to the fsnotify
+// watcher, since fsnotify does not watch recursively. Hidden directories are
+// skipped. The caller must hold the lock of the file watcher.
+func (server server) watchDirectory(directory string) {
+	if server.fileWatcher.watcher == nil {
+		return
+	}
+
+	_ = filepath.WalkDir(filepath.FromSlash(directory), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if filePath != filepath.FromSlash(directory) && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if err := server.fileWatcher.watcher.Add(filePath); err != nil {
+			server.logger.Warn("failed to watch directory", zap.String("directory", filePath), zap.Error(err))
+		}
+		return nil
+	})
+}
+
+// unwatchDirectory removes the directory and all its watched subdirectories
+// from the fsnotify watcher. The caller must hold the lock of the file watcher.
+func (server server) unwatchDirectory(directory string) {
+	if server.fileWatcher.watcher == nil {
+		return
+	}
+
+	directory = filepath.FromSlash(directory)
+	for _, watchedPath := range server.fileWatcher.watcher.WatchList() {
+		if watchedPath == directory || strings.HasPrefix(watchedPath, directory+string(filepath.Separator)) {
+			_ = server.fileWatcher.watcher.Remove(watchedPath)
+		}
+	}
+}
+
+// handleFileSystemEvents handles the events of the fsnotify watcher once no
+// further events arrived for fileSystemEventsDelay, all at once.
+func (server server) handleFileSystemEvents(ctx context.Context, watcher *fsnotify.Watcher) {
+	events := fileEventBatch{}
+	timer := time.NewTimer(fileSystemEventsDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+
+			var changeType protocol.FileChangeType
+			switch {
+			case event.Has(fsnotify.Create):
+				changeType = protocol.FileChangeTypeCreated
+				server.fileWatcher.Lock()
+				server.watchDirectory(filepath.ToSlash(event.Name))
+				server.fileWatcher.Unlock()
+			case event.Has(fsnotify.Write):
+				changeType = protocol.FileChangeTypeChanged
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				changeType = protocol.FileChangeTypeDeleted
+			default:
+				continue
+			}
+			// Swap files of editors, version control and build output do not
+			// affect journals.
+			if !isWatchedFile(filepath.ToSlash(event.Name)) {
+				continue
+			}
+
+			events.add(&protocol.FileEvent{
+				Type: changeType,
+				URI:  getURIFromFilePath(filepath.ToSlash(event.Name)),
+			})
+			timer.Reset(fileSystemEventsDelay)
+		case <-timer.C:
+			server.filesChanged(ctx, events)
+			events = fileEventBatch{}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			server.logger.Warn("error while watching files", zap.Error(err))
+		}
+	}
+}
+
+// fileEventBatch collects the file events that are handled together, with at
+// most one event per file.
+type fileEventBatch []*protocol.FileEvent
+
+// add adds the event to the batch. If the batch has an event for the file
+// already, the later event replaces it, except that changing a file that was
+// created or deleted in the same batch keeps the earlier event.
+func (batch *fileEventBatch) add(event *protocol.FileEvent) {
+	for i, batchedEvent := range *batch {
+		if batchedEvent.URI != event.URI {
+			continue
+		}
+		if event.Type != protocol.FileChangeTypeChanged {
+			(*batch)[i] = event
+		}
+		return
+	}
+	*batch = append(*batch, event)
+}
+
+// stopWatchingFiles closes the fsnotify watcher, if there is one.
+func (server server) stopWatchingFiles() {
+	server.fileWatcher.Lock()
+	defer server.fileWatcher.Unlock()
+
+	server.fileWatcher.watching = false
+	if server.fileWatcher.watcher != nil {
+		_ = server.fileWatcher.watcher.Close()
+		server.fileWatcher.watcher = nil
+	}
+}
+
+func (server server) DidChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Int("lsp.didChangeWatchedFiles.changeCount", len(params.Changes)),
+	)
+
+	server.filesChanged(ctx, params.Changes)
+
+	return nil
+}
+
+// filesChanged invalidates the caches for files changed on disk and checks
+// the open documents of the affected workspace folders again, since they may
+// include the changed files.
+func (server server) filesChanged(ctx context.Context, changes []*protocol.FileEvent) {
+	affectedFolders := make(map[*workspaceFolder]bool)
+	for _, change := range changes {
+		filePath := getFilePathFromURI(protocol.DocumentURI(change.URI))
+		for _, folder := range server.workspace.FileChanged(filePath, change.Type) {
+			affectedFolders[folder] = true
+		}
+	}
+
+	for _, filePath := range server.workspace.OpenDocuments() {
+		if !affectedFolders[server.workspace.folderFor(filePath)] {
+			continue
+		}
+		server.scheduleDiagnostics(ctx, getURIFromFilePath(filePath), filePath)
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/assert/v2"
+	"go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+func TestFileSystemWatcher(t *testing.T) {
+	t.Run("ignores files that hledger does not read.", func(t *testing.T) {
+		directory := t.TempDir()
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "main.journal"), []byte("account assets\n"), 0o644))
+
+		server := server{
+			logger:      zap.NewNop(),
+			workspace:   newWorkspace(),
+			fileWatcher: newFileWatcher(),
+			settings:    newSettingsStore(),
+		}
+		folder := server.workspace.AddFolder("ledger", filepath.ToSlash(directory))
+		server.watchFiles(context.Background())
+		defer server.stopWatchingFiles()
+
+		generation := func() int {
+			folder.RLock()
+			defer folder.RUnlock()
+			return folder.journalFilePathsGeneration
+		}
+		initialGeneration := generation()
+
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, ".main.journal.swp"), []byte("swap"), 0o644))
+		time.Sleep(5 * fileSystemEventsDelay)
+		assert.Equal(t, initialGeneration, generation())
+
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "main.journal"), []byte("account expenses\n"), 0o644))
+		for deadline := time.Now().Add(5 * time.Second); generation() == initialGeneration && time.Now().Before(deadline); {
+			time.Sleep(fileSystemEventsDelay)
+		}
+		assert.NotEqual(t, initialGeneration, generation())
+	})
+}
+
+func TestFileEventBatch(t *testing.T) {
+	t.Run("keeps one event per file.", func(t *testing.T) {
+		batch := fileEventBatch{}
+		batch.add(&protocol.FileEvent{Type: protocol.FileChangeTypeChanged, URI: "file:///a.journal"})
+		batch.add(&protocol.FileEvent{Type: protocol.FileChangeTypeChanged, URI: "file:///b.journal"})
+		batch.add(&protocol.FileEvent{Type: protocol.FileChangeTypeChanged, URI: "file:///a.journal"})
+
+		assert.Equal(t, fileEventBatch{
+			{Type: protocol.FileChangeTypeChanged, URI: "file:///a.journal"},
+			{Type: protocol.FileChangeTypeChanged, URI: "file:///b.journal"},
+		}, batch)
+	})
+
+	t.Run("keeps creations and deletions over later changes.", func(t *testing.T) {
+		batch := fileEventBatch{}
+		batch.add(&protocol.FileEvent{Type: protocol.FileChangeTypeCreated, URI: "file:///a.journal"})
+		batch.add(&protocol.FileEvent{Type: protocol.FileChangeTypeChanged, URI: "file:///a.journal"})
+		batch.add(&protocol.FileEvent{Type: protocol.FileChangeTypeChanged, URI: "file:///b.journal"})
+		batch.add(&protocol.FileEvent{Type: protocol.FileChangeTypeDeleted, URI: "file:///b.journal"})
+
+		assert.Equal(t, fileEventBatch{
+			{Type: protocol.FileChangeTypeCreated, URI: "file:///a.journal"},
+			{Type: protocol.FileChangeTypeDeleted, URI: "file:///b.journal"},
+		}, batch)
+	})
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+func registerFormattingCapabilities(capabilities *protocol.ServerCapabilities) {
+	capabilities.DocumentFormattingProvider = true
+	capabilities.DocumentRangeFormattingProvider = true
+	capabilities.DocumentOnTypeFormattingProvider = &protocol.DocumentOnTypeFormattingOptions{
+		FirstTriggerCharacter: "\n",
+		MoreTriggerCharacter:  []string{"\t", " "},
+	}
+}
+
+func (server server) Formatting(ctx context.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("lsp.documentURI", string(params.TextDocument.URI)),
+	)
+
+	filePath := getFilePathFromURI(params.TextDocument.URI)
+	span.SetAttributes(
+		attribute.String("lsp.documentFilePath", filePath),
+	)
+
+	return server.formatLines(ctx, filePath, params.Options, 1, -1)
+}
+
+func (server server) RangeFormatting(ctx context.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("lsp.documentURI", string(params.TextDocument.URI)),
+		attribute.Int("lsp.rangeStartLineNumber", int(params.Range.Start.Line+1)),
+		attribute.Int("lsp.rangeEndLineNumber", int(params.Range.End.Line+1)),
+	)
+
+	filePath := getFilePathFromURI(params.TextDocument.URI)
+	span.SetAttributes(
+		attribute.String("lsp.documentFilePath", filePath),
+	)
+
+	return server.formatLines(ctx, filePath, params.Options, int(params.Range.Start.Line+1), int(params.Range.End.Line+1))
+}
+
+func (server server) OnTypeFormatting(ctx context.Context, params *protocol.DocumentOnTypeFormattingParams) ([]protocol.TextEdit, error) {
+	span := trace.SpanFromContext(ctx)
+
+	lineNumber := int(params.Position.Line + 1)
+
+	span.SetAttributes(
+		attribute.String("lsp.documentURI", string(params.TextDocument.URI)),
+		attribute.Int("lsp.cursorLineNumber", lineNumber),
+		attribute.String("lsp.onTypeFormatting.character", params.Ch),
+	)
+
+	filePath := getFilePathFromURI(params.TextDocument.URI)
+	span.SetAttributes(
+		attribute.String("lsp.documentFilePath", filePath),
+	)
+
+	content, err := server.readDocument(ctx, filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read document: %w", err)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	lines := strings.Split(content, "\n")
+	if lineNumber > len(lines) {
+		return nil, nil
+	}
+	columnNumber := runeColumn(lines[lineNumber-1], params.Position.Character)
+	formatOptions := formatOptionsFromClient(params.Options, server.settings.Get().Formatting)
+
+	var edit ledger.ColumnEdit
+	var ok bool
+	switch params.Ch {
+	case "\n":
+		edit, ok = ledger.NewLineIndentEdit(content, formatOptions, lineNumber)
+	case "\t", " ":
+		edit, ok = ledger.AmountColumnEdit(content, formatOptions, lineNumber, columnNumber)
+	}
+
+	span.SetAttributes(
+		attribute.Bool("lsp.onTypeFormatting.edited", ok),
+	)
+	if !ok {
+		return nil, nil
+	}
+
+	return []protocol.TextEdit{textEditFromColumnEdit(lines, edit)}, nil
+}
+
+// formatLines formats the transactions overlapping the given 1-based lines. A
+// negative toLine formats until the end of the document.
+func (server server) formatLines(ctx context.Context, filePath string, options protocol.FormattingOptions, fromLine, toLine int) ([]protocol.TextEdit, error) {
+	span := trace.SpanFromContext(ctx)
+
+	content, err := server.readDocument(ctx, filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read document: %w", err)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	lines := strings.Split(content, "\n")
+	if toLine < 0 {
+		toLine = len(lines)
+	}
+
+	lineEdits := ledger.FormatJournalLines(content, formatOptionsFromClient(options, server.settings.Get().Formatting), fromLine, toLine)
+	span.SetAttributes(
+		attribute.Int("lsp.formatting.editCount", len(lineEdits)),
+	)
+
+	return textEditsFromLineEdits(lines, lineEdits), nil
+}
+
+// formatOptionsFromClient takes the indentation from the editor and the
+// alignment of amounts from the settings.
+func formatOptionsFromClient(options protocol.FormattingOptions, settings formattingSettings) ledger.FormatOptions {
+	formatOptions := ledger.DefaultFormatOptions()
+	if !options.InsertSpaces {
+		formatOptions.PostingIndent = "\t"
+	} else if options.TabSize > 0 {
+		formatOptions.PostingIndent = strings.Repeat(" ", int(options.TabSize))
+	}
+	formatOptions.AmountColumn = settings.AmountColumn
+	formatOptions.AlignAcrossFile = settings.AlignAcrossFile
+
+	return formatOptions
+}
+
+func textEditsFromLineEdits(lines []string, lineEdits []ledger.LineEdit) []protocol.TextEdit {
+	textEdits := make([]protocol.TextEdit, len(lineEdits))
+	for i, lineEdit := range lineEdits {
+		line := uint32(lineEdit.Line - 1)
+		textEdits[i] = protocol.TextEdit{
+			Range: protocol.Range{
+				Start: protocol.Position{Line: line, Character: 0},
+				End:   protocol.Position{Line: line, Character: utf16Length(lines[line])},
+			},
+			NewText: lineEdit.NewText,
+		}
+	}
+
+	return textEdits
+}
+
+func textEditFromColumnEdit(lines []string, columnEdit ledger.ColumnEdit) protocol.TextEdit {
+	line := lines[columnEdit.Line-1]
+	lineNumber := uint32(columnEdit.Line - 1)
+
+	return protocol.TextEdit{
+		Range: protocol.Range{
+			Start: protocol.Position{Line: lineNumber, Character: utf16Column(line, columnEdit.StartColumn)},
+			End:   protocol.Position{Line: lineNumber, Character: utf16Column(line, columnEdit.EndColumn)},
+		},
+		NewText: columnEdit.NewText,
+	}
+}
@@ -29,20 +29,13 @@ func (server server) Hover(ctx context.Context, params *protocol.HoverParams) (*
 
 	filePath := getFilePathFromURI(params.TextDocument.URI)
 
-	journal, err := server.parserCache.Parse(ctx, filePath)
+	resolvedJournal, err := server.workspace.folderFor(filePath).resolveJournal(ctx, filePath)
 	if err != nil {
 		err = fmt.Errorf("failed to open/parse journal: %w", err)
 		span.RecordError(err)
 		return nil, err
 	}
 
-	resolvedJournal, err := server.parserCache.ResolveIncludes(ctx, journal, filePath)
-	if err != nil {
-		err = fmt.Errorf("failed to resolve includes: %w", err)
-		span.RecordError(err)
-		return nil, err
-	}
-
 	accountNameUnderCursor := ledger.FindAccountNameUnderCursor(resolvedJournal, filePath, lineNumber, columnNumber)
 
 	if accountNameUnderCursor == nil {
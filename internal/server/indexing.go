@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/yeldirium/hledger-language-server/internal/telemetry"
+)
+
+// indexer parses the journals of the workspace folders ahead of the first
+// request for them, and reports its progress to the client.
+type indexer struct {
+	sync.Mutex
+	// clientShowsProgress is set if the client supports progress reported
+	// with a token that the server created.
+	clientShowsProgress bool
+	// runCount numbers the progress tokens, since each one must be unique.
+	runCount int
+}
+
+func newIndexer() *indexer {
+	return &indexer{}
+}
+
+// initializeIndexer remembers whether the client can show the progress of
+// indexing.
+func (server server) initializeIndexer(params *protocol.InitializeParams) {
+	server.indexer.Lock()
+	defer server.indexer.Unlock()
+
+	windowCapabilities := params.Capabilities.Window
+	server.indexer.clientShowsProgress = windowCapabilities != nil && windowCapabilities.WorkDoneProgress
+}
+
+// indexWorkspace builds the include graph of the journals in the given
+// folders in the background, which parses all of them. Runs are queued, so
+// that at most one of them reports progress at a time.
+func (server server) indexWorkspace(ctx context.Context, folders []*workspaceFolder) {
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		server.indexer.Lock()
+		defer server.indexer.Unlock()
+
+		tracer := telemetry.TracerFromContext(ctx)
+		ctx, span := tracer.Start(ctx, "server/indexWorkspace")
+		defer span.End()
+
+		server.indexer.runCount += 1
+		progress := server.beginProgress(ctx, fmt.Sprintf("hledger-language-server/indexing/%d", server.indexer.runCount), "Indexing journals")
+
+		parsedTotal, discoveredTotal := 0, 0
+		for _, folder := range folders {
+			rootFilePaths := folder.Journals(ctx)
+			if rootJournal := folder.RootJournal(); rootJournal != "" && !slices.Contains(rootFilePaths, rootJournal) {
+				rootFilePaths = append([]string{rootJournal}, rootFilePaths...)
+			}
+			if len(rootFilePaths) == 0 {
+				continue
+			}
+
+			parsedCount, discoveredCount := 0, 0
+			folder.parserCache.BuildIncludeGraphWithProgress(ctx, func(parsed int, discovered int) {
+				parsedCount, discoveredCount = parsed, discovered
+				progress.report(ctx, parsedTotal+parsedCount, discoveredTotal+discoveredCount)
+			}, rootFilePaths...)
+			parsedTotal += parsedCount
+			discoveredTotal += discoveredCount
+		}
+
+		span.SetAttributes(
+			attribute.Int("lsp.indexing.folderCount", len(folders)),
+			attribute.Int("lsp.indexing.fileCount", parsedTotal),
+		)
+		progress.end(ctx, fmt.Sprintf("%d files", parsedTotal))
+	}()
+}
+
+// workDoneProgress reports the progress of a long running operation with
+// $/progress notifications. It reports nothing if the client can not show it.
+type workDoneProgress struct {
+	client protocol.Client
+	logger *zap.Logger
+	// token is nil if the client can not show the progress.
+	token      *protocol.ProgressToken
+	percentage uint32
+}
+
+// beginProgress creates a progress token and shows the title in the client.
+// The caller must hold the lock of the indexer.
+func (server server) beginProgress(ctx context.Context, token string, title string) *workDoneProgress {
+	progress := &workDoneProgress{
+		client: server.client,
+		logger: server.logger,
+	}
+	if !server.indexer.clientShowsProgress {
+		return progress
+	}
+
+	progressToken := protocol.NewProgressToken(token)
+	if err := server.client.WorkDoneProgressCreate(ctx, &protocol.WorkDoneProgressCreateParams{Token: *progressToken}); err != nil {
+		server.logger.Warn("failed to create a progress token", zap.Error(err))
+		return progress
+	}
+	progress.token = progressToken
+
+	progress.notify(ctx, &protocol.WorkDoneProgressBegin{
+		Kind:  protocol.WorkDoneProgressKindBegin,
+		Title: title,
+	})
+	return progress
+}
+
+// report shows how much of the work is done. To keep the number of
+// notifications low, it only reports changes of the percentage.
+func (progress *workDoneProgress) report(ctx context.Context, done int, total int) {
+	if progress.token == nil || total == 0 {
+		return
+	}
+
+	percentage := uint32(done * 100 / total)
+	if percentage == progress.percentage {
+		return
+	}
+	progress.percentage = percentage
+
+	progress.notify(ctx, &protocol.WorkDoneProgressReport{
+		Kind:       protocol.WorkDoneProgressKindReport,
+		Message:    fmt.Sprintf("%d/%d files", done, total),
+		Percentage: percentage,
+	})
+}
+
+func (progress *workDoneProgress) end(ctx context.Context, message string) {
+	if progress.token == nil {
+		return
+	}
+
+	progress.notify(ctx, &protocol.WorkDoneProgressEnd{
+		Kind:    protocol.WorkDoneProgressKindEnd,
+		Message: message,
+	})
+}
+
+func (progress *workDoneProgress) notify(ctx context.Context, value interface{}) {
+	err := progress.client.Progress(ctx, &protocol.ProgressParams{
+		Token: *progress.token,
+		Value: value,
+	})
+	if err != nil {
+		progress.logger.Warn("failed to report progress", zap.Error(err))
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+)
+
+// Inlay hints were added in LSP 3.17, which the protocol package does not
+// support yet. Requests for them reach the server through Request, and the
+// capability is registered dynamically once the client is initialized.
+const methodInlayHint = "textDocument/inlayHint"
+
+type inlayHintParams struct {
+	TextDocument protocol.TextDocumentIdentifier `json:"textDocument"`
+	Range        protocol.Range                  `json:"range"`
+}
+
+type inlayHint struct {
+	Position     protocol.Position `json:"position"`
+	Label        string            `json:"label"`
+	PaddingLeft  bool              `json:"paddingLeft,omitempty"`
+	PaddingRight bool              `json:"paddingRight,omitempty"`
+}
+
+type inlayHintRegistrationOptions struct {
+	DocumentSelector protocol.DocumentSelector `json:"documentSelector"`
+}
+
+// registerInlayHintCapabilities asks the client to send inlay hint requests.
+// The client only answers after it received the response to the current
+// message, so this must not block the message handler.
+func (server server) registerInlayHintCapabilities(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		err := server.client.RegisterCapability(ctx, &protocol.RegistrationParams{
+			Registrations: []protocol.Registration{
+				{
+					ID:     methodInlayHint,
+					Method: methodInlayHint,
+					RegisterOptions: inlayHintRegistrationOptions{
+						DocumentSelector: protocol.DocumentSelector{
+							{Language: "ledger"},
+							{Language: "hledger"},
+							{Pattern: "**/*.journal"},
+						},
+					},
+				},
+			},
+		})
+		if err != nil {
+			server.logger.Warn("failed to register inlay hints", zap.Error(err))
+		}
+	}()
+}
+
+func decodeInlayHintParams(params interface{}) (*inlayHintParams, error) {
+	rawParams, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	var decodedParams inlayHintParams
+	if err := json.Unmarshal(rawParams, &decodedParams); err != nil {
+		return nil, err
+	}
+
+	return &decodedParams, nil
+}
+
+// InlayHint shows the amounts hledger infers for amountless postings and the
+// running balance after postings with balance assertions.
+func (server server) InlayHint(ctx context.Context, params *inlayHintParams) ([]inlayHint, error) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("lsp.documentURI", string(params.TextDocument.URI)),
+		attribute.Int("lsp.rangeStartLineNumber", int(params.Range.Start.Line+1)),
+		attribute.Int("lsp.rangeEndLineNumber", int(params.Range.End.Line+1)),
+	)
+
+	filePath := getFilePathFromURI(params.TextDocument.URI)
+	span.SetAttributes(
+		attribute.String("lsp.documentFilePath", filePath),
+	)
+
+	content, err := server.readDocument(ctx, filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to read document: %w", err)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	folder := server.workspace.folderFor(filePath)
+
+	if _, err := folder.parserCache.Parse(ctx, filePath); err != nil {
+		// Parse errors are reported as diagnostics already.
+		return []inlayHint{}, nil
+	}
+
+	resolvedJournal, err := folder.resolveJournal(ctx, filePath)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve includes: %w", err)
+		span.RecordError(err)
+		return nil, err
+	}
+
+	styles := ledger.CommodityStyles(resolvedJournal)
+	hints := ledger.InferredAmountHints(resolvedJournal, filePath, styles)
+	if server.settings.Get().InlayHints.RunningBalances {
+		hints = append(hints, ledger.RunningBalanceHints(resolvedJournal, filePath, content, styles)...)
+	}
+
+	lines := strings.Split(content, "\n")
+	fromLine := int(params.Range.Start.Line + 1)
+	toLine := int(params.Range.End.Line + 1)
+
+	inlayHints := make([]inlayHint, 0, len(hints))
+	for _, hint := range hints {
+		if hint.Line < fromLine || hint.Line > toLine || hint.Line > len(lines) {
+			continue
+		}
+		inlayHints = append(inlayHints, inlayHint{
+			Position: protocol.Position{
+				Line:      uint32(hint.Line - 1),
+				Character: utf16Column(lines[hint.Line-1], hint.Column),
+			},
+			Label:       hint.Label,
+			PaddingLeft: true,
+		})
+	}
+
+	span.SetAttributes(
+		attribute.Int("lsp.inlayHint.count", len(inlayHints)),
+	)
+
+	return inlayHints, nil
+}
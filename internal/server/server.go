@@ -3,23 +3,29 @@ package server
 import (
 	"context"
 	"encoding/json"
-	"os"
 
 	"go.lsp.dev/protocol"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
-	"github.com/yeldirium/hledger-language-server/internal/documentcache"
 	"github.com/yeldirium/hledger-language-server/internal/parsercache"
+	"github.com/yeldirium/hledger-language-server/internal/telemetry"
+	"github.com/yeldirium/hledger-language-server/internal/version"
 )
 
 type server struct {
 	protocol.Server
 	client        protocol.Client
 	logger        *zap.Logger
-	documentCache *documentcache.DocumentCache
-	parserCache   *parsercache.ParserCache
+	workspace     *workspace
+	fileWatcher   *fileWatcher
+	indexer       *indexer
+	diagnosticsJobs *diagnosticsJobs
+	settings      *settingsStore
+	// telemetry sends spans to the configured endpoint. It is nil if
+	// telemetry could not be set up.
+	telemetry     *telemetry.Telemetry
 	clientInformation clientInformation
 }
 
@@ -41,9 +47,14 @@ func (c clientInformation) AddToSpan(span trace.Span) {
 
 func collectServerCapabilities() protocol.ServerCapabilities {
 	capabilities := protocol.ServerCapabilities{}
+	registerCodeActionCapabilities(&capabilities)
+	registerCodeLensCapabilities(&capabilities)
 	registerCompletionCapabilities(&capabilities)
+	registerDocumentLinkCapabilities(&capabilities)
 	registerDocumentSyncCapabilities(&capabilities)
+	registerFormattingCapabilities(&capabilities)
 	registerHoverCapabilities(&capabilities)
+	registerWorkspaceCapabilities(&capabilities)
 	return capabilities
 }
 
@@ -58,6 +69,11 @@ func (server server) Initialize(ctx context.Context, params *protocol.Initialize
 	}
 	server.clientInformation.AddToSpan(span)
 
+	server.initializeWorkspace(params)
+	server.initializeSettings(ctx, params)
+	server.initializeFileWatcher(params)
+	server.initializeIndexer(params)
+
 	clientCapabilitiesJson, err := json.Marshal(params.Capabilities)
 	if err != nil {
 		span.SetAttributes(
@@ -77,7 +93,7 @@ func (server server) Initialize(ctx context.Context, params *protocol.Initialize
 		Capabilities: capabilities,
 		ServerInfo: &protocol.ServerInfo{
 			Name:    "hledger-language-server",
-			Version: "0.0.1",
+			Version: version.Version(),
 		},
 	}, nil
 }
@@ -86,6 +102,16 @@ func (server server) Initialized(ctx context.Context, params *protocol.Initializ
 	span := trace.SpanFromContext(ctx)
 	server.clientInformation.AddToSpan(span)
 
+	server.registerInlayHintCapabilities(ctx)
+	server.registerSettingsChanges(ctx)
+	server.watchFiles(ctx)
+	if server.settings.clientPulls() {
+		// Indexes the workspace once the settings arrived.
+		server.refreshSettings(ctx)
+	} else {
+		server.indexWorkspace(ctx, server.workspace.Folders())
+	}
+
 	return nil
 }
 
@@ -93,33 +119,53 @@ func (server server) Shutdown(ctx context.Context) error {
 	span := trace.SpanFromContext(ctx)
 	server.clientInformation.AddToSpan(span)
 
+	server.stopWatchingFiles()
+
 	return nil
 }
 
-// Request catches all requests that are not handled otherwise. The main purpose
-// for this is to catche $/cancelRequest requests, which we do not handle yet.
-// TODO: handle cancelRequests so that each handler can opt-in to cancellation
+// Request catches all requests that the protocol package does not know about.
+// $/cancelRequest notifications never arrive here, they are handled by the
+// CancellationHandler.
 func (server server) Request(ctx context.Context, method string, params interface{}) (result interface{}, err error) {
 	span := trace.SpanFromContext(ctx)
 	server.clientInformation.AddToSpan(span)
 
+	switch method {
+	case methodInlayHint:
+		inlayHintParams, err := decodeInlayHintParams(params)
+		if err != nil {
+			return nil, err
+		}
+		return server.InlayHint(ctx, inlayHintParams)
+	}
+
 	return struct{}{}, nil
 }
 
-func NewServer(ctx context.Context, protocolServer protocol.Server, protocolClient protocol.Client, logger *zap.Logger) (server, context.Context, error) {
+// ShareCache makes the server share the ASTs of journals that are not open in
+// the editor with the other servers using the same shared cache, like the ones
+// for other clients connected to the same process.
+func (server server) ShareCache(sharedCache *parsercache.SharedCache) {
+	server.workspace.SetSharedCache(sharedCache)
+}
+
+func NewServer(ctx context.Context, protocolServer protocol.Server, protocolClient protocol.Client, logger *zap.Logger, telemetry *telemetry.Telemetry) (server, context.Context, error) {
 	// Do initialization logic here, including
 	// stuff like setting state variables
 	// by returning a new context with
 	// context.WithValue(context, ...)
 	// instead of just context
-	documentCache := documentcache.NewCache(os.DirFS("/"))
 	return server{
 		Server: protocolServer,
 		client: protocolClient,
 		logger: logger,
-		// TODO: set cache workspace based on project workspace reported from client
-		documentCache: documentCache,
-		parserCache:   parsercache.NewCache(documentCache),
+		workspace: newWorkspace(),
+		fileWatcher: newFileWatcher(),
+		indexer: newIndexer(),
+		diagnosticsJobs: newDiagnosticsJobs(),
+		settings: newSettingsStore(),
+		telemetry: telemetry,
 		clientInformation: clientInformation{},
 	}, ctx, nil
 }
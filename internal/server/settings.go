@@ -0,0 +1,344 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// settingsSection is the section of the client configuration that holds the
+// settings of the language server.
+const settingsSection = "hledger"
+
+// settings are passed by the client as initialization options, and again
+// after the user changed them, either in response to workspace/configuration
+// requests or in workspace/didChangeConfiguration notifications. Settings that
+// the client leaves out keep their default.
+type settings struct {
+	// RootJournal is the journal that all other journals are included from,
+	// either absolute or relative to each workspace folder.
+	RootJournal string `json:"rootJournal"`
+	// Strict reports postings to accounts that are not declared, like
+	// `hledger check --strict`.
+	Strict bool `json:"strict"`
+	// CacheMaxFiles and CacheMaxBytes bound the documents and ASTs cached
+	// for files that are not open, per workspace folder. Zero means no limit.
+	CacheMaxFiles *int `json:"cacheMaxFiles"`
+	CacheMaxBytes *int `json:"cacheMaxBytes"`
+	// PersistentCache keeps the parsed journals on disk, so that they do not
+	// have to be parsed again after a restart. PersistentCacheDirectory
+	// overrides where, which defaults to the user cache directory.
+	PersistentCache          bool   `json:"persistentCache"`
+	PersistentCacheDirectory string `json:"persistentCacheDirectory"`
+
+	Formatting  formattingSettings  `json:"formatting"`
+	Completion  completionSettings  `json:"completion"`
+	Diagnostics diagnosticsSettings `json:"diagnostics"`
+	InlayHints  inlayHintSettings   `json:"inlayHints"`
+	FileWatcher fileWatcherSettings `json:"fileWatcher"`
+	Telemetry   telemetrySettings   `json:"telemetry"`
+}
+
+type formattingSettings struct {
+	// AmountColumn is the 1-based column that amounts are aligned in at the
+	// earliest. Zero aligns them right after the longest account name.
+	AmountColumn int `json:"amountColumn"`
+	// AlignAcrossFile aligns the amounts of all transactions in a file on the
+	// same column.
+	AlignAcrossFile bool `json:"alignAcrossFile"`
+}
+
+type completionSettings struct {
+	Enabled bool `json:"enabled"`
+	// MaxItems limits the number of completion items. Zero means no limit.
+	MaxItems int `json:"maxItems"`
+}
+
+type diagnosticsSettings struct {
+	Enabled bool `json:"enabled"`
+	// Disabled are the codes of the diagnostics that are not reported.
+	Disabled []string `json:"disabled"`
+}
+
+type inlayHintSettings struct {
+	// RunningBalances shows the running balance after postings with balance
+	// assertions.
+	RunningBalances bool `json:"runningBalances"`
+}
+
+type fileWatcherSettings struct {
+	// Enabled lets the server watch the workspace folders itself if the client
+	// can not watch files for it.
+	Enabled bool `json:"enabled"`
+}
+
+type telemetrySettings struct {
+	// Endpoint is the OTLP collector that spans are sent to.
+	Endpoint string `json:"endpoint"`
+}
+
+func defaultSettings() settings {
+	return settings{
+		Completion:  completionSettings{Enabled: true},
+		Diagnostics: diagnosticsSettings{Enabled: true},
+		InlayHints:  inlayHintSettings{RunningBalances: true},
+		FileWatcher: fileWatcherSettings{Enabled: true},
+	}
+}
+
+// reportsDiagnostic reports whether diagnostics with the given code are
+// enabled.
+func (settings diagnosticsSettings) reportsDiagnostic(code string) bool {
+	return settings.Enabled && !slices.Contains(settings.Disabled, code)
+}
+
+// decodeSettings decodes layers of settings sent by the client as arbitrary
+// JSON over the default settings, each one overriding the settings of the
+// ones before. Settings nested in the section of the language server, as most
+// clients send them in workspace/didChangeConfiguration, are unwrapped.
+func decodeSettings(rawSettingsLayers ...interface{}) (settings, error) {
+	decodedSettings := defaultSettings()
+
+	for _, rawSettings := range rawSettingsLayers {
+		if rawSettings == nil {
+			continue
+		}
+
+		settingsJson, err := json.Marshal(rawSettings)
+		if err != nil {
+			return decodedSettings, err
+		}
+
+		var sections map[string]json.RawMessage
+		if json.Unmarshal(settingsJson, &sections) == nil {
+			if section, ok := sections[settingsSection]; ok {
+				settingsJson = section
+			}
+		}
+
+		if err := json.Unmarshal(settingsJson, &decodedSettings); err != nil {
+			return decodedSettings, err
+		}
+	}
+
+	return decodedSettings, nil
+}
+
+// settingsStore holds the current settings, which feature handlers read
+// while they may be refreshed.
+type settingsStore struct {
+	sync.RWMutex
+	settings settings
+	// initializationOptions are the settings passed on initialization, which
+	// settings sent later only override.
+	initializationOptions interface{}
+	// clientPullsSettings is set if the client answers
+	// workspace/configuration requests.
+	clientPullsSettings bool
+	// clientRegistersSettingsChanges is set if the client sends
+	// workspace/didChangeConfiguration notifications only after the server
+	// registered for them.
+	clientRegistersSettingsChanges bool
+	// refreshing serializes refreshes, so that they are applied in the order
+	// they were requested.
+	refreshing sync.Mutex
+}
+
+func newSettingsStore() *settingsStore {
+	return &settingsStore{
+		settings: defaultSettings(),
+	}
+}
+
+func (store *settingsStore) Get() settings {
+	store.RLock()
+	defer store.RUnlock()
+
+	return store.settings
+}
+
+func (store *settingsStore) Set(settings settings) {
+	store.Lock()
+	defer store.Unlock()
+
+	store.settings = settings
+}
+
+func (store *settingsStore) clientPulls() bool {
+	store.RLock()
+	defer store.RUnlock()
+
+	return store.clientPullsSettings
+}
+
+// decodeChangedSettings decodes settings sent after initialization over the
+// initialization options.
+func (store *settingsStore) decodeChangedSettings(rawSettings interface{}) (settings, error) {
+	store.RLock()
+	defer store.RUnlock()
+
+	return decodeSettings(store.initializationOptions, rawSettings)
+}
+
+// initializeSettings applies the initialization options and remembers how the
+// client reports changed settings.
+func (server server) initializeSettings(ctx context.Context, params *protocol.InitializeParams) {
+	span := trace.SpanFromContext(ctx)
+
+	server.settings.Lock()
+	workspaceCapabilities := params.Capabilities.Workspace
+	server.settings.clientPullsSettings = workspaceCapabilities != nil && workspaceCapabilities.Configuration
+	server.settings.clientRegistersSettingsChanges = workspaceCapabilities != nil &&
+		workspaceCapabilities.DidChangeConfiguration != nil &&
+		workspaceCapabilities.DidChangeConfiguration.DynamicRegistration
+	server.settings.initializationOptions = params.InitializationOptions
+	server.settings.Unlock()
+
+	settings, err := decodeSettings(params.InitializationOptions)
+	if err != nil {
+		span.RecordError(fmt.Errorf("invalid initialization options: %w", err))
+	}
+
+	server.applySettings(ctx, settings)
+}
+
+// registerSettingsChanges asks the client to notify the server about changed
+// settings. Like other registrations, this must not block the message
+// handler.
+func (server server) registerSettingsChanges(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+
+	server.settings.RLock()
+	defer server.settings.RUnlock()
+
+	if !server.settings.clientRegistersSettingsChanges {
+		return
+	}
+
+	go func() {
+		err := server.client.RegisterCapability(ctx, &protocol.RegistrationParams{
+			Registrations: []protocol.Registration{
+				{
+					ID:     protocol.MethodWorkspaceDidChangeConfiguration,
+					Method: protocol.MethodWorkspaceDidChangeConfiguration,
+				},
+			},
+		})
+		if err != nil {
+			server.logger.Warn("failed to register for configuration changes", zap.Error(err))
+		}
+	}()
+}
+
+// applySettings stores the settings and configures the root journals, the
+// caches of all workspace folders and the telemetry endpoint.
+func (server server) applySettings(ctx context.Context, settings settings) {
+	span := trace.SpanFromContext(ctx)
+
+	server.settings.Set(settings)
+
+	server.workspace.SetRootJournals(settings.RootJournal, ledgerFileFromEnvironment())
+
+	cacheLimits := defaultCacheLimits
+	if settings.CacheMaxFiles != nil {
+		cacheLimits.MaxEntries = *settings.CacheMaxFiles
+	}
+	if settings.CacheMaxBytes != nil {
+		cacheLimits.MaxBytes = *settings.CacheMaxBytes
+	}
+	server.workspace.SetCacheLimits(cacheLimits)
+
+	if settings.PersistentCache {
+		server.enableDiskCache(ctx, settings.PersistentCacheDirectory)
+	} else {
+		server.workspace.SetDiskCache(nil)
+	}
+
+	server.setFileSystemWatcherEnabled(ctx, settings.FileWatcher.Enabled)
+
+	if server.telemetry != nil {
+		if err := server.telemetry.SetEndpoint(ctx, settings.Telemetry.Endpoint); err != nil {
+			span.RecordError(fmt.Errorf("failed to change the telemetry endpoint: %w", err))
+		}
+	}
+
+	span.SetAttributes(
+		attribute.String("lsp.settings.rootJournal", settings.RootJournal),
+		attribute.Bool("lsp.settings.strict", settings.Strict),
+	)
+}
+
+// refreshSettings requests the current settings from the client in the
+// background, applies them and then checks the workspace again.
+func (server server) refreshSettings(ctx context.Context) {
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		server.settings.refreshing.Lock()
+		defer server.settings.refreshing.Unlock()
+
+		span := trace.SpanFromContext(ctx)
+
+		configuration, err := server.client.Configuration(ctx, &protocol.ConfigurationParams{
+			Items: []protocol.ConfigurationItem{{Section: settingsSection}},
+		})
+		if err != nil || len(configuration) == 0 {
+			server.logger.Warn("failed to request the configuration", zap.Error(err))
+			server.indexWorkspace(ctx, server.workspace.Folders())
+			return
+		}
+
+		settings, err := server.settings.decodeChangedSettings(configuration[0])
+		if err != nil {
+			span.RecordError(fmt.Errorf("invalid settings: %w", err))
+		}
+
+		server.applySettings(ctx, settings)
+		server.settingsChanged(ctx)
+	}()
+}
+
+// settingsChanged indexes all workspace folders again, since their root
+// journals may have changed, and checks the open documents again.
+func (server server) settingsChanged(ctx context.Context) {
+	folders := server.workspace.Folders()
+	for _, folder := range folders {
+		folder.forgetJournals()
+	}
+	server.indexWorkspace(ctx, folders)
+
+	for _, filePath := range server.workspace.OpenDocuments() {
+		server.scheduleDiagnostics(ctx, getURIFromFilePath(filePath), filePath)
+	}
+}
+
+// DidChangeConfiguration applies the new settings. Clients that answer
+// workspace/configuration requests are asked for them, since they may not
+// send them along.
+func (server server) DidChangeConfiguration(ctx context.Context, params *protocol.DidChangeConfigurationParams) error {
+	span := trace.SpanFromContext(ctx)
+
+	if server.settings.clientPulls() {
+		server.refreshSettings(ctx)
+		return nil
+	}
+
+	settings, err := server.settings.decodeChangedSettings(params.Settings)
+	if err != nil {
+		err = fmt.Errorf("invalid settings: %w", err)
+		span.RecordError(err)
+		return err
+	}
+
+	server.applySettings(ctx, settings)
+	server.settingsChanged(ctx)
+
+	return nil
+}
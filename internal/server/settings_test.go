@@ -0,0 +1,64 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+)
+
+func TestDecodeSettings(t *testing.T) {
+	t.Run("keeps the defaults of settings that are left out.", func(t *testing.T) {
+		settings, err := decodeSettings(map[string]interface{}{
+			"rootJournal": "main.journal",
+			"completion":  map[string]interface{}{"maxItems": 10},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "main.journal", settings.RootJournal)
+		assert.Equal(t, completionSettings{Enabled: true, MaxItems: 10}, settings.Completion)
+		assert.True(t, settings.Diagnostics.Enabled)
+		assert.True(t, settings.InlayHints.RunningBalances)
+		assert.True(t, settings.FileWatcher.Enabled)
+	})
+
+	t.Run("unwraps settings nested in the section of the language server.", func(t *testing.T) {
+		settings, err := decodeSettings(map[string]interface{}{
+			"hledger": map[string]interface{}{
+				"strict":     true,
+				"formatting": map[string]interface{}{"amountColumn": 40},
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.True(t, settings.Strict)
+		assert.Equal(t, 40, settings.Formatting.AmountColumn)
+	})
+
+	t.Run("lets later layers override earlier ones.", func(t *testing.T) {
+		initializationOptions := map[string]interface{}{
+			"rootJournal":   "main.journal",
+			"cacheMaxFiles": 10,
+			"telemetry":     map[string]interface{}{"endpoint": "collector:4317"},
+		}
+		changedSettings := map[string]interface{}{
+			"cacheMaxFiles": 20,
+			"diagnostics":   map[string]interface{}{"disabled": []string{"include-cycle"}},
+		}
+
+		settings, err := decodeSettings(initializationOptions, changedSettings)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "main.journal", settings.RootJournal)
+		assert.Equal(t, 20, *settings.CacheMaxFiles)
+		assert.Equal(t, "collector:4317", settings.Telemetry.Endpoint)
+		assert.False(t, settings.Diagnostics.reportsDiagnostic("include-cycle"))
+		assert.True(t, settings.Diagnostics.reportsDiagnostic("parse-error"))
+	})
+
+	t.Run("uses the defaults without settings.", func(t *testing.T) {
+		settings, err := decodeSettings(nil)
+
+		assert.NoError(t, err)
+		assert.Equal(t, defaultSettings(), settings)
+	})
+}
@@ -1,16 +1,74 @@
 package server
 
 import (
-	"strings"
+	"context"
+	"io"
+	"path/filepath"
+	"unicode/utf16"
 
 	"go.lsp.dev/uri"
 )
 
-// getFilePathFromURI takes the file name from a URI and removes its prefix
-// until it is a relative path.
+// getFilePathFromURI returns the absolute path of the file a URI points to.
 func getFilePathFromURI(documentURI uri.URI) string {
-	filePath := documentURI.Filename()
-	trimmedFilePath := strings.TrimPrefix(filePath, "file:///")
+	return filepath.ToSlash(documentURI.Filename())
+}
+
+// getURIFromFilePath is the inverse of getFilePathFromURI.
+func getURIFromFilePath(filePath string) uri.URI {
+	return uri.File(filepath.FromSlash(filePath))
+}
+
+// utf16Length returns the length of a string in UTF-16 code units, which is
+// what LSP positions count in.
+func utf16Length(text string) uint32 {
+	length := 0
+	for _, r := range text {
+		length += utf16.RuneLen(r)
+	}
+
+	return uint32(length)
+}
+
+// runeColumn converts an LSP character offset on a line into a 1-based column
+// counted in runes, which is what the parser uses.
+func runeColumn(line string, character uint32) int {
+	column := 1
+	length := uint32(0)
+	for _, r := range line {
+		if length >= character {
+			break
+		}
+		length += uint32(utf16.RuneLen(r))
+		column++
+	}
+
+	return column
+}
+
+// utf16Column converts a 1-based column counted in runes into an LSP character
+// offset on the line.
+func utf16Column(line string, column int) uint32 {
+	runes := []rune(line)
+	if column-1 < len(runes) {
+		runes = runes[:column-1]
+	}
+
+	return utf16Length(string(runes))
+}
+
+// readDocument returns the content of a document, either from the editor or
+// from the workspace.
+func (server server) readDocument(ctx context.Context, filePath string) (string, error) {
+	file, err := server.workspace.folderFor(filePath).documentCache.Open(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
 
-	return trimmedFilePath
+	return string(content), nil
 }
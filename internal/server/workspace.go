@@ -0,0 +1,600 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.lsp.dev/protocol"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/yeldirium/hledger-language-server/internal/documentcache"
+	"github.com/yeldirium/hledger-language-server/internal/ledger"
+	"github.com/yeldirium/hledger-language-server/internal/lru"
+	"github.com/yeldirium/hledger-language-server/internal/parsercache"
+)
+
+// workspaceFolder holds the caches for the documents of a workspace folder.
+type workspaceFolder struct {
+	sync.RWMutex
+	name          string
+	path          string
+	documentCache *documentcache.DocumentCache
+	parserCache   *parsercache.ParserCache
+	// rootJournal is the configured journal that the files of the folder
+	// belong to. It may be empty.
+	rootJournal string
+	// discoverJournals enables scanning the folder for journals including a
+	// file that the root journal does not include.
+	discoverJournals bool
+	// journals are the journals found in the folder. They are nil until the
+	// folder has been scanned.
+	journals []string
+	// journalFilePaths cache the journal that each file belongs to, since
+	// finding it builds the include graph of the folder. They are forgotten
+	// whenever the root journal, the journals of the folder or their include
+	// directives may have changed, which increments the generation.
+	journalFilePaths           map[string]string
+	journalFilePathsGeneration int
+}
+
+// defaultCacheLimits bound the documents and ASTs kept for the files that
+// are not open in the editor, per workspace folder.
+var defaultCacheLimits = lru.Limits{MaxBytes: 32 << 20}
+
+func newWorkspaceFolder(name string, folderPath string, discoverJournals bool, cacheLimits lru.Limits) *workspaceFolder {
+	documentCache := documentcache.NewCache(folderPath, os.DirFS(folderPath))
+	// Journals may include files outside of the folder, like
+	// ../common.journal or ~/prices.journal.
+	documentCache.SetOutsideFS(os.DirFS("/"))
+	documentCache.SetLimits(cacheLimits)
+	parserCache := parsercache.NewCache(documentCache)
+	parserCache.SetLimits(cacheLimits)
+	return &workspaceFolder{
+		name:             name,
+		path:             folderPath,
+		documentCache:    documentCache,
+		parserCache:      parserCache,
+		discoverJournals: discoverJournals,
+		journalFilePaths: make(map[string]string),
+	}
+}
+
+func (folder *workspaceFolder) RootJournal() string {
+	folder.RLock()
+	defer folder.RUnlock()
+
+	return folder.rootJournal
+}
+
+func (folder *workspaceFolder) SetRootJournal(rootJournal string) {
+	folder.Lock()
+	defer folder.Unlock()
+
+	if folder.rootJournal != rootJournal {
+		folder.rootJournal = rootJournal
+		folder.forgetJournalFilePathsLocked()
+	}
+}
+
+// Journals returns the journals in the folder, scanning it on first use.
+func (folder *workspaceFolder) Journals(ctx context.Context) []string {
+	folder.Lock()
+	defer folder.Unlock()
+
+	if !folder.discoverJournals {
+		return nil
+	}
+	if folder.journals == nil {
+		journals, err := folder.parserCache.FindJournals(ctx, folder.path)
+		if err != nil {
+			trace.SpanFromContext(ctx).RecordError(err)
+			return nil
+		}
+		folder.journals = journals
+	}
+	return slices.Clone(folder.journals)
+}
+
+// forgetJournals makes the next call to Journals scan the folder again.
+func (folder *workspaceFolder) forgetJournals() {
+	folder.Lock()
+	defer folder.Unlock()
+
+	folder.journals = nil
+	folder.forgetJournalFilePathsLocked()
+}
+
+// forgetJournalFilePaths makes journalFilePath find the journals that files
+// belong to again.
+func (folder *workspaceFolder) forgetJournalFilePaths() {
+	folder.Lock()
+	defer folder.Unlock()
+
+	folder.forgetJournalFilePathsLocked()
+}
+
+func (folder *workspaceFolder) forgetJournalFilePathsLocked() {
+	clear(folder.journalFilePaths)
+	folder.journalFilePathsGeneration += 1
+}
+
+// addJournal adds a document opened in the editor to the journals of the
+// folder, in case it has not been saved yet.
+func (folder *workspaceFolder) addJournal(filePath string) {
+	folder.Lock()
+	defer folder.Unlock()
+
+	if folder.journals != nil && !slices.Contains(folder.journals, filePath) {
+		folder.journals = append(folder.journals, filePath)
+		slices.Sort(folder.journals)
+		folder.forgetJournalFilePathsLocked()
+	}
+}
+
+// journalFilePath returns the journal that the given file belongs to: the
+// root journal of the folder if it includes the file, or else the first of
+// the outermost journals in the folder that include it. Files that no journal
+// includes belong to themselves.
+func (folder *workspaceFolder) journalFilePath(ctx context.Context, filePath string) string {
+	folder.RLock()
+	journalFilePath, ok := folder.journalFilePaths[filePath]
+	generation := folder.journalFilePathsGeneration
+	folder.RUnlock()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Bool("lsp.journalFilePathHit", ok),
+	)
+	if ok {
+		return journalFilePath
+	}
+
+	journalFilePath = folder.findJournalFilePath(ctx, filePath)
+
+	folder.Lock()
+	// The journals may have changed while looking for the journal.
+	if folder.journalFilePathsGeneration == generation {
+		folder.journalFilePaths[filePath] = journalFilePath
+	}
+	folder.Unlock()
+
+	return journalFilePath
+}
+
+func (folder *workspaceFolder) findJournalFilePath(ctx context.Context, filePath string) string {
+	rootJournal := folder.RootJournal()
+	if rootJournal == filePath {
+		return filePath
+	}
+	if rootJournal != "" {
+		includeGraph := folder.parserCache.BuildIncludeGraph(ctx, rootJournal)
+		if slices.Contains(includeGraph.RootsReaching(filePath), rootJournal) {
+			return rootJournal
+		}
+	}
+
+	rootJournals := folder.parserCache.FindRootJournals(ctx, filePath, folder.Journals(ctx))
+	if len(rootJournals) == 0 {
+		return filePath
+	}
+	return rootJournals[0]
+}
+
+// resolveJournal parses the journal that the given file belongs to and
+// resolves its includes.
+func (folder *workspaceFolder) resolveJournal(ctx context.Context, filePath string) (*ledger.Journal, error) {
+	span := trace.SpanFromContext(ctx)
+
+	journalFilePath := folder.journalFilePath(ctx, filePath)
+	span.SetAttributes(
+		attribute.String("lsp.journalFilePath", journalFilePath),
+	)
+
+	journal, err := folder.parserCache.Parse(ctx, journalFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return folder.parserCache.ResolveIncludes(ctx, journal, journalFilePath)
+}
+
+// workspace holds the workspace folders reported by the client. Documents
+// outside of all of them are kept in a fallback folder rooted at the root of
+// the file system, which is never scanned for journals.
+type workspace struct {
+	sync.RWMutex
+	folders       []*workspaceFolder
+	fallback      *workspaceFolder
+	openDocuments map[string]bool
+	// rootJournalSetting is the root journal configured by the client. If it
+	// is relative, it is resolved in each workspace folder.
+	rootJournalSetting string
+	// ledgerFile is the absolute path from the LEDGER_FILE environment
+	// variable. It is the root journal of the folder containing it, or of all
+	// folders if none contains it, unless a root journal is configured.
+	ledgerFile string
+	// cacheLimits bound the caches of each folder.
+	cacheLimits lru.Limits
+	// diskCache keeps the ASTs of all folders across restarts, if enabled.
+	diskCache *parsercache.DiskCache
+	// sharedCache shares the ASTs of all folders with other clients of the
+	// server, if enabled.
+	sharedCache *parsercache.SharedCache
+}
+
+func newWorkspace() *workspace {
+	return &workspace{
+		folders:       make([]*workspaceFolder, 0),
+		fallback:      newWorkspaceFolder("", "/", false, defaultCacheLimits),
+		openDocuments: make(map[string]bool),
+		cacheLimits:   defaultCacheLimits,
+	}
+}
+
+// SetDiskCache makes all workspace folders keep their ASTs in the disk cache.
+// Passing nil disables it.
+func (workspace *workspace) SetDiskCache(diskCache *parsercache.DiskCache) {
+	workspace.Lock()
+	defer workspace.Unlock()
+
+	workspace.diskCache = diskCache
+	for _, folder := range append(slices.Clone(workspace.folders), workspace.fallback) {
+		folder.parserCache.SetDiskCache(diskCache)
+	}
+}
+
+// SetSharedCache makes all workspace folders share their ASTs through the
+// shared cache. Passing nil disables it.
+func (workspace *workspace) SetSharedCache(sharedCache *parsercache.SharedCache) {
+	workspace.Lock()
+	defer workspace.Unlock()
+
+	workspace.sharedCache = sharedCache
+	for _, folder := range append(slices.Clone(workspace.folders), workspace.fallback) {
+		folder.parserCache.SetSharedCache(sharedCache)
+	}
+}
+
+// SetCacheLimits bounds the caches of all workspace folders.
+func (workspace *workspace) SetCacheLimits(limits lru.Limits) {
+	workspace.Lock()
+	defer workspace.Unlock()
+
+	workspace.cacheLimits = limits
+	for _, folder := range append(slices.Clone(workspace.folders), workspace.fallback) {
+		folder.documentCache.SetLimits(limits)
+		folder.parserCache.SetLimits(limits)
+	}
+}
+
+// SetRootJournals configures the root journals of all workspace folders.
+func (workspace *workspace) SetRootJournals(rootJournalSetting string, ledgerFile string) {
+	workspace.Lock()
+	defer workspace.Unlock()
+
+	workspace.rootJournalSetting = rootJournalSetting
+	workspace.ledgerFile = ledgerFile
+	workspace.applyRootJournalsLocked()
+}
+
+func (workspace *workspace) applyRootJournalsLocked() {
+	for _, folder := range append(slices.Clone(workspace.folders), workspace.fallback) {
+		folder.SetRootJournal(workspace.rootJournalForLocked(folder))
+	}
+}
+
+func (workspace *workspace) rootJournalForLocked(folder *workspaceFolder) string {
+	if workspace.rootJournalSetting != "" {
+		rootJournal := parsercache.ExpandHome(workspace.rootJournalSetting)
+		if path.IsAbs(rootJournal) {
+			return path.Clean(rootJournal)
+		}
+		if folder == workspace.fallback {
+			return ""
+		}
+		return path.Join(folder.path, rootJournal)
+	}
+
+	if workspace.ledgerFile == "" {
+		return ""
+	}
+	// A LEDGER_FILE outside of all workspace folders, like the main journal in
+	// the parent of an opened folder of included files, is a candidate for
+	// every folder. It only applies to the files its include graph reaches.
+	if ledgerFileFolder := workspace.folderForLocked(workspace.ledgerFile); ledgerFileFolder == folder || ledgerFileFolder == workspace.fallback {
+		return workspace.ledgerFile
+	}
+	return ""
+}
+
+// folderFor returns the innermost workspace folder containing the file.
+func (workspace *workspace) folderFor(filePath string) *workspaceFolder {
+	workspace.RLock()
+	defer workspace.RUnlock()
+
+	return workspace.folderForLocked(filePath)
+}
+
+func (workspace *workspace) folderForLocked(filePath string) *workspaceFolder {
+	for _, folder := range workspace.folders {
+		if folder.documentCache.Contains(filePath) {
+			return folder
+		}
+	}
+	return workspace.fallback
+}
+
+func (workspace *workspace) Folders() []*workspaceFolder {
+	workspace.RLock()
+	defer workspace.RUnlock()
+
+	return slices.Clone(workspace.folders)
+}
+
+// AddFolder adds a workspace folder, unless it has been added before, moves
+// the open documents it contains into its cache and returns it.
+func (workspace *workspace) AddFolder(name string, folderPath string) *workspaceFolder {
+	workspace.Lock()
+	defer workspace.Unlock()
+
+	folderPath = path.Clean(folderPath)
+	if index := slices.IndexFunc(workspace.folders, func(folder *workspaceFolder) bool {
+		return folder.path == folderPath
+	}); index >= 0 {
+		return workspace.folders[index]
+	}
+
+	newFolder := newWorkspaceFolder(name, folderPath, true, workspace.cacheLimits)
+	newFolder.parserCache.SetDiskCache(workspace.diskCache)
+	newFolder.parserCache.SetSharedCache(workspace.sharedCache)
+	for filePath := range workspace.openDocuments {
+		if !newFolder.documentCache.Contains(filePath) {
+			continue
+		}
+		oldFolder := workspace.folderForLocked(filePath)
+		if len(oldFolder.path) > len(newFolder.path) {
+			continue
+		}
+		moveDocument(oldFolder, newFolder, filePath)
+	}
+
+	workspace.folders = append(workspace.folders, newFolder)
+	// Nested folders have to come first, so that folderFor finds the
+	// innermost folder containing a file.
+	slices.SortFunc(workspace.folders, func(a, b *workspaceFolder) int {
+		return len(b.path) - len(a.path)
+	})
+	workspace.applyRootJournalsLocked()
+
+	return newFolder
+}
+
+// RemoveFolder removes a workspace folder and moves its open documents into
+// the folder that contains them now.
+func (workspace *workspace) RemoveFolder(folderPath string) {
+	workspace.Lock()
+	defer workspace.Unlock()
+
+	folderPath = path.Clean(folderPath)
+	index := slices.IndexFunc(workspace.folders, func(folder *workspaceFolder) bool {
+		return folder.path == folderPath
+	})
+	if index < 0 {
+		return
+	}
+
+	removedFolder := workspace.folders[index]
+	workspace.folders = slices.Delete(workspace.folders, index, index+1)
+
+	for filePath := range workspace.openDocuments {
+		if removedFolder.documentCache.Contains(filePath) {
+			moveDocument(removedFolder, workspace.folderForLocked(filePath), filePath)
+		}
+	}
+	workspace.applyRootJournalsLocked()
+}
+
+func moveDocument(from *workspaceFolder, to *workspaceFolder, filePath string) {
+	content, ok := from.documentCache.GetFile(filePath)
+	if !ok {
+		return
+	}
+	from.documentCache.DeleteFile(filePath)
+	from.parserCache.Remove(filePath)
+	from.forgetJournalFilePaths()
+	to.documentCache.SetFile(filePath, content)
+	to.parserCache.Remove(filePath)
+	to.addJournal(filePath)
+}
+
+// OpenDocument stores the content of a document opened in the editor.
+func (workspace *workspace) OpenDocument(filePath string, content string) {
+	workspace.Lock()
+	defer workspace.Unlock()
+
+	workspace.openDocuments[filePath] = true
+	folder := workspace.folderForLocked(filePath)
+	previousContent, ok := folder.documentCache.GetFile(filePath)
+	if !ok || !slices.Equal(includeLines(previousContent), includeLines(content)) {
+		folder.forgetJournalFilePaths()
+	}
+	folder.documentCache.SetFile(filePath, content)
+	folder.parserCache.Remove(filePath)
+	folder.addJournal(filePath)
+}
+
+// includeLines returns the lines of the content with include directives,
+// which decide the journals that files belong to.
+func includeLines(content string) []string {
+	lines := make([]string, 0)
+	for line := range strings.Lines(content) {
+		if strings.HasPrefix(line, "include") || strings.HasPrefix(line, "!include") {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return lines
+}
+
+// CloseDocument forgets the content of a document closed in the editor.
+func (workspace *workspace) CloseDocument(filePath string) {
+	workspace.Lock()
+	defer workspace.Unlock()
+
+	delete(workspace.openDocuments, filePath)
+	folder := workspace.folderForLocked(filePath)
+	folder.documentCache.DeleteFile(filePath)
+	// The parsed document may differ from the one on disk.
+	folder.parserCache.Remove(filePath)
+	folder.forgetJournalFilePaths()
+}
+
+// OpenDocuments returns the paths of the documents open in the editor, sorted.
+func (workspace *workspace) OpenDocuments() []string {
+	workspace.RLock()
+	defer workspace.RUnlock()
+
+	filePaths := make([]string, 0, len(workspace.openDocuments))
+	for filePath := range workspace.openDocuments {
+		filePaths = append(filePaths, filePath)
+	}
+	slices.Sort(filePaths)
+	return filePaths
+}
+
+// FileChanged drops the cached content and AST of a file that was changed on
+// disk and returns the folders that were affected: the folder containing it
+// and the folders that read it from outside. Documents open in the editor are
+// kept, since the editor holds their current content. Creating or deleting a
+// file drops all resolved journals, and makes the folder look for journals
+// again if it is one.
+func (workspace *workspace) FileChanged(filePath string, changeType protocol.FileChangeType) []*workspaceFolder {
+	workspace.RLock()
+	defer workspace.RUnlock()
+
+	folder := workspace.folderForLocked(filePath)
+	// The include directives of the file may have changed.
+	folder.forgetJournalFilePaths()
+	if changeType != protocol.FileChangeTypeChanged {
+		// Include globs may match a different set of files now.
+		folder.parserCache.RemoveResolvedJournals()
+		if parsercache.HasJournalExtension(filePath) {
+			folder.forgetJournals()
+		}
+	}
+	if workspace.openDocuments[filePath] {
+		return []*workspaceFolder{folder}
+	}
+
+	affectedFolders := []*workspaceFolder{folder}
+	for _, cachingFolder := range append(slices.Clone(workspace.folders), workspace.fallback) {
+		if cachingFolder.documentCache.Refresh(filePath) {
+			cachingFolder.parserCache.Remove(filePath)
+			cachingFolder.forgetJournalFilePaths()
+			if cachingFolder != folder {
+				affectedFolders = append(affectedFolders, cachingFolder)
+			}
+		}
+	}
+	return affectedFolders
+}
+
+func registerWorkspaceCapabilities(capabilities *protocol.ServerCapabilities) {
+	capabilities.Workspace = &protocol.ServerCapabilitiesWorkspace{
+		WorkspaceFolders: &protocol.ServerCapabilitiesWorkspaceFolders{
+			Supported:           true,
+			ChangeNotifications: true,
+		},
+	}
+}
+
+// diskCacheMaxAge is how long entries of the disk cache are kept without
+// being used.
+const diskCacheMaxAge = 30 * 24 * time.Hour
+
+// initializeWorkspace adds the workspace folders reported by the client. Older
+// clients only report a root URI.
+func (server server) initializeWorkspace(params *protocol.InitializeParams) {
+	for _, workspaceFolder := range params.WorkspaceFolders {
+		server.workspace.AddFolder(workspaceFolder.Name, getFilePathFromURI(protocol.DocumentURI(workspaceFolder.URI)))
+	}
+	if len(params.WorkspaceFolders) == 0 && params.RootURI != "" {
+		rootPath := getFilePathFromURI(params.RootURI)
+		server.workspace.AddFolder(path.Base(rootPath), rootPath)
+	}
+}
+
+// enableDiskCache keeps the ASTs of all workspace folders in the given
+// directory, or in the user cache directory if it is empty, and prunes old
+// entries in the background.
+func (server server) enableDiskCache(ctx context.Context, directory string) {
+	span := trace.SpanFromContext(ctx)
+
+	if directory == "" {
+		userCacheDir, err := os.UserCacheDir()
+		if err != nil {
+			span.RecordError(fmt.Errorf("failed to find the user cache directory: %w", err))
+			return
+		}
+		directory = filepath.Join(userCacheDir, "hledger-language-server", "asts")
+	}
+	span.SetAttributes(
+		attribute.String("lsp.workspace.persistentCacheDirectory", directory),
+	)
+
+	diskCache := parsercache.NewDiskCache(directory)
+	server.workspace.SetDiskCache(diskCache)
+
+	go func() {
+		if err := diskCache.Prune(diskCacheMaxAge); err != nil {
+			server.logger.Warn("failed to prune the persistent cache", zap.Error(err))
+		}
+	}()
+}
+
+// ledgerFileFromEnvironment returns the absolute path of the journal that the
+// LEDGER_FILE environment variable points to, like hledger reads it.
+func ledgerFileFromEnvironment() string {
+	ledgerFile := os.Getenv("LEDGER_FILE")
+	if ledgerFile == "" {
+		return ""
+	}
+
+	ledgerFile, err := filepath.Abs(filepath.FromSlash(parsercache.ExpandHome(filepath.ToSlash(ledgerFile))))
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(ledgerFile)
+}
+
+func (server server) DidChangeWorkspaceFolders(ctx context.Context, params *protocol.DidChangeWorkspaceFoldersParams) error {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Int("lsp.workspaceFolders.addedCount", len(params.Event.Added)),
+		attribute.Int("lsp.workspaceFolders.removedCount", len(params.Event.Removed)),
+	)
+
+	server.fileWatcher.Lock()
+	defer server.fileWatcher.Unlock()
+
+	for _, workspaceFolder := range params.Event.Removed {
+		folderPath := getFilePathFromURI(protocol.DocumentURI(workspaceFolder.URI))
+		server.workspace.RemoveFolder(folderPath)
+		server.unwatchDirectory(folderPath)
+	}
+	addedFolders := make([]*workspaceFolder, 0, len(params.Event.Added))
+	for _, workspaceFolder := range params.Event.Added {
+		folderPath := getFilePathFromURI(protocol.DocumentURI(workspaceFolder.URI))
+		addedFolders = append(addedFolders, server.workspace.AddFolder(workspaceFolder.Name, folderPath))
+		server.watchDirectory(folderPath)
+	}
+	server.indexWorkspace(ctx, addedFolders)
+
+	return nil
+}
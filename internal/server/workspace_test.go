@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/alecthomas/assert/v2"
+	"go.lsp.dev/protocol"
+	"go.uber.org/zap"
+)
+
+func TestWorkspace(t *testing.T) {
+	t.Run("resolves includes outside of the workspace folder.", func(t *testing.T) {
+		directory := t.TempDir()
+		assert.NoError(t, os.Mkdir(filepath.Join(directory, "ledger"), 0o755))
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "x.journal"), []byte("account expenses:Shared\n"), 0o644))
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, "ledger", "main.journal"), []byte("include ../x.journal\n\n2024-11-25 Payee\n    ex\n"), 0o644))
+
+		server := server{
+			logger:      zap.NewNop(),
+			workspace:   newWorkspace(),
+			fileWatcher: newFileWatcher(),
+			settings:    newSettingsStore(),
+		}
+		server.workspace.AddFolder("ledger", filepath.ToSlash(filepath.Join(directory, "ledger")))
+
+		filePath := filepath.ToSlash(filepath.Join(directory, "ledger", "main.journal"))
+		completionList, err := server.Completion(context.Background(), &protocol.CompletionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: getURIFromFilePath(filePath)},
+				Position:     protocol.Position{Line: 3, Character: 6},
+			},
+		})
+
+		assert.NoError(t, err)
+		assert.True(t, slices.ContainsFunc(completionList.Items, func(item protocol.CompletionItem) bool {
+			return item.Label == "expenses:Shared"
+		}))
+	})
+	t.Run("remembers the journal that a file belongs to until include directives change.", func(t *testing.T) {
+		directory := t.TempDir()
+		files := map[string]string{
+			"main.journal":  "include a.journal\n",
+			"other.journal": "",
+			"a.journal":     "2024-11-25 Payee\n    expenses:Food  10 €\n    assets:Cash\n",
+		}
+		for fileName, content := range files {
+			assert.NoError(t, os.WriteFile(filepath.Join(directory, fileName), []byte(content), 0o644))
+		}
+		folderPath := filepath.ToSlash(directory)
+		workspace := newWorkspace()
+		folder := workspace.AddFolder("ledger", folderPath)
+		filePath := folderPath + "/a.journal"
+
+		assert.Equal(t, folderPath+"/main.journal", folder.journalFilePath(context.Background(), filePath))
+
+		workspace.OpenDocument(filePath, files["a.journal"])
+		workspace.OpenDocument(filePath, files["a.journal"]+"\n; a comment\n")
+		assert.Equal(t, map[string]string{filePath: folderPath + "/main.journal"}, folder.journalFilePaths)
+
+		workspace.OpenDocument(folderPath+"/main.journal", "")
+		workspace.OpenDocument(folderPath+"/other.journal", "include a.journal\n")
+		assert.Equal(t, folderPath+"/other.journal", folder.journalFilePath(context.Background(), filePath))
+	})
+	t.Run("uses a LEDGER_FILE outside of all workspace folders for the files it includes.", func(t *testing.T) {
+		directory := t.TempDir()
+		assert.NoError(t, os.Mkdir(filepath.Join(directory, "2024"), 0o755))
+		files := map[string]string{
+			"main.journal":       "include 2024/a.journal\n",
+			"2024/a.journal":     "2024-11-25 Payee\n    expenses:Food  10 €\n    assets:Cash\n",
+			"2024/other.journal": "",
+		}
+		for fileName, content := range files {
+			assert.NoError(t, os.WriteFile(filepath.Join(directory, filepath.FromSlash(fileName)), []byte(content), 0o644))
+		}
+		directoryPath := filepath.ToSlash(directory)
+		workspace := newWorkspace()
+		folder := workspace.AddFolder("2024", directoryPath+"/2024")
+		workspace.SetRootJournals("", directoryPath+"/main.journal")
+
+		assert.Equal(t, directoryPath+"/main.journal", folder.journalFilePath(context.Background(), directoryPath+"/2024/a.journal"))
+		assert.Equal(t, directoryPath+"/2024/other.journal", folder.journalFilePath(context.Background(), directoryPath+"/2024/other.journal"))
+	})
+}
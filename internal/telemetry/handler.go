@@ -2,6 +2,7 @@ package telemetry
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"go.lsp.dev/jsonrpc2"
@@ -18,16 +19,37 @@ import (
 	"github.com/yeldirium/hledger-language-server/internal/version"
 )
 
+// DefaultEndpoint is the OTLP collector that spans are sent to unless another
+// endpoint is configured.
+const DefaultEndpoint = "localhost:4317"
+
 type Telemetry struct {
 	logger *zap.Logger
 	Tracer t.Tracer
+
+	mutex    sync.Mutex
+	provider *trace.TracerProvider
+	// exporter sends the spans to endpoint.
+	exporter trace.SpanProcessor
+	endpoint string
+	// setupEndpoint is the endpoint passed to SetupTelemetry, which is used
+	// unless another one is set.
+	setupEndpoint string
+	// endpointFixed makes SetEndpoint keep the current endpoint.
+	endpointFixed bool
 }
 
 type telemetryContextKey struct{}
 
 var key = telemetryContextKey{}
 
-func SetupTelemetry(ctx context.Context, logger *zap.Logger) (*Telemetry, func(context.Context) error, error) {
+// SetupTelemetry sends spans to the OTLP collector at the given endpoint, or at
+// DefaultEndpoint if it is empty.
+func SetupTelemetry(ctx context.Context, logger *zap.Logger, endpoint string) (*Telemetry, func(context.Context) error, error) {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+
 	resource, err := resource.New(ctx, resource.WithAttributes(
 		attribute.String("service.name", "hledger-language-server"),
 	))
@@ -41,30 +63,91 @@ func SetupTelemetry(ctx context.Context, logger *zap.Logger) (*Telemetry, func(c
 	)
 	otel.SetTextMapPropagator(propagator)
 
-	traceExporter, err := otlptracegrpc.New(
-		ctx,
-		otlptracegrpc.WithEndpoint("localhost:4317"),
-		otlptracegrpc.WithInsecure(),
-	)
+	exporter, err := newExporter(ctx, endpoint)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	traceProvider := trace.NewTracerProvider(
 		trace.WithResource(resource),
-		trace.WithBatcher(traceExporter,
-			trace.WithBatchTimeout(5*time.Second)),
+		trace.WithSpanProcessor(exporter),
 	)
 
 	otel.SetTracerProvider(traceProvider)
 	tracer := traceProvider.Tracer(version.Path())
 
 	return &Telemetry{
-		logger: logger,
-		Tracer: tracer,
+		logger:   logger,
+		Tracer:   tracer,
+		provider: traceProvider,
+		exporter: exporter,
+		endpoint: endpoint,
+
+		setupEndpoint: endpoint,
 	}, traceProvider.Shutdown, nil
 }
 
+func newExporter(ctx context.Context, endpoint string) (trace.SpanProcessor, error) {
+	traceExporter, err := otlptracegrpc.New(
+		ctx,
+		otlptracegrpc.WithEndpoint(endpoint),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return trace.NewBatchSpanProcessor(traceExporter, trace.WithBatchTimeout(5*time.Second)), nil
+}
+
+// FixEndpoint makes SetEndpoint keep the current endpoint. This is needed if
+// the servers of several clients share the telemetry, so that no client can
+// redirect the spans of the others.
+func (telemetry *Telemetry) FixEndpoint() {
+	telemetry.mutex.Lock()
+	defer telemetry.mutex.Unlock()
+
+	telemetry.endpointFixed = true
+}
+
+// SetEndpoint sends all spans ended from now on to the OTLP collector at the
+// given endpoint. An empty endpoint means the one passed to SetupTelemetry.
+// Spans that are still queued for the previous endpoint are sent there in the
+// background. The endpoint is kept after FixEndpoint.
+func (telemetry *Telemetry) SetEndpoint(ctx context.Context, endpoint string) error {
+	telemetry.mutex.Lock()
+	defer telemetry.mutex.Unlock()
+
+	if telemetry.endpointFixed {
+		if endpoint != "" && endpoint != telemetry.endpoint {
+			telemetry.logger.Debug("ignoring the telemetry endpoint of a client, since the telemetry is shared", zap.String("endpoint", endpoint))
+		}
+		return nil
+	}
+
+	if endpoint == "" {
+		endpoint = telemetry.setupEndpoint
+	}
+
+	if endpoint == telemetry.endpoint {
+		return nil
+	}
+
+	exporter, err := newExporter(ctx, endpoint)
+	if err != nil {
+		return err
+	}
+
+	telemetry.provider.RegisterSpanProcessor(exporter)
+	// Unregistering flushes the queued spans, which blocks until the previous
+	// collector accepted them or the export timed out.
+	go telemetry.provider.UnregisterSpanProcessor(telemetry.exporter)
+
+	telemetry.exporter = exporter
+	telemetry.endpoint = endpoint
+	return nil
+}
+
 func SetGlobalAttributes(span t.Span) {
 	span.SetAttributes(
 		attribute.String("service.name", "hledger-language-server"),
@@ -1,86 +1,46 @@
 package main
 
 import (
-	"context"
-	"io"
+	"fmt"
 	"os"
-	"path/filepath"
-	"time"
-
-	"go.lsp.dev/jsonrpc2"
-	"go.lsp.dev/protocol"
-	"go.uber.org/zap"
-
-	"github.com/yeldirium/hledger-language-server/internal/server"
-	"github.com/yeldirium/hledger-language-server/internal/telemetry"
+	"strings"
 )
 
-func main() {
-	dir, err := os.MkdirTemp("", "hledger-language-server")
-	if err != nil {
-		panic(err)
-	}
-	defer func() {
-		_ = os.RemoveAll(dir)
-	}()
-	logFile := filepath.Join(dir, "log.txt")
+const usage = `Usage: hledger-language-server [command] [flags]
 
-	zapConfig := zap.NewDevelopmentConfig()
-	zapConfig.OutputPaths = []string{logFile}
-	zapConfig.ErrorOutputPaths = []string{logFile}
-	logger, _ := zapConfig.Build()
-	connection := jsonrpc2.NewConn(jsonrpc2.NewStream(&rwCloser{os.Stdin, os.Stdout}))
+Commands:
+  serve    start the language server, the default command
+  check    report the problems in a journal and the files it includes
+  version  print the version of the language server
 
-	clientDispatcher := protocol.ClientDispatcher(connection, logger)
-	serverDispatcher := protocol.ServerDispatcher(connection, logger)
-	handler, ctx, err := server.NewServer(context.Background(), serverDispatcher, clientDispatcher, logger)
-	if err != nil {
-		logger.Sugar().Fatalf("while initializing handler: %w", err)
-	}
-
-	jsonRpcHandler := protocol.ServerHandler(handler, jsonrpc2.MethodNotFoundHandler)
-
-	t, shutdown, err := telemetry.SetupTelemetry(ctx, logger)
-	if err != nil {
-		logger.Sugar().Errorf("failed to setup telemetry: %w", err)
-	} else {
-		defer func() {
-			_ = shutdown(ctx)
-		}()
-
-		logger.Sugar().Infof("successfully connected to telemetry backend")
-		jsonRpcHandler = telemetry.WrapInTelemetry(t, jsonRpcHandler)
-	}
+Run 'hledger-language-server <command> -help' for the flags of a command.
+`
 
-	if err != nil {
-		logger.Sugar().Fatalf("failed to start telemetry instrumentation")
-	}
-	defer func() {
-		_ = shutdown(ctx)
-	}()
-
-	connection.Go(ctx, jsonRpcHandler)
-	<-connection.Done()
-}
-
-type rwCloser struct {
-	io.ReadCloser
-	io.WriteCloser
-}
-
-// SetWriteDeadline implements rpc.Conn.
-func (rw rwCloser) SetWriteDeadline(time.Time) error {
-	return nil
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
 
-func (rw rwCloser) Close() error {
-	err := rw.ReadCloser.Close()
-	if err != nil {
-		return err
+// run executes the command given by the arguments and returns the exit code.
+// Without a command, the language server is started, which is what editors
+// expect.
+func run(args []string) int {
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-	err = rw.WriteCloser.Close()
-	if err != nil {
-		return err
+
+	switch command {
+	case "serve":
+		return serve(args)
+	case "check":
+		return checkJournal(args)
+	case "version":
+		return printVersion(args)
+	case "help":
+		fmt.Fprint(os.Stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		return 2
 	}
-	return nil
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.lsp.dev/jsonrpc2"
+	"go.lsp.dev/protocol"
+	"go.uber.org/zap"
+
+	"github.com/yeldirium/hledger-language-server/internal/lru"
+	"github.com/yeldirium/hledger-language-server/internal/parsercache"
+	"github.com/yeldirium/hledger-language-server/internal/server"
+	"github.com/yeldirium/hledger-language-server/internal/telemetry"
+)
+
+type serveOptions struct {
+	stdio      bool
+	tcpAddress string
+	socketPath string
+
+	logFile   string
+	logLevel  string
+	logFormat string
+
+	telemetry         bool
+	telemetryEndpoint string
+
+	sharedCache bool
+}
+
+// sharedCacheLimits bound the ASTs shared between the clients of a server.
+var sharedCacheLimits = lru.Limits{MaxBytes: 256 << 20}
+
+func serve(args []string) int {
+	options := serveOptions{}
+
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	flags.BoolVar(&options.stdio, "stdio", false, "talk to the client over stdin and stdout, the default")
+	flags.StringVar(&options.tcpAddress, "tcp", "", "listen for a client on the given TCP `address`, like localhost:7777")
+	flags.StringVar(&options.socketPath, "socket", "", "listen for a client on the Unix socket at the given `path`")
+	flags.StringVar(&options.logFile, "log-file", "", "append logs to the given `file` instead of writing them to stderr")
+	flags.StringVar(&options.logLevel, "log-level", "info", "log messages of the given `level` and above: debug, info, warn or error")
+	flags.StringVar(&options.logFormat, "log-format", "console", "write logs in the given `format`: console or json")
+	flags.BoolVar(&options.telemetry, "telemetry", false, "send traces to an OpenTelemetry collector")
+	flags.StringVar(&options.telemetryEndpoint, "telemetry-endpoint", telemetry.DefaultEndpoint, "the OTLP gRPC `endpoint` of the OpenTelemetry collector")
+	flags.BoolVar(&options.sharedCache, "shared-cache", false, "share parsed journals between the clients connected over -tcp or -socket")
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	transportCount := 0
+	for _, selected := range []bool{options.stdio, options.tcpAddress != "", options.socketPath != ""} {
+		if selected {
+			transportCount += 1
+		}
+	}
+	if transportCount > 1 {
+		fmt.Fprintln(os.Stderr, "only one of -stdio, -tcp and -socket may be given")
+		return 2
+	}
+
+	logger, err := newLogger(options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to set up logging: %v\n", err)
+		return 2
+	}
+	defer func() {
+		_ = logger.Sync()
+	}()
+
+	ctx := context.Background()
+
+	var t *telemetry.Telemetry
+	if options.telemetry {
+		var shutdown func(context.Context) error
+		t, shutdown, err = telemetry.SetupTelemetry(ctx, logger, options.telemetryEndpoint)
+		if err != nil {
+			logger.Error("failed to set up telemetry, continuing without it", zap.Error(err))
+		} else {
+			defer func() {
+				_ = shutdown(ctx)
+			}()
+			logger.Info("sending traces to the telemetry backend", zap.String("endpoint", options.telemetryEndpoint))
+		}
+	}
+
+	if err := serveTransport(ctx, options, logger, t); err != nil {
+		logger.Error("language server stopped", zap.Error(err))
+		return 1
+	}
+	return 0
+}
+
+// serveTransport serves a client over the transport selected by the options.
+// Listening on TCP or a Unix socket serves every client that connects, each
+// with its own server, until the process is interrupted.
+func serveTransport(ctx context.Context, options serveOptions, logger *zap.Logger, t *telemetry.Telemetry) error {
+	var sharedCache *parsercache.SharedCache
+	if options.sharedCache {
+		sharedCache = parsercache.NewSharedCache(sharedCacheLimits)
+	}
+
+	var listener net.Listener
+	var err error
+	switch {
+	case options.tcpAddress != "":
+		listener, err = net.Listen("tcp", options.tcpAddress)
+	case options.socketPath != "":
+		listener, err = net.Listen("unix", options.socketPath)
+	default:
+		return serveConnection(ctx, rwCloser{os.Stdin, os.Stdout}, logger, t, sharedCache)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	if t != nil {
+		// All clients send their traces to the endpoint of the flag.
+		t.FixEndpoint()
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Unblocks Accept. Closing a Unix socket listener removes the socket
+		// file.
+		_ = listener.Close()
+	}()
+
+	logger.Info("waiting for clients", zap.Stringer("address", listener.Addr()))
+
+	connectionCount := 0
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				logger.Info("stopped listening", zap.Stringer("address", listener.Addr()))
+				return nil
+			}
+			return fmt.Errorf("failed to accept a client: %w", err)
+		}
+
+		connectionCount += 1
+		connectionLogger := logger.With(zap.Int("connection", connectionCount))
+		connectionLogger.Info("client connected", zap.Stringer("address", conn.RemoteAddr()))
+
+		go func() {
+			if err := serveConnection(ctx, conn, connectionLogger, t, sharedCache); err != nil {
+				connectionLogger.Error("connection failed", zap.Error(err))
+			}
+			connectionLogger.Info("client disconnected")
+		}()
+	}
+}
+
+// serveConnection runs a language server for the client on the other end of
+// the stream until it disconnects. The server shares the ASTs of journals
+// through the shared cache, if there is one.
+func serveConnection(ctx context.Context, stream io.ReadWriteCloser, logger *zap.Logger, t *telemetry.Telemetry, sharedCache *parsercache.SharedCache) error {
+	connection := jsonrpc2.NewConn(jsonrpc2.NewStream(stream))
+
+	clientDispatcher := protocol.ClientDispatcher(connection, logger)
+	serverDispatcher := protocol.ServerDispatcher(connection, logger)
+
+	handler, ctx, err := server.NewServer(ctx, serverDispatcher, clientDispatcher, logger, t)
+	if err != nil {
+		return fmt.Errorf("while initializing handler: %w", err)
+	}
+	if sharedCache != nil {
+		handler.ShareCache(sharedCache)
+	}
+
+	jsonRpcHandler := protocol.ServerHandler(handler, jsonrpc2.MethodNotFoundHandler)
+	if t != nil {
+		jsonRpcHandler = telemetry.WrapInTelemetry(t, jsonRpcHandler)
+	}
+
+	// Requests are handled one after another, but in the background, so that
+	// $/cancelRequest notifications and document changes are read while a
+	// request is handled and can cancel it.
+	jsonRpcHandler = server.CancellationHandler(jsonrpc2.AsyncHandler(jsonRpcHandler))
+
+	connection.Go(ctx, jsonRpcHandler)
+	<-connection.Done()
+
+	if err := connection.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// newLogger logs to stderr, which editors usually keep in their own log, or
+// to the log file.
+func newLogger(options serveOptions) (*zap.Logger, error) {
+	level, err := zap.ParseAtomicLevel(options.logLevel)
+	if err != nil {
+		return nil, err
+	}
+	if options.logFormat != "console" && options.logFormat != "json" {
+		return nil, fmt.Errorf("unknown log format %q", options.logFormat)
+	}
+
+	outputPath := "stderr"
+	if options.logFile != "" {
+		outputPath = options.logFile
+	}
+
+	zapConfig := zap.NewProductionConfig()
+	zapConfig.Level = level
+	zapConfig.Encoding = options.logFormat
+	zapConfig.Sampling = nil
+	zapConfig.OutputPaths = []string{outputPath}
+	zapConfig.ErrorOutputPaths = []string{outputPath}
+	if options.logFormat == "console" {
+		zapConfig.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	}
+
+	return zapConfig.Build()
+}
+
+type rwCloser struct {
+	io.ReadCloser
+	io.WriteCloser
+}
+
+// SetWriteDeadline implements rpc.Conn.
+func (rw rwCloser) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (rw rwCloser) Close() error {
+	err := rw.ReadCloser.Close()
+	if err != nil {
+		return err
+	}
+	err = rw.WriteCloser.Close()
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yeldirium/hledger-language-server/internal/version"
+)
+
+func printVersion(args []string) int {
+	flags := flag.NewFlagSet("version", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	fmt.Fprintf(os.Stdout, "hledger-language-server %s\n", version.Version())
+	fmt.Fprintf(os.Stdout, "module:      %s\n", version.Path())
+	fmt.Fprintf(os.Stdout, "checksum:    %s\n", version.Sum())
+	fmt.Fprintf(os.Stdout, "commit:      %s\n", version.CommitHash())
+	fmt.Fprintf(os.Stdout, "commit time: %s\n", version.CommitTime())
+	fmt.Fprintf(os.Stdout, "dirty:       %s\n", version.Dirty())
+	return 0
+}